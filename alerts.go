@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3"
+	"google.golang.org/api/iterator"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Comparison is how a threshold condition compares a series with its threshold
+type Comparison int
+
+const (
+	// Above fires when the value is greater than the threshold
+	Above Comparison = iota
+	// Below fires when the value is less than the threshold
+	Below
+)
+
+// AlertPolicy declares a threshold alert on one of the Client's metrics. Policies are
+// matched by DisplayName, so EnsureAlertPolicy can run on every deploy.
+type AlertPolicy struct {
+	DisplayName string
+	Metric      string // metric name as passed to PushMetric
+	Filter      string // optional, ANDed with the metric filter, e.g. `metric.label.region = "eu"`
+	Comparison  Comparison
+	Threshold   float64
+	// Duration is how long the condition must hold before the alert fires
+	Duration time.Duration
+	// Aggregation defaults to the mean over 1 minute
+	Aggregation *Aggregation
+	// NotificationChannels are resource names, as returned by EnsureNotificationChannel
+	NotificationChannels []string
+	// Documentation is Markdown included in notifications
+	Documentation string
+	UserLabels    map[string]string
+}
+
+// NotificationChannel declares where alerts are sent. Channels are matched by DisplayName.
+type NotificationChannel struct {
+	DisplayName string
+	Type        string            // e.g. "email", "slack", "pubsub"
+	Labels      map[string]string // type specific, e.g. {"email_address": "oncall@example.com"}
+}
+
+// EnsureAlertPolicy creates p, or replaces the existing policy with the same display
+// name, and returns the policy's resource name
+func (c *Client) EnsureAlertPolicy(ctx context.Context, p AlertPolicy) (string, error) {
+	if p.DisplayName == "" || p.Metric == "" {
+		return "", fmt.Errorf("metrics: alert policy needs a display name and metric")
+	}
+	ac, err := monitoring.NewAlertPolicyClient(ctx, monitoringOptions(c.cfg)...)
+	if err != nil {
+		return "", fmt.Errorf("metrics: create alert policy client: %w", err)
+	}
+	defer ac.Close()
+
+	want := c.alertPolicy(p)
+	it := ac.ListAlertPolicies(ctx, &monpb.ListAlertPoliciesRequest{
+		Name:   "projects/" + c.cfg.projectID,
+		Filter: fmt.Sprintf("display_name = %q", p.DisplayName),
+	})
+	existing, err := it.Next()
+	switch {
+	case err == iterator.Done:
+		created, err := ac.CreateAlertPolicy(ctx, &monpb.CreateAlertPolicyRequest{Name: "projects/" + c.cfg.projectID, AlertPolicy: want})
+		if err != nil {
+			return "", fmt.Errorf("metrics: create alert policy %q: %w", p.DisplayName, err)
+		}
+		return created.GetName(), nil
+	case err != nil:
+		return "", fmt.Errorf("metrics: list alert policies: %w", err)
+	}
+
+	want.Name = existing.GetName()
+	updated, err := ac.UpdateAlertPolicy(ctx, &monpb.UpdateAlertPolicyRequest{AlertPolicy: want})
+	if err != nil {
+		return "", fmt.Errorf("metrics: update alert policy %q: %w", p.DisplayName, err)
+	}
+	return updated.GetName(), nil
+}
+
+// alertPolicy builds the API's policy for p
+func (c *Client) alertPolicy(p AlertPolicy) *monpb.AlertPolicy {
+	filter := c.MetricFilter(p.Metric)
+	if p.Filter != "" {
+		filter += " AND " + p.Filter
+	}
+	agg := p.Aggregation
+	if agg == nil {
+		agg = &Aggregation{Period: time.Minute, Aligner: AlignMean}
+	}
+	comparison := monpb.ComparisonType_COMPARISON_GT
+	if p.Comparison == Below {
+		comparison = monpb.ComparisonType_COMPARISON_LT
+	}
+
+	policy := &monpb.AlertPolicy{
+		DisplayName: p.DisplayName,
+		Combiner:    monpb.AlertPolicy_OR,
+		Conditions: []*monpb.AlertPolicy_Condition{{
+			DisplayName: p.DisplayName,
+			Condition: &monpb.AlertPolicy_Condition_ConditionThreshold{
+				ConditionThreshold: &monpb.AlertPolicy_Condition_MetricThreshold{
+					Filter: filter,
+					Aggregations: []*monpb.Aggregation{{
+						AlignmentPeriod:    durationpb.New(agg.Period),
+						PerSeriesAligner:   agg.Aligner,
+						CrossSeriesReducer: agg.Reducer,
+						GroupByFields:      agg.GroupBy,
+					}},
+					Comparison:     comparison,
+					ThresholdValue: p.Threshold,
+					Duration:       durationpb.New(p.Duration),
+					Trigger:        &monpb.AlertPolicy_Condition_Trigger{Type: &monpb.AlertPolicy_Condition_Trigger_Count{Count: 1}},
+				},
+			},
+		}},
+		NotificationChannels: p.NotificationChannels,
+		UserLabels:           p.UserLabels,
+	}
+	if p.Documentation != "" {
+		policy.Documentation = &monpb.AlertPolicy_Documentation{Content: p.Documentation, MimeType: "text/markdown"}
+	}
+	return policy
+}
+
+// EnsureNotificationChannel creates ch, or replaces the existing channel with the same
+// display name, and returns the channel's resource name
+func (c *Client) EnsureNotificationChannel(ctx context.Context, ch NotificationChannel) (string, error) {
+	if ch.DisplayName == "" || ch.Type == "" {
+		return "", fmt.Errorf("metrics: notification channel needs a display name and type")
+	}
+	nc, err := monitoring.NewNotificationChannelClient(ctx, monitoringOptions(c.cfg)...)
+	if err != nil {
+		return "", fmt.Errorf("metrics: create notification channel client: %w", err)
+	}
+	defer nc.Close()
+
+	want := &monpb.NotificationChannel{Type: ch.Type, DisplayName: ch.DisplayName, Labels: ch.Labels}
+	it := nc.ListNotificationChannels(ctx, &monpb.ListNotificationChannelsRequest{
+		Name:   "projects/" + c.cfg.projectID,
+		Filter: fmt.Sprintf("display_name = %q", ch.DisplayName),
+	})
+	existing, err := it.Next()
+	switch {
+	case err == iterator.Done:
+		created, err := nc.CreateNotificationChannel(ctx, &monpb.CreateNotificationChannelRequest{Name: "projects/" + c.cfg.projectID, NotificationChannel: want})
+		if err != nil {
+			return "", fmt.Errorf("metrics: create notification channel %q: %w", ch.DisplayName, err)
+		}
+		return created.GetName(), nil
+	case err != nil:
+		return "", fmt.Errorf("metrics: list notification channels: %w", err)
+	}
+
+	want.Name = existing.GetName()
+	updated, err := nc.UpdateNotificationChannel(ctx, &monpb.UpdateNotificationChannelRequest{NotificationChannel: want})
+	if err != nil {
+		return "", fmt.Errorf("metrics: update notification channel %q: %w", ch.DisplayName, err)
+	}
+	return updated.GetName(), nil
+}
@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeAlerting is an in-process alert policy and notification channel service
+type fakeAlerting struct {
+	monpb.UnimplementedAlertPolicyServiceServer
+	monpb.UnimplementedNotificationChannelServiceServer
+
+	mu       sync.Mutex
+	policies map[string]*monpb.AlertPolicy // by display name
+	channels map[string]*monpb.NotificationChannel
+	updates  int
+}
+
+func (f *fakeAlerting) ListAlertPolicies(ctx context.Context, req *monpb.ListAlertPoliciesRequest) (*monpb.ListAlertPoliciesResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &monpb.ListAlertPoliciesResponse{}
+	for name, p := range f.policies {
+		if req.GetFilter() == fmt.Sprintf("display_name = %q", name) {
+			resp.AlertPolicies = append(resp.AlertPolicies, p)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeAlerting) CreateAlertPolicy(ctx context.Context, req *monpb.CreateAlertPolicyRequest) (*monpb.AlertPolicy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := proto.Clone(req.GetAlertPolicy()).(*monpb.AlertPolicy)
+	p.Name = req.GetName() + "/alertPolicies/" + fmt.Sprint(len(f.policies)+1)
+	f.policies[p.GetDisplayName()] = p
+	return p, nil
+}
+
+func (f *fakeAlerting) UpdateAlertPolicy(ctx context.Context, req *monpb.UpdateAlertPolicyRequest) (*monpb.AlertPolicy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates++
+	p := proto.Clone(req.GetAlertPolicy()).(*monpb.AlertPolicy)
+	f.policies[p.GetDisplayName()] = p
+	return p, nil
+}
+
+func (f *fakeAlerting) ListNotificationChannels(ctx context.Context, req *monpb.ListNotificationChannelsRequest) (*monpb.ListNotificationChannelsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &monpb.ListNotificationChannelsResponse{}
+	for name, ch := range f.channels {
+		if req.GetFilter() == fmt.Sprintf("display_name = %q", name) {
+			resp.NotificationChannels = append(resp.NotificationChannels, ch)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeAlerting) CreateNotificationChannel(ctx context.Context, req *monpb.CreateNotificationChannelRequest) (*monpb.NotificationChannel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := proto.Clone(req.GetNotificationChannel()).(*monpb.NotificationChannel)
+	ch.Name = req.GetName() + "/notificationChannels/" + fmt.Sprint(len(f.channels)+1)
+	f.channels[ch.GetDisplayName()] = ch
+	return ch, nil
+}
+
+func (f *fakeAlerting) UpdateNotificationChannel(ctx context.Context, req *monpb.UpdateNotificationChannelRequest) (*monpb.NotificationChannel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates++
+	ch := proto.Clone(req.GetNotificationChannel()).(*monpb.NotificationChannel)
+	f.channels[ch.GetDisplayName()] = ch
+	return ch, nil
+}
+
+// startFakeAlerting serves a fakeAlerting on localhost and returns the options to reach it
+func startFakeAlerting(t *testing.T) (*fakeAlerting, Option) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeAlerting{policies: make(map[string]*monpb.AlertPolicy), channels: make(map[string]*monpb.NotificationChannel)}
+	srv := grpc.NewServer()
+	monpb.RegisterAlertPolicyServiceServer(srv, fake)
+	monpb.RegisterNotificationChannelServiceServer(srv, fake)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return fake, WithClientOptions(
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+}
+
+func TestEnsureAlertPolicy(t *testing.T) {
+	fake, opt := startFakeAlerting(t)
+	c, _ := newTestClient(t, opt)
+	ctx := context.Background()
+
+	channel, err := c.EnsureNotificationChannel(ctx, NotificationChannel{DisplayName: "oncall", Type: "email", Labels: map[string]string{"email_address": "oncall@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := AlertPolicy{
+		DisplayName:          "queue backlog",
+		Metric:               "queue/depth",
+		Filter:               `metric.label.region = "eu"`,
+		Comparison:           Below,
+		Threshold:            100,
+		Duration:             5 * time.Minute,
+		NotificationChannels: []string{channel},
+		Documentation:        "Drain the queue.",
+	}
+	first, err := c.EnsureAlertPolicy(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Threshold = 200
+	second, err := c.EnsureAlertPolicy(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || len(fake.policies) != 1 || fake.updates != 1 {
+		t.Fatalf("policies %q and %q, %d stored with %d updates, want one policy updated in place", first, second, len(fake.policies), fake.updates)
+	}
+
+	cond := fake.policies["queue backlog"].GetConditions()[0].GetConditionThreshold()
+	if want := `metric.type = "custom.googleapis.com/queue/depth" AND metric.label.region = "eu"`; cond.GetFilter() != want {
+		t.Errorf("filter %q, want %q", cond.GetFilter(), want)
+	}
+	if cond.GetComparison() != monpb.ComparisonType_COMPARISON_LT || cond.GetThresholdValue() != 200 || cond.GetDuration().AsDuration() != 5*time.Minute {
+		t.Errorf("condition %v", cond)
+	}
+	if agg := cond.GetAggregations()[0]; agg.GetPerSeriesAligner() != AlignMean || agg.GetAlignmentPeriod().AsDuration() != time.Minute {
+		t.Errorf("default aggregation %v", agg)
+	}
+	if got := fake.policies["queue backlog"].GetNotificationChannels(); len(got) != 1 || got[0] != channel {
+		t.Errorf("notification channels %v, want %s", got, channel)
+	}
+
+	if _, err := c.EnsureAlertPolicy(ctx, AlertPolicy{DisplayName: "no metric"}); err == nil {
+		t.Error("policy without a metric accepted")
+	}
+}
@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/compute/metadata"
+	gcprpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// Autoscaling on custom metrics
+//
+// The GKE Horizontal Pod Autoscaler reads Cloud Monitoring metrics through the
+// Custom Metrics Stackdriver Adapter. It can consume a metric in two ways, and the
+// metric must be written against the right monitored resource for each:
+//
+// PerPod metrics are averaged over the pods a Deployment owns, e.g. the queue each
+// pod is working through. They must be written against the k8s_pod resource so the
+// adapter can match points to pods, and are referenced from the HPA as a Pods metric:
+//
+//	metrics:
+//	- type: Pods
+//	  pods:
+//	    metric:
+//	      name: custom.googleapis.com|worker|queue_depth
+//	    target:
+//	      type: AverageValue
+//	      averageValue: "30"
+//
+// PerService metrics describe the service as a whole, e.g. the backlog of a shared
+// Pub/Sub subscription. They are written against the global resource and are
+// referenced as an External metric, selecting the series by label if needed:
+//
+//	metrics:
+//	- type: External
+//	  external:
+//	    metric:
+//	      name: custom.googleapis.com|checkout|backlog
+//	      selector:
+//	        matchLabels:
+//	          metric.labels.function_name: checkout
+//	    target:
+//	      type: AverageValue
+//	      averageValue: "100"
+//
+// In both cases the metric path separators become "|" in the HPA spec, and the
+// metric must be a GAUGE, which AutoscalingMetric always writes.
+//
+// Cloud Run's autoscaler does not read custom metrics, it scales on request
+// concurrency and CPU. PerService metrics can still drive Cloud Run indirectly
+// through an external controller that adjusts min or max instances.
+//
+// For PerPod metrics the pod is identified from the environment, which the
+// Deployment should populate with the downward API:
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom: {fieldRef: {fieldPath: metadata.name}}
+//	- name: POD_NAMESPACE
+//	  valueFrom: {fieldRef: {fieldPath: metadata.namespace}}
+//
+// CLUSTER_NAME and CLUSTER_LOCATION may be set too, otherwise they are read from
+// the GKE metadata server.
+
+// ScalingScope says how an autoscaler aggregates a metric
+type ScalingScope int
+
+const (
+	// PerPod metrics are averaged across the pods of a workload
+	PerPod ScalingScope = iota
+	// PerService metrics describe the whole service
+	PerService
+)
+
+// AutoscalingMetric is a gauge written so the HPA's custom metrics adapter can read it
+type AutoscalingMetric struct {
+	client   *Client
+	name     string
+	labels   map[string]string
+	resource *gcprpb.MonitoredResource
+}
+
+// NewAutoscalingMetric returns a gauge for metricName written with the resource scope needs.
+// For PerPod it fails if the pod can't be identified from the environment.
+func (c *Client) NewAutoscalingMetric(ctx context.Context, metricName string, scope ScalingScope, labels map[string]string) (*AutoscalingMetric, error) {
+	if err := c.declareGauge(metricName, labels); err != nil {
+		return nil, err
+	}
+	m := &AutoscalingMetric{client: c, name: metricName, labels: labels}
+	if scope == PerPod {
+		res, err := podResource(ctx, c.cfg.projectID)
+		if err != nil {
+			return nil, err
+		}
+		m.resource = res
+	}
+	return m, nil
+}
+
+// Set records the current value of the metric
+func (m *AutoscalingMetric) Set(ctx context.Context, value float64) {
+	if !m.client.spendBudget(ctx, m.name, 1) {
+		return
+	}
+	if ts, err := m.client.gaugeSeries(m.resource, m.name, value, m.client.withContextLabels(ctx, m.labels)); err == nil {
+		m.client.emit(ctx, []*monpb.TimeSeries{ts})
+	}
+}
+
+// podResource describes the k8s_pod this process runs in
+func podResource(ctx context.Context, projectID string) (*gcprpb.MonitoredResource, error) {
+	pod := os.Getenv("POD_NAME")
+	if pod == "" {
+		pod, _ = os.Hostname() // pods' hostnames are their names unless overridden
+	}
+	namespace := os.Getenv("POD_NAMESPACE")
+	cluster := envOrMetadata(ctx, "CLUSTER_NAME", "cluster-name")
+	location := envOrMetadata(ctx, "CLUSTER_LOCATION", "cluster-location")
+
+	var missing []string
+	for name, v := range map[string]string{"POD_NAME": pod, "POD_NAMESPACE": namespace, "CLUSTER_NAME": cluster, "CLUSTER_LOCATION": location} {
+		if v == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("metrics: cannot identify k8s_pod for per-pod metric, set %s", strings.Join(missing, ", "))
+	}
+
+	return &gcprpb.MonitoredResource{
+		Type: "k8s_pod",
+		Labels: map[string]string{
+			"project_id":     projectID,
+			"location":       location,
+			"cluster_name":   cluster,
+			"namespace_name": namespace,
+			"pod_name":       pod,
+		},
+	}, nil
+}
+
+// envOrMetadata reads env, falling back to the instance attribute on the metadata server
+func envOrMetadata(ctx context.Context, env, attr string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	if !metadata.OnGCE() {
+		return ""
+	}
+	v, err := metadata.InstanceAttributeValueWithContext(ctx, attr)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(v)
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BigQueryConfig configures the BigQuery exporter. The table must exist with this schema:
+//
+//	CREATE TABLE dataset.metrics (
+//	  time TIMESTAMP NOT NULL,
+//	  start_time TIMESTAMP,
+//	  metric STRING NOT NULL,
+//	  kind STRING,
+//	  labels ARRAY<STRUCT<key STRING, value STRING>>,
+//	  resource_type STRING,
+//	  resource_labels ARRAY<STRUCT<key STRING, value STRING>>,
+//	  value FLOAT64,
+//	  distribution_count INT64,
+//	  distribution_mean FLOAT64
+//	) PARTITION BY DATE(time);
+type BigQueryConfig struct {
+	ProjectID string // project of the dataset, defaults to the Client's project
+	Dataset   string
+	Table     string
+}
+
+// WithBigQuery appends every point to a BigQuery table as well as exporting it as usual,
+// keeping history past Cloud Monitoring's retention for SQL analysis. To write only to
+// BigQuery, pass NewBigQueryExporter to WithExporter instead. Insert failures are
+// reported as for WithPubSub.
+func WithBigQuery(cfg BigQueryConfig) Option {
+	return func(c *config) {
+		c.bigquery = &cfg
+	}
+}
+
+// bigqueryExporter writes points with streaming inserts
+type bigqueryExporter struct {
+	cfg     BigQueryConfig
+	service *bigquery.Service
+}
+
+// NewBigQueryExporter returns an Exporter that appends one row per point to a BigQuery
+// table with streaming inserts. Rows carry an insert ID derived from the series and
+// point time, so BigQuery drops most rows a retried batch sends twice. Numbers and
+// bools are stored in value; distributions in distribution_count and distribution_mean.
+func NewBigQueryExporter(ctx context.Context, cfg BigQueryConfig) (Exporter, error) {
+	if cfg.Dataset == "" || cfg.Table == "" {
+		return nil, fmt.Errorf("metrics: bigquery exporter needs a dataset and table")
+	}
+	if cfg.ProjectID == "" {
+		cfg.ProjectID = getProjectID()
+	}
+	svc, err := bigquery.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: create bigquery client: %w", err)
+	}
+	return &bigqueryExporter{cfg: cfg, service: svc}, nil
+}
+
+func (e *bigqueryExporter) Export(ctx context.Context, series []*monpb.TimeSeries) error {
+	req := &bigquery.TableDataInsertAllRequest{}
+	for _, ts := range series {
+		for _, p := range ts.GetPoints() {
+			req.Rows = append(req.Rows, bigqueryRow(ts, p))
+		}
+	}
+	if len(req.Rows) == 0 {
+		return nil
+	}
+
+	resp, err := e.service.Tabledata.InsertAll(e.cfg.ProjectID, e.cfg.Dataset, e.cfg.Table, req).Context(ctx).Do()
+	if err != nil {
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) {
+			return status.Error(httpCode(gerr.Code), "metrics: bigquery insert: "+gerr.Message)
+		}
+		return status.Error(codes.Unavailable, "metrics: bigquery insert: "+err.Error())
+	}
+	if len(resp.InsertErrors) > 0 {
+		first := resp.InsertErrors[0]
+		msg := "unknown error"
+		if len(first.Errors) > 0 {
+			msg = first.Errors[0].Message
+		}
+		return status.Errorf(codes.InvalidArgument, "metrics: bigquery rejected %d of %d rows, row %d: %s", len(resp.InsertErrors), len(req.Rows), first.Index, msg)
+	}
+	return nil
+}
+
+func (e *bigqueryExporter) Close() error {
+	return nil
+}
+
+// bigqueryRow converts one point into a row
+func bigqueryRow(ts *monpb.TimeSeries, p *monpb.Point) *bigquery.TableDataInsertAllRequestRows {
+	end := p.GetInterval().GetEndTime().AsTime()
+	row := map[string]bigquery.JsonValue{
+		"time":            end.Format(time.RFC3339Nano),
+		"metric":          ts.GetMetric().GetType(),
+		"kind":            ts.GetMetricKind().String(),
+		"labels":          bigqueryLabels(ts.GetMetric().GetLabels()),
+		"resource_type":   ts.GetResource().GetType(),
+		"resource_labels": bigqueryLabels(ts.GetResource().GetLabels()),
+	}
+	if st := p.GetInterval().GetStartTime(); st != nil {
+		row["start_time"] = st.AsTime().Format(time.RFC3339Nano)
+	}
+	switch v := p.GetValue().GetValue().(type) {
+	case *monpb.TypedValue_Int64Value:
+		row["value"] = float64(v.Int64Value)
+	case *monpb.TypedValue_DoubleValue:
+		row["value"] = v.DoubleValue
+	case *monpb.TypedValue_BoolValue:
+		row["value"] = 0.0
+		if v.BoolValue {
+			row["value"] = 1.0
+		}
+	case *monpb.TypedValue_DistributionValue:
+		row["distribution_count"] = v.DistributionValue.GetCount()
+		row["distribution_mean"] = v.DistributionValue.GetMean()
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(seriesIdentity(ts)))
+	h.Write([]byte(strconv.FormatInt(end.UnixNano(), 10)))
+	return &bigquery.TableDataInsertAllRequestRows{InsertId: strconv.FormatUint(h.Sum64(), 16), Json: row}
+}
+
+// bigqueryLabels converts labels to a repeated key/value record, sorted by key
+func bigqueryLabels(labels map[string]string) []map[string]string {
+	out := make([]map[string]string, 0, len(labels))
+	for _, k := range sortedKeys(labels) {
+		out = append(out, map[string]string{"key": k, "value": labels[k]})
+	}
+	return out
+}
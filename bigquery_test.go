@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBigQueryRow(t *testing.T) {
+	ts := gaugePoint("custom.googleapis.com/orders", map[string]string{"region": "eu", "app": "shop"}, 2.5)
+	row := bigqueryRow(ts, ts.GetPoints()[0])
+	if row.Json["metric"] != "custom.googleapis.com/orders" || row.Json["value"] != 2.5 {
+		t.Errorf("row = %v", row.Json)
+	}
+	labels := row.Json["labels"].([]map[string]string)
+	if len(labels) != 2 || labels[0]["key"] != "app" || labels[1]["value"] != "eu" {
+		t.Errorf("labels = %v, want sorted by key", labels)
+	}
+
+	again := bigqueryRow(ts, ts.GetPoints()[0])
+	other := bigqueryRow(gaugePoint("custom.googleapis.com/orders", map[string]string{"region": "us"}, 2.5), ts.GetPoints()[0])
+	if row.InsertId != again.InsertId || row.InsertId == other.InsertId {
+		t.Errorf("insert IDs %s, %s and %s, want the same point to repeat its ID", row.InsertId, again.InsertId, other.InsertId)
+	}
+}
+
+func TestBigQueryExport(t *testing.T) {
+	var rows int
+	reject := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/projects/p/datasets/d/tables/t/insertAll") {
+			http.NotFound(w, r)
+			return
+		}
+		var req bigquery.TableDataInsertAllRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		rows += len(req.Rows)
+		resp := bigquery.TableDataInsertAllResponse{}
+		if reject {
+			resp.InsertErrors = []*bigquery.TableDataInsertAllResponseInsertErrors{{Index: 0, Errors: []*bigquery.ErrorProto{{Message: "no such field"}}}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	svc, err := bigquery.NewService(context.Background(), option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &bigqueryExporter{cfg: BigQueryConfig{ProjectID: "p", Dataset: "d", Table: "t"}, service: svc}
+	ts := gaugePoint("custom.googleapis.com/orders", nil, 1)
+	if err := e.Export(context.Background(), []*monpb.TimeSeries{ts, ts}); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 2 {
+		t.Errorf("inserted %d rows, want 2", rows)
+	}
+
+	reject = true
+	if err := e.Export(context.Background(), []*monpb.TimeSeries{ts}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("rejected rows = %v, want InvalidArgument", err)
+	}
+}
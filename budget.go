@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type budgetKey struct{}
+
+// requestBudget counts the observations recorded under one request context
+type requestBudget struct {
+	max    int64
+	used   atomic.Int64
+	warned atomic.Bool
+}
+
+// ContextWithBudget returns a context that allows at most max observations to be recorded
+// with it and any context derived from it. Observations beyond the cap are dropped and
+// logged once, protecting against instrumentation bugs that record in a loop.
+// Typically called by middleware at the start of each request.
+func ContextWithBudget(ctx context.Context, max int) context.Context {
+	return context.WithValue(ctx, budgetKey{}, &requestBudget{max: int64(max)})
+}
+
+// spendBudget charges n observations to the request budget in ctx, if any, and reports
+// whether they fit
+func (c *Client) spendBudget(ctx context.Context, metricName string, n int) bool {
+	b, _ := ctx.Value(budgetKey{}).(*requestBudget)
+	if b == nil {
+		return true
+	}
+	if b.used.Add(int64(n)) <= b.max {
+		return true
+	}
+	if !b.warned.Swap(true) {
+		c.logger.Warn("request metric budget exceeded, dropping further observations", "metric", metricName, "budget", b.max)
+	}
+	return false
+}
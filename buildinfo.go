@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// buildInfoMetric is the metric PublishBuildInfo publishes, always 1
+const buildInfoMetric = "build/info"
+
+// PublishBuildInfo publishes a constant gauge of 1 labelled with the build's version,
+// commit and build date, plus the Go version, so dashboards can overlay deploys on other
+// metrics. Empty arguments are filled from the VCS stamp Go embeds in the binary where
+// available. The point is written immediately and again on every flush, so the series
+// stays visible for as long as the process runs. Calling it again for the same build does
+// nothing, a different build replaces the earlier series.
+func (c *Client) PublishBuildInfo(version, commit, buildDate string) {
+	labels := buildInfoLabels(version, commit, buildDate)
+	key := seriesKey(labels)
+	c.buildInfoMu.Lock()
+	defer c.buildInfoMu.Unlock()
+	if c.buildInfo == key {
+		return
+	}
+	if c.stopBuildInfo != nil {
+		c.stopBuildInfo()
+	}
+	c.stopBuildInfo = c.RegisterGaugeFunc(buildInfoMetric, labels, func() float64 { return 1 })
+	c.buildInfo = key
+
+	// Don't wait for the first flush, a deploy should show up right away
+	if ts, err := c.gaugeSeries(nil, buildInfoMetric, 1, labels); err == nil {
+		c.emit(context.Background(), []*monpb.TimeSeries{ts})
+	}
+}
+
+// buildInfoLabels returns the build info labels, falling back to the embedded build info
+func buildInfoLabels(version, commit, buildDate string) map[string]string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if version == "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && commit == "":
+				commit = s.Value
+			case s.Key == "vcs.time" && buildDate == "":
+				buildDate = s.Value
+			}
+		}
+	}
+	labels := map[string]string{
+		"version":    version,
+		"commit":     commit,
+		"build_date": buildDate,
+		"go_version": runtime.Version(),
+	}
+	for k, v := range labels {
+		if v == "" {
+			labels[k] = "unknown"
+		}
+	}
+	return labels
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPublishBuildInfoIsIdempotent(t *testing.T) {
+	c, exp := newTestClient(t)
+	c.PublishBuildInfo("v1.2.0", "abc123", "")
+	c.PublishBuildInfo("v1.2.0", "abc123", "")
+	const typ = "custom.googleapis.com/" + buildInfoMetric
+	if n := len(exp.byType(typ)); n != 1 {
+		t.Fatalf("exported %d build info points on publish, want 1", n)
+	}
+
+	exp.mu.Lock()
+	exp.series = nil
+	exp.mu.Unlock()
+	c.Flush(context.Background())
+	got := exp.byType(typ)
+	if len(got) != 1 {
+		t.Fatalf("flush exported %d build info points, want 1", len(got))
+	}
+	labels := got[0].GetMetric().GetLabels()
+	if labels["version"] != "v1.2.0" || labels["commit"] != "abc123" || labels["build_date"] == "" || labels["go_version"] == "" {
+		t.Errorf("labels = %v", labels)
+	}
+
+	// A new build replaces the old series
+	c.PublishBuildInfo("v1.3.0", "def456", "")
+	exp.mu.Lock()
+	exp.series = nil
+	exp.mu.Unlock()
+	c.Flush(context.Background())
+	if got := exp.byType(typ); len(got) != 1 || got[0].GetMetric().GetLabels()["version"] != "v1.3.0" {
+		t.Errorf("flush exported %v, want only the new build", got)
+	}
+}
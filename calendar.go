@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// CalendarPeriod is the length of a calendar window
+type CalendarPeriod int
+
+const (
+	// Daily windows run from midnight to midnight
+	Daily CalendarPeriod = iota
+	// Weekly windows start at midnight on Monday
+	Weekly
+	// Monthly windows start at midnight on the first of the month
+	Monthly
+)
+
+// CalendarSum totals values over calendar windows in a fixed time zone, such as
+// revenue per finance reporting day. Windows follow the zone's wall clock, so a day
+// containing a DST change is 23 or 25 hours long.
+//
+// Each label set is a CUMULATIVE DOUBLE series whose start time is the start of the
+// current window. The running total is published on every flush, and once a window
+// ends its final total is published with the window's end as the point's end time,
+// so the value at each window boundary is the total for that day, week or month.
+type CalendarSum struct {
+	client *Client
+	name   string
+	period CalendarPeriod
+	loc    *time.Location
+
+	mu     sync.Mutex
+	series map[string]*calendarSeries
+	closed []*monpb.TimeSeries // final points of windows closed since the last flush
+}
+
+// calendarSeries is the running state of one label set
+type calendarSeries struct {
+	labels       map[string]string
+	windowStart  time.Time
+	windowEnd    time.Time
+	start        time.Time // of the published interval, after the previous window's last point
+	total        float64
+	lastEnd      time.Time
+	finalPending bool // the final point of a window is waiting in closed
+}
+
+// NewCalendarSum returns a CalendarSum for metricName with windows in timeZone, an
+// IANA name such as "Europe/London". An empty timeZone means UTC.
+func (c *Client) NewCalendarSum(metricName string, period CalendarPeriod, timeZone string) (*CalendarSum, error) {
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: calendar window time zone: %w", err)
+	}
+	cs := &CalendarSum{client: c, name: metricName, period: period, loc: loc, series: make(map[string]*calendarSeries)}
+	if c == nil {
+		return cs, nil // metrics disabled
+	}
+	existing, err := c.claim(metricName, KindCalendarSum)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		prev := existing.(*CalendarSum)
+		if prev.period != period || prev.loc.String() != loc.String() {
+			return nil, fmt.Errorf("%w: calendar sum %q already uses other windows", ErrMetricConflict, metricName)
+		}
+		return prev, nil
+	}
+	c.remember(metricName, cs, nil)
+	c.register(cs)
+	return cs, nil
+}
+
+// Add adds v to the current window's total for labels
+func (cs *CalendarSum) Add(ctx context.Context, v float64, labels map[string]string) {
+	if cs.client == nil { // metrics disabled
+		return
+	}
+	weight, ok := cs.client.sample(cs.name)
+	if !ok || !cs.client.spendBudget(ctx, cs.name, 1) || !cs.client.checkLabels(cs.name, labels) {
+		return
+	}
+	v *= weight
+	prepared := cs.client.prepareLabels(cs.name, cs.client.withContextLabels(ctx, labels))
+	key := seriesKey(prepared)
+	now := time.Now()
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	s := cs.series[key]
+	if s == nil {
+		admitted, ok := cs.client.cardinality.admit(cs.name, prepared)
+		if !ok {
+			return
+		}
+		// A collapsed label set may already have a series of its own
+		key = seriesKey(admitted)
+		if s = cs.series[key]; s == nil {
+			s = &calendarSeries{labels: admitted}
+			s.windowStart, s.windowEnd = cs.period.window(now, cs.loc)
+			s.start = pointTime(s.windowStart)
+			cs.series[key] = s
+		}
+	}
+	if cs.client.duplicate(ctx, cs.name) {
+		return
+	}
+	cs.roll(s, now)
+	s.total += v
+}
+
+// roll closes the window of s if it ended before now, queueing its final point and
+// moving s to the window containing now. Callers hold mu.
+func (cs *CalendarSum) roll(s *calendarSeries, now time.Time) bool {
+	if now.Before(s.windowEnd) {
+		return false
+	}
+	end := cumulativeEnd(s.start, s.windowEnd)
+	cs.closed = append(cs.closed, cs.point(s, end))
+	s.lastEnd = end
+	s.finalPending = true
+
+	s.windowStart, s.windowEnd = cs.period.window(now, cs.loc)
+	s.start = pointTime(s.windowStart)
+	if !s.start.After(s.lastEnd) {
+		s.start = s.lastEnd.Add(time.Microsecond)
+	}
+	s.total = 0
+	return true
+}
+
+// point builds the series for the total of s up to end
+func (cs *CalendarSum) point(s *calendarSeries, end time.Time) *monpb.TimeSeries {
+	c := cs.client
+	return c.cumulativeSeries(c.metricType(cs.name), nil, s.labels, s.start, end, &monpb.TypedValue{
+		Value: &monpb.TypedValue_DoubleValue{DoubleValue: s.total},
+	})
+}
+
+// collect publishes the final points of closed windows and the running totals of open ones.
+// A series whose window just closed publishes only its final point, since one request
+// can't hold two points for the same series.
+func (cs *CalendarSum) collect(c *Client, now time.Time) []*monpb.TimeSeries {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	var running []*monpb.TimeSeries
+	for _, s := range cs.series {
+		if cs.roll(s, now) || s.finalPending {
+			s.finalPending = false
+			continue
+		}
+		end := cumulativeEnd(s.start, now)
+		s.lastEnd = end
+		running = append(running, cs.point(s, end))
+	}
+	out := append(cs.closed, running...)
+	cs.closed = nil
+	return out
+}
+
+// window returns the bounds of the period containing t, in loc
+func (p CalendarPeriod) window(t time.Time, loc *time.Location) (start, end time.Time) {
+	t = t.In(loc)
+	y, m, d := t.Date()
+	switch p {
+	case Weekly:
+		d -= (int(t.Weekday()) + 6) % 7 // back to Monday
+		return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+7, 0, 0, 0, 0, loc)
+	case Monthly:
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc), time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+}
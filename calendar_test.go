@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCalendarWindows(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := time.Date(2024, 3, 31, 12, 0, 0, 0, london) // a Sunday, clocks went forward at 1am
+	tests := []struct {
+		period     CalendarPeriod
+		start, end time.Time
+	}{
+		{Daily, time.Date(2024, 3, 31, 0, 0, 0, 0, london), time.Date(2024, 4, 1, 0, 0, 0, 0, london)},
+		{Weekly, time.Date(2024, 3, 25, 0, 0, 0, 0, london), time.Date(2024, 4, 1, 0, 0, 0, 0, london)},
+		{Monthly, time.Date(2024, 3, 1, 0, 0, 0, 0, london), time.Date(2024, 4, 1, 0, 0, 0, 0, london)},
+	}
+	for _, tt := range tests {
+		start, end := tt.period.window(at.UTC(), london)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("period %d: window = [%v, %v), want [%v, %v)", tt.period, start, end, tt.start, tt.end)
+		}
+	}
+	if start, end := Daily.window(at, london); end.Sub(start) != 23*time.Hour {
+		t.Errorf("DST day lasts %v, want 23h", end.Sub(start))
+	}
+}
+
+func TestCalendarSumClosesWindows(t *testing.T) {
+	c, _ := newTestClient(t)
+	cs, err := c.NewCalendarSum("revenue", Daily, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	cs.Add(ctx, 20, nil)
+	cs.Add(ctx, 5, nil)
+
+	_, end := Daily.window(time.Now(), time.UTC)
+	next := end.Add(time.Hour)
+	got := cs.collect(c, next)
+	if len(got) != 1 {
+		t.Fatalf("published %d points when the window closed, want the final one", len(got))
+	}
+	p := got[0].GetPoints()[0]
+	if p.GetValue().GetDoubleValue() != 25 || !p.GetInterval().GetEndTime().AsTime().Equal(end) {
+		t.Errorf("final point %v at %v, want 25 at %v", p.GetValue(), p.GetInterval().GetEndTime().AsTime(), end)
+	}
+
+	got = cs.collect(c, next.Add(time.Minute))
+	if len(got) != 1 || got[0].GetPoints()[0].GetValue().GetDoubleValue() != 0 {
+		t.Fatalf("running total after the window closed = %v, want 0", got)
+	}
+	if start := got[0].GetPoints()[0].GetInterval().GetStartTime().AsTime(); !start.After(end) {
+		t.Errorf("new window starts at %v, want after %v", start, end)
+	}
+}
+
+func TestNewCalendarSumConflict(t *testing.T) {
+	c, _ := newTestClient(t)
+	if _, err := c.NewCalendarSum("revenue", Daily, "UTC"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.NewCalendarSum("revenue", Weekly, "UTC"); err == nil {
+		t.Error("second calendar sum with other windows accepted")
+	}
+	if _, err := c.NewCalendarSum("other", Daily, "Nowhere/Special"); err == nil {
+		t.Error("unknown time zone accepted")
+	}
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OverflowLabelValue replaces the offending label's value when a series is collapsed
+const OverflowLabelValue = "overflow"
+
+// OverflowPolicy decides what happens to a new series once a metric has reached its cardinality limit
+type OverflowPolicy int
+
+const (
+	// OverflowDrop discards points for series beyond the limit
+	OverflowDrop OverflowPolicy = iota
+	// OverflowCollapse rewrites labels to OverflowLabelValue, the one with the most distinct
+	// values first, folding new series into existing ones or a single overflow series
+	OverflowCollapse
+)
+
+// CardinalityLimit caps the number of distinct label sets recorded for a metric
+type CardinalityLimit struct {
+	MaxSeries int
+	Policy    OverflowPolicy
+	// OnOverflow, if set, is called with the original labels of every series that hits the limit
+	OnOverflow func(metricName string, labels map[string]string)
+}
+
+// WithCardinalityLimit sets the cardinality limit for a single metric
+func WithCardinalityLimit(metricName string, limit CardinalityLimit) Option {
+	return func(c *config) {
+		if c.cardinalityLimits == nil {
+			c.cardinalityLimits = make(map[string]CardinalityLimit)
+		}
+		c.cardinalityLimits[metricName] = limit
+	}
+}
+
+// WithDefaultCardinalityLimit sets the cardinality limit for metrics without their own limit
+func WithDefaultCardinalityLimit(limit CardinalityLimit) Option {
+	return func(c *config) {
+		c.defaultCardinality = &limit
+	}
+}
+
+// cardinalityGuard tracks the distinct label sets seen per metric
+type cardinalityGuard struct {
+	limits   map[string]CardinalityLimit
+	fallback *CardinalityLimit
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	metrics map[string]*seriesSet
+}
+
+// seriesSet is the set of label sets admitted for one metric
+type seriesSet struct {
+	seen   map[string]struct{}
+	values map[string]map[string]struct{} // label key -> distinct values among admitted series
+}
+
+func newCardinalityGuard(limits map[string]CardinalityLimit, fallback *CardinalityLimit, logger *slog.Logger) *cardinalityGuard {
+	return &cardinalityGuard{
+		limits:   limits,
+		fallback: fallback,
+		logger:   logger,
+		metrics:  make(map[string]*seriesSet),
+	}
+}
+
+// limitFor returns the limit configured for metricName, if any
+func (g *cardinalityGuard) limitFor(metricName string) (CardinalityLimit, bool) {
+	if l, ok := g.limits[metricName]; ok {
+		return l, l.MaxSeries > 0
+	}
+	if g.fallback != nil {
+		return *g.fallback, g.fallback.MaxSeries > 0
+	}
+	return CardinalityLimit{}, false
+}
+
+// admit returns the labels to record for metricName, or false if the point should be dropped
+func (g *cardinalityGuard) admit(metricName string, labels map[string]string) (map[string]string, bool) {
+	limit, ok := g.limitFor(metricName)
+	if !ok {
+		return labels, true
+	}
+
+	key := seriesKey(labels)
+
+	g.mu.Lock()
+	set := g.metrics[metricName]
+	if set == nil {
+		set = &seriesSet{seen: make(map[string]struct{}), values: make(map[string]map[string]struct{})}
+		g.metrics[metricName] = set
+	}
+	if _, seen := set.seen[key]; seen {
+		g.mu.Unlock()
+		return labels, true
+	}
+	if len(set.seen) < limit.MaxSeries {
+		set.add(key, labels)
+		g.mu.Unlock()
+		return labels, true
+	}
+
+	var collapsed map[string]string
+	if limit.Policy == OverflowCollapse {
+		collapsed = set.collapse(labels)
+	}
+	g.mu.Unlock()
+
+	if limit.OnOverflow != nil {
+		limit.OnOverflow(metricName, labels)
+	}
+	if collapsed == nil {
+		g.logger.Warn("cardinality limit reached, dropping new series", "metric", metricName, "max_series", limit.MaxSeries)
+		return nil, false
+	}
+	return collapsed, true
+}
+
+func (s *seriesSet) add(key string, labels map[string]string) {
+	s.seen[key] = struct{}{}
+	for k, v := range labels {
+		vals := s.values[k]
+		if vals == nil {
+			vals = make(map[string]struct{})
+			s.values[k] = vals
+		}
+		vals[v] = struct{}{}
+	}
+}
+
+// collapse rewrites labels to OverflowLabelValue, those with the most distinct values
+// first, until the result is a series already admitted. If none matches, every label but
+// function_name is collapsed, giving the one overflow series per metric that is admitted
+// past the limit.
+func (s *seriesSet) collapse(labels map[string]string) map[string]string {
+	keys := make([]string, 0, len(labels))
+	for _, k := range sortedKeys(labels) {
+		if k != "function_name" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return len(s.values[keys[i]]) > len(s.values[keys[j]]) })
+
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	for _, k := range keys {
+		out[k] = OverflowLabelValue
+		if _, seen := s.seen[seriesKey(out)]; seen {
+			return out
+		}
+	}
+	s.seen[seriesKey(out)] = struct{}{}
+	return out
+}
+
+// seriesKey returns a stable string identifying a label set
+func seriesKey(labels map[string]string) string {
+	var b strings.Builder
+	for _, k := range sortedKeys(labels) {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCardinalityDrop(t *testing.T) {
+	var overflowed int
+	g := newCardinalityGuard(map[string]CardinalityLimit{
+		"m": {MaxSeries: 2, OnOverflow: func(string, map[string]string) { overflowed++ }},
+	}, nil, discardLogger)
+
+	for i := 0; i < 5; i++ {
+		_, ok := g.admit("m", map[string]string{"user": fmt.Sprint(i)})
+		if want := i < 2; ok != want {
+			t.Errorf("series %d admitted = %v, want %v", i, ok, want)
+		}
+	}
+	if _, ok := g.admit("m", map[string]string{"user": "0"}); !ok {
+		t.Error("admitted series dropped after the limit was reached")
+	}
+	if overflowed != 3 {
+		t.Errorf("OnOverflow called %d times, want 3", overflowed)
+	}
+	if _, ok := g.admit("other", map[string]string{"user": "x"}); !ok {
+		t.Error("metric without a limit was dropped")
+	}
+}
+
+func TestCardinalityCollapseStaysBounded(t *testing.T) {
+	const limit = 3
+	g := newCardinalityGuard(nil, &CardinalityLimit{MaxSeries: limit, Policy: OverflowCollapse}, discardLogger)
+
+	distinct := make(map[string]struct{})
+	for i := 0; i < 100; i++ {
+		labels := map[string]string{
+			"function_name": "f",
+			"user":          fmt.Sprint("u", i),
+			"session":       fmt.Sprint("s", i%17),
+		}
+		got, ok := g.admit("m", labels)
+		if !ok {
+			t.Fatalf("point %d dropped under the collapse policy", i)
+		}
+		if got["function_name"] != "f" {
+			t.Fatalf("function_name collapsed: %v", got)
+		}
+		distinct[seriesKey(got)] = struct{}{}
+	}
+	if len(distinct) > limit+1 {
+		t.Errorf("%d distinct series recorded, want at most %d", len(distinct), limit+1)
+	}
+}
+
+func TestCardinalityCollapseReusesExistingSeries(t *testing.T) {
+	g := newCardinalityGuard(map[string]CardinalityLimit{"m": {MaxSeries: 2, Policy: OverflowCollapse}}, nil, discardLogger)
+	g.admit("m", map[string]string{"user": "a", "region": "eu"})
+	g.admit("m", map[string]string{"user": "b", "region": "eu"})
+
+	// user has the most values, collapsing it alone is a new series, so region goes too
+	got, _ := g.admit("m", map[string]string{"user": "c", "region": "us"})
+	want := map[string]string{"user": OverflowLabelValue, "region": OverflowLabelValue}
+	if seriesKey(got) != seriesKey(want) {
+		t.Errorf("collapsed to %v, want %v", got, want)
+	}
+	// Once the overflow series exists, further series fold into it
+	got, _ = g.admit("m", map[string]string{"user": "d", "region": "ap"})
+	if seriesKey(got) != seriesKey(want) {
+		t.Errorf("collapsed to %v, want %v", got, want)
+	}
+}
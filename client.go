@@ -0,0 +1,371 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/option"
+	gcprpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Client publishes custom metrics to Google Cloud Monitoring
+type Client struct {
+	cfg         config
+	logger      *slog.Logger
+	failLog     *slog.Logger // for export failures, silent when they are aggregated instead
+	errors      *errorAggregator
+	exporter    Exporter
+	tracer      trace.Tracer
+	samplers    map[string]*sampler
+	registry    *registry
+	interned    *interner
+	global      *gcprpb.MonitoredResource // shared by every series on the global resource, must not be modified
+	recycle     bool                      // whether exported series go back to the pools
+	cardinality *cardinalityGuard
+	wal         *wal
+	spool       *spool
+	dedup       *dedup // nil unless WithDeduplication is set
+	stats       selfStats
+
+	buffer         *pointBuffer // nil unless a flush interval is set
+	flushMu        sync.Mutex
+	flusherOnce    sync.Once
+	flusherRunning bool
+	stopFlush      chan struct{}
+	flushDone      chan struct{}
+	lastFlush      atomic.Int64 // unix nanoseconds, for DebugHandler
+
+	inflight tracker // detached exports
+	health   exportHealth
+	pool     *exportPool // nil unless WithExportWorkers is set
+
+	priorityOf map[string]Priority // by metric type
+	classes    map[Priority]*priorityClass
+	classLoops sync.WaitGroup
+
+	closeOnce sync.Once
+	closed    chan struct{} // closed by Close, stops background goroutines
+
+	collectMu     sync.Mutex
+	collectors    map[uint64]collector
+	nextCollector uint64
+
+	buildInfoMu   sync.Mutex
+	buildInfo     string // series key of the labels PublishBuildInfo published
+	stopBuildInfo func()
+
+	defaultLabels atomic.Pointer[map[string]string]
+	units         sync.Map // metric type to declared unit
+	disabled      atomic.Bool
+	filter        atomic.Pointer[metricFilter]
+
+	readerMu      sync.Mutex
+	readerConn    *monitoring.MetricClient // for QueryTimeSeries, opened on first use
+	readerRelease func() error
+}
+
+// config holds the settings applied by Options
+type config struct {
+	projectID    string
+	functionName string
+	namespace    string
+	logger       *slog.Logger
+
+	dedicatedConn   bool
+	endpoint        string
+	clientOptions   []option.ClientOption
+	credentialsFile string
+	credentialsJSON []byte
+	metricClient    *monitoring.MetricClient
+	declaredLabels  func(metricType string) []string // set by New from the registry
+	exporter        Exporter
+	statsd          *StatsDConfig
+	pubsub          *PubSubConfig
+	bigquery        *BigQueryConfig
+	otlp            *OTLPConfig
+	tracerProvider  trace.TracerProvider
+	dryRun          io.Writer
+
+	normalizers       map[string][]LabelNormalizer
+	unsupportedPolicy UnsupportedValuePolicy
+	defaultLabels     map[string]string
+	moduleNamespaces  bool
+	sampling          map[string]Sampling
+	durationUnit      string
+	stringStates      bool
+	exportWorkers     int
+	exportQueue       int
+	priorities        map[string]Priority
+	priorityClasses   map[Priority]PriorityClass
+
+	cardinalityLimits  map[string]CardinalityLimit
+	defaultCardinality *CardinalityLimit
+
+	walPath    string
+	walMetrics []string
+
+	spoolDir       string
+	spoolMaxBytes  int64
+	spoolTTL       time.Duration
+	dedupWindow    time.Duration
+	units          map[string]string // by metric name
+	labelExtractor func(ctx context.Context) map[string]string
+	disabled       bool
+	allowMetrics   []string
+	denyMetrics    []string
+
+	flushInterval time.Duration
+
+	descriptorTTL         time.Duration
+	descriptorNegativeTTL time.Duration
+
+	exportTimeout time.Duration
+	detached      bool
+
+	errorWindow time.Duration
+	errorHook   func(ErrorReport)
+}
+
+// Option configures a Client
+type Option func(*config)
+
+// WithLogger sets the logger for the Client's diagnostics. Pass a logger with a
+// discarding handler to silence them. Defaults to slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// newConfig applies opts over the defaults taken from the environment
+func newConfig(opts []Option) config {
+	cfg := config{
+		projectID:    getProjectID(),
+		functionName: getFunctionName(),
+		dryRun:       getDryRun(),
+		disabled:     getDisabled(),
+		allowMetrics: getMetricList("METRICS_ALLOW"),
+		denyMetrics:  getMetricList("METRICS_DENY"),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.logger == nil {
+		cfg.logger = slog.Default().With("component", "metrics")
+	}
+	return cfg
+}
+
+// New creates a Client connected to Cloud Monitoring, or to the exporter given by WithExporter or WithDryRun
+func New(ctx context.Context, opts ...Option) (*Client, error) {
+	cfg := newConfig(opts)
+	if err := validateNamespace(cfg.namespace); err != nil {
+		return nil, err
+	}
+
+	registry := newRegistry()
+	cfg.declaredLabels = registry.labelKeys
+	exp, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		cfg:         cfg,
+		logger:      cfg.logger,
+		failLog:     cfg.logger,
+		exporter:    exp,
+		tracer:      newTracer(cfg),
+		cardinality: newCardinalityGuard(cfg.cardinalityLimits, cfg.defaultCardinality, cfg.logger),
+		samplers:    newSamplers(cfg.sampling),
+		registry:    registry,
+		interned:    newInterner(),
+		recycle:     cfg.exporter == nil,
+		stats:       selfStats{start: time.Now()},
+		closed:      make(chan struct{}),
+		stopFlush:   make(chan struct{}),
+		flushDone:   make(chan struct{}),
+		collectors:  make(map[uint64]collector),
+	}
+	if f, ok := exp.(*fanoutExporter); ok {
+		f.failed = c.secondaryFailed
+	}
+	if cfg.defaultLabels != nil {
+		c.defaultLabels.Store(&cfg.defaultLabels)
+	}
+	c.global = c.newGlobalResource()
+	c.disabled.Store(cfg.disabled)
+	c.filter.Store(newMetricFilter(cfg.allowMetrics, cfg.denyMetrics, cfg.namespace))
+	for name, unit := range cfg.units {
+		c.setUnit(name, unit)
+	}
+	if cfg.flushInterval > 0 {
+		c.buffer = newPointBuffer()
+	}
+	if cfg.dedupWindow > 0 {
+		c.dedup = newDedup(cfg.dedupWindow)
+	}
+	if cfg.exportWorkers > 0 {
+		c.startPool()
+	}
+	if len(cfg.priorities) > 0 || len(cfg.priorityClasses) > 0 {
+		c.startPriorities()
+	}
+	if cfg.errorWindow > 0 {
+		c.errors = newErrorAggregator(cfg.errorWindow, cfg.errorHook, cfg.logger)
+		c.failLog = slog.New(slog.DiscardHandler)
+	}
+
+	if cfg.walPath != "" {
+		if c.wal, err = openWAL(cfg.walPath, c.metricTypes(cfg.walMetrics), cfg.logger, c.failLog); err != nil {
+			exp.Close()
+			return nil, err
+		}
+		c.recordDuplicates(ctx, c.wal.replay(ctx, c.export)) // deliver anything left from a previous run
+	}
+	if cfg.spoolDir != "" {
+		if c.spool, err = openSpool(cfg.spoolDir, cfg.spoolMaxBytes, cfg.spoolTTL, cfg.logger, c.failLog); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.recordDuplicates(ctx, c.spool.replay(ctx, c.export))
+	}
+	if c.buffer != nil {
+		c.startFlusher()
+	}
+	return c, nil
+}
+
+// Close stops the background flusher and export workers, exports anything still buffered and closes the exporter
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	c.stopFlusher()
+	c.classLoops.Wait()
+	c.Flush(context.Background())
+	if c.pool != nil {
+		c.pool.stop()
+	}
+	if c.errors != nil {
+		c.errors.flush()
+	}
+	if c.wal != nil {
+		if err := c.wal.close(); err != nil {
+			c.logger.Error("could not close wal", "error", err)
+		}
+	}
+	c.closeReader()
+	return c.exporter.Close()
+}
+
+// PushMetric sends a custom metric with any value type to Google Cloud Monitoring
+func (c *Client) PushMetric(ctx context.Context, metricName string, value interface{}, labels map[string]string) {
+	c.TryPushMetric(ctx, metricName, value, labels)
+}
+
+// TryPushMetric is PushMetric, but reports points rejected before being queued for
+// export: ErrUnsupportedValue for a value that can't be converted, ErrDropped for a
+// point over a cardinality limit or request budget, ErrInvalidResource for a resource
+// from ContextWithResource missing required labels, and ErrDuplicate for a repeated
+// idempotency key. Export failures happen later and are not returned.
+func (c *Client) TryPushMetric(ctx context.Context, metricName string, value interface{}, labels map[string]string) error {
+	weight, ok := c.sample(metricName)
+	if !ok {
+		return nil // sampled out, not an error
+	}
+	if !c.spendBudget(ctx, metricName, 1) {
+		return ErrDropped
+	}
+	if err := c.registerGauge(metricName, labels); err != nil {
+		return err
+	}
+	resource, err := c.contextResource(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if c.duplicate(ctx, metricName) {
+		return ErrDuplicate // before admitting, so repeats don't take cardinality slots
+	}
+	ts, err := c.gaugeSeries(resource, metricName, c.declaredDuration(metricName, value), weighted(c.withContextLabels(ctx, labels), weight))
+	if err != nil {
+		return err
+	}
+	c.emit(ctx, []*monpb.TimeSeries{ts})
+	return nil
+}
+
+// gaugeSeries builds the time series for a single gauge point on resource (the global
+// resource if nil), or returns why it was dropped
+func (c *Client) gaugeSeries(resource *gcprpb.MonitoredResource, metricName string, value interface{}, labels map[string]string) (*monpb.TimeSeries, error) {
+	return c.buildGauge(time.Now(), resource, metricName, value, c.prepareLabels(metricName, labels))
+}
+
+// prepareLabels returns the labels to record for metricName: a copy of labels with
+// the default labels and function_name added, normalized and sanitized. The result is
+// interned and shared with other points of the series, so it must not be modified.
+func (c *Client) prepareLabels(metricName string, labels map[string]string) map[string]string {
+	// Merge into scratch space so the caller's map is never modified, and always include function_name label for consistency
+	s := scratchPool.Get().(*labelScratch)
+	defer s.release()
+	merged := s.labels
+	for k, v := range labels {
+		merged[k] = v
+	}
+	c.mergeDefaultLabels(merged)
+	if _, ok := merged["function_name"]; !ok {
+		merged["function_name"] = c.cfg.functionName
+	}
+	c.normalizeLabels(merged)
+
+	key := s.key(merged)
+	if prepared, ok := c.interned.preparedLabels(key); ok {
+		return prepared
+	}
+	prepared := sanitizeLabels(c.logger, metricName, merged)
+	c.interned.storeLabels(key, prepared)
+	return prepared
+}
+
+// buildGauge builds a gauge series at time t from labels already passed through prepareLabels
+func (c *Client) buildGauge(t time.Time, resource *gcprpb.MonitoredResource, metricName string, value interface{}, labels map[string]string) (*monpb.TimeSeries, error) {
+	metricType := c.internedType(metricName)
+	value, labels = c.stringState(value, labels)
+	labels, ok := c.cardinality.admit(metricName, labels) // limits are keyed by the name callers use
+	if !ok {
+		return nil, ErrDropped // over the cardinality limit
+	}
+
+	typedValue, err := c.typedValue(metricName, value)
+	if err != nil {
+		return nil, err
+	}
+
+	ts, point := newSeries()
+	point.Interval = &monpb.TimeInterval{EndTime: timestamppb.New(pointTime(t))}
+	point.Value = typedValue
+	ts.Metric = c.metric(metricType, labels)
+	ts.Resource = resource
+	ts.Unit = c.unit(metricType)
+	if ts.Resource == nil {
+		ts.Resource = c.global
+	}
+
+	return ts, nil
+}
+
+// newGlobalResource builds the global resource of the Client's project
+func (c *Client) newGlobalResource() *gcprpb.MonitoredResource {
+	return &gcprpb.MonitoredResource{
+		Type: "global",
+		Labels: map[string]string{
+			"project_id": c.cfg.projectID,
+		},
+	}
+}
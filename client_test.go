@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// captureExporter records every series exported through it
+type captureExporter struct {
+	mu     sync.Mutex
+	series []*monpb.TimeSeries
+	err    error // returned from Export when set
+}
+
+func (e *captureExporter) Export(ctx context.Context, series []*monpb.TimeSeries) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.series = append(e.series, series...)
+	return e.err
+}
+
+func (e *captureExporter) Close() error { return nil }
+
+// exported returns what was exported so far
+func (e *captureExporter) exported() []*monpb.TimeSeries {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*monpb.TimeSeries(nil), e.series...)
+}
+
+// byType returns the exported series of metricType
+func (e *captureExporter) byType(metricType string) []*monpb.TimeSeries {
+	var out []*monpb.TimeSeries
+	for _, ts := range e.exported() {
+		if ts.GetMetric().GetType() == metricType {
+			out = append(out, ts)
+		}
+	}
+	return out
+}
+
+// newTestClient returns a Client exporting into a captureExporter
+func newTestClient(t *testing.T, opts ...Option) (*Client, *captureExporter) {
+	t.Helper()
+	exp := &captureExporter{}
+	opts = append([]Option{WithProjectID("test-project"), WithLogger(discardLogger), WithExporter(exp)}, opts...)
+	c, err := New(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, exp
+}
+
+func TestTryPushMetric(t *testing.T) {
+	c, exp := newTestClient(t)
+	ctx := context.Background()
+	if err := c.TryPushMetric(ctx, "orders/open", 3, map[string]string{"region": "eu"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.TryPushMetric(ctx, "orders/open", struct{}{}, nil); err == nil {
+		t.Error("unsupported value accepted")
+	}
+
+	got := exp.byType("custom.googleapis.com/orders/open")
+	if len(got) != 1 {
+		t.Fatalf("exported %d series, want 1", len(got))
+	}
+	ts := got[0]
+	if v := ts.GetPoints()[0].GetValue().GetInt64Value(); v != 3 {
+		t.Errorf("value = %d, want 3", v)
+	}
+	if ts.GetMetric().GetLabels()["region"] != "eu" {
+		t.Errorf("labels = %v", ts.GetMetric().GetLabels())
+	}
+	if _, ok := ts.GetMetric().GetLabels()["function_name"]; !ok {
+		t.Error("function_name label missing")
+	}
+	if res := ts.GetResource(); res.GetType() != "global" || res.GetLabels()["project_id"] != "test-project" {
+		t.Errorf("resource = %v", res)
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
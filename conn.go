@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3"
+	"google.golang.org/api/option"
+)
+
+// connKey identifies Clients that can share one underlying gRPC connection pool.
+// The zero value is the default endpoint with Application Default Credentials.
+type connKey struct {
+	endpoint    string
+	credentials string // "file:" and the path, or "json:" and a hash of the key
+}
+
+// connKeyFor returns the key of the connection cfg can share
+func connKeyFor(cfg config) connKey {
+	key := connKey{endpoint: cfg.endpoint}
+	switch {
+	case cfg.credentialsJSON != nil:
+		sum := sha256.Sum256(cfg.credentialsJSON)
+		key.credentials = "json:" + hex.EncodeToString(sum[:])
+	case cfg.credentialsFile != "":
+		key.credentials = "file:" + cfg.credentialsFile
+	}
+	return key
+}
+
+// sharedConn is a MetricClient used by several Clients
+type sharedConn struct {
+	client *monitoring.MetricClient
+	refs   int
+}
+
+// Connections shared by every Client in the process
+var (
+	connsMu sync.Mutex
+	conns   = make(map[connKey]*sharedConn)
+)
+
+// WithProjectID sets the project metrics are written to, instead of GOOGLE_CLOUD_PROJECT.
+// Clients for different projects still share one connection to Cloud Monitoring.
+func WithProjectID(projectID string) Option {
+	return func(c *config) {
+		c.projectID = projectID
+	}
+}
+
+// WithDedicatedConnection gives the Client its own connection instead of sharing
+// one with other Clients that use the same endpoint and credentials
+func WithDedicatedConnection() Option {
+	return func(c *config) {
+		c.dedicatedConn = true
+	}
+}
+
+// WithEndpoint sends requests to a Cloud Monitoring endpoint other than the global
+// one, such as a regional or private endpoint. Clients using the same endpoint share
+// a connection.
+func WithEndpoint(endpoint string) Option {
+	return func(c *config) {
+		c.endpoint = endpoint
+	}
+}
+
+// WithCredentialsFile authenticates with the service account key file at path instead of
+// Application Default Credentials. Clients using the same file and endpoint share a
+// connection; pass credentials this way rather than through WithClientOptions to keep that.
+func WithCredentialsFile(path string) Option {
+	return func(c *config) {
+		c.credentialsFile = path
+	}
+}
+
+// WithCredentialsJSON is WithCredentialsFile for a key held in memory
+func WithCredentialsJSON(json []byte) Option {
+	return func(c *config) {
+		c.credentialsJSON = json
+	}
+}
+
+// WithClientOptions passes opts to the Cloud Monitoring clients the Client creates, for
+// credentials, impersonation or a local emulator:
+//
+//	metrics.WithClientOptions(
+//		option.WithEndpoint("localhost:8085"),
+//		option.WithoutAuthentication(),
+//		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+//	)
+//
+// Options can't be compared, so a Client given any gets a dedicated connection.
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(c *config) {
+		c.clientOptions = append(c.clientOptions, opts...)
+	}
+}
+
+// WithMetricClient writes and queries through mc instead of connecting itself. The
+// caller owns mc and closes it after closing the Client.
+func WithMetricClient(mc *monitoring.MetricClient) Option {
+	return func(c *config) {
+		c.metricClient = mc
+	}
+}
+
+// monitoringOptions returns the options for the Cloud Monitoring clients cfg asks for
+func monitoringOptions(cfg config) []option.ClientOption {
+	var opts []option.ClientOption
+	if cfg.endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.endpoint))
+	}
+	switch {
+	case cfg.credentialsJSON != nil:
+		opts = append(opts, option.WithCredentialsJSON(cfg.credentialsJSON))
+	case cfg.credentialsFile != "":
+		opts = append(opts, option.WithCredentialsFile(cfg.credentialsFile))
+	}
+	return append(opts, cfg.clientOptions...)
+}
+
+// acquireConn returns the shared MetricClient for key, dialing it on first use.
+// The returned func drops the reference and closes the connection after the last one.
+func acquireConn(ctx context.Context, key connKey, dial func(context.Context) (*monitoring.MetricClient, error)) (*monitoring.MetricClient, func() error, error) {
+	connsMu.Lock()
+	defer connsMu.Unlock()
+
+	sc := conns[key]
+	if sc == nil {
+		mc, err := dial(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		sc = &sharedConn{client: mc}
+		conns[key] = sc
+	}
+	sc.refs++
+
+	var once sync.Once
+	release := func() error {
+		var err error
+		once.Do(func() {
+			connsMu.Lock()
+			defer connsMu.Unlock()
+			sc.refs--
+			if sc.refs == 0 {
+				delete(conns, key)
+				err = sc.client.Close()
+			}
+		})
+		return err
+	}
+	return sc.client, release, nil
+}
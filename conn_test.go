@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestConnKeyForCredentials(t *testing.T) {
+	apply := func(opts ...Option) config {
+		var cfg config
+		for _, opt := range opts {
+			opt(&cfg)
+		}
+		return cfg
+	}
+	keys := []connKey{
+		connKeyFor(apply()),
+		connKeyFor(apply(WithCredentialsFile("/a.json"))),
+		connKeyFor(apply(WithCredentialsFile("/b.json"))),
+		connKeyFor(apply(WithCredentialsJSON([]byte(`{"a":1}`)))),
+		connKeyFor(apply(WithCredentialsJSON([]byte(`{"b":1}`)))),
+		connKeyFor(apply(WithEndpoint("europe-west1-monitoring.googleapis.com:443"))),
+	}
+	seen := make(map[connKey]int)
+	for i, k := range keys {
+		if j, ok := seen[k]; ok {
+			t.Errorf("configs %d and %d share connection key %+v", j, i, k)
+		}
+		seen[k] = i
+	}
+	if a, b := connKeyFor(apply(WithCredentialsFile("/a.json"))), keys[1]; a != b {
+		t.Errorf("same credentials file gave keys %+v and %+v", a, b)
+	}
+}
+
+func TestAcquireConnSharesAndReleases(t *testing.T) {
+	dials := 0
+	dial := func(ctx context.Context) (*monitoring.MetricClient, error) {
+		dials++
+		// Connects lazily, so nothing needs to listen
+		return monitoring.NewMetricClient(ctx,
+			option.WithEndpoint("localhost:1"),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	}
+	ctx := context.Background()
+	key := connKey{endpoint: "test-acquire", credentials: "file:/a.json"}
+
+	a, releaseA, err := acquireConn(ctx, key, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, releaseB, _ := acquireConn(ctx, key, dial)
+	if a != b || dials != 1 {
+		t.Fatalf("second acquire dialed again (dials %d)", dials)
+	}
+	other, releaseOther, _ := acquireConn(ctx, connKey{endpoint: "test-acquire", credentials: "file:/b.json"}, dial)
+	if other == a {
+		t.Fatal("different credentials shared a connection")
+	}
+	releaseOther()
+
+	releaseA()
+	releaseA() // releasing twice drops one reference only
+	connsMu.Lock()
+	_, open := conns[key]
+	connsMu.Unlock()
+	if !open {
+		t.Fatal("connection closed while still referenced")
+	}
+	if err := releaseB(); err != nil {
+		t.Fatal(err)
+	}
+	connsMu.Lock()
+	_, open = conns[key]
+	connsMu.Unlock()
+	if open {
+		t.Fatal("connection kept after the last release")
+	}
+}
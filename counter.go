@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	gcprpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Counter is a cumulative INT64 metric. Each label set is its own series with a start
+// time set when the series is first recorded in this process, so after a restart the
+// new start time tells Cloud Monitoring the count was reset rather than that it fell.
+// Counters are published on every flush, not on every Add.
+type Counter struct {
+	client *Client
+	name   string
+	delta  bool // publish increments since the last flush, see NewDeltaCounter
+
+	mu       sync.Mutex
+	series   map[string]*counterSeries
+	resource *gcprpb.MonitoredResource // nil for the global resource
+}
+
+// counterSeries is the running state of one label set
+type counterSeries struct {
+	labels   map[string]string
+	resource *gcprpb.MonitoredResource
+	start    time.Time
+	total    int64
+	lastEnd  time.Time // end time of the last published point
+	carry    float64   // fraction of a sampled increment not yet added to total
+	dirty    bool      // recorded since the last flush, for delta counters
+}
+
+// NewCounter returns a cumulative counter published on every flush. Counters are
+// shared by name, so a second NewCounter for the same metric returns the first one.
+// If the name is in use by another kind of instrument the error is logged and the
+// returned counter records nothing.
+func (c *Client) NewCounter(metricName string) *Counter {
+	existing, err := c.claim(metricName, KindCounter)
+	if err != nil {
+		c.logger.Error("could not create counter", "metric", metricName, "error", err)
+		return &Counter{name: metricName}
+	}
+	if existing != nil {
+		return existing.(*Counter)
+	}
+	ctr := &Counter{client: c, name: metricName, series: make(map[string]*counterSeries)}
+	c.remember(metricName, ctr, nil)
+	c.register(ctr)
+	return ctr
+}
+
+// SetResource writes the counter's series against res instead of the global resource.
+// Series already recorded keep their resource.
+func (ctr *Counter) SetResource(res Resource) error {
+	if ctr.client == nil {
+		return nil // metrics disabled
+	}
+	resource, err := ctr.client.resolveResource(res)
+	if err != nil {
+		return err
+	}
+	ctr.mu.Lock()
+	ctr.resource = resource
+	ctr.mu.Unlock()
+	return nil
+}
+
+// Add increases the counter for labels by n. Negative n is ignored.
+func (ctr *Counter) Add(ctx context.Context, n int64, labels map[string]string) {
+	if ctr.client == nil {
+		return // metrics disabled
+	}
+	if n < 0 {
+		ctr.client.logger.Warn("ignoring negative counter increment", "metric", ctr.name, "delta", n)
+		return
+	}
+	weight, ok := ctr.client.sample(ctr.name)
+	if !ok {
+		return
+	}
+	ctr.update(ctx, labels, func(s *counterSeries) { s.add(n, weight) })
+}
+
+// add increases the total by n events recorded at a sampling weight, carrying the
+// fraction left over by probability sampling to the next increment
+func (s *counterSeries) add(n int64, weight float64) {
+	if weight == 1 {
+		s.total += n
+		return
+	}
+	scaled := float64(n)*weight + s.carry
+	whole := math.Floor(scaled)
+	s.total += int64(whole)
+	s.carry = scaled - whole
+}
+
+// Observe records a total maintained elsewhere, such as a count read from another
+// process. A total lower than the last one means the source restarted, so the series
+// gets a new start time.
+func (ctr *Counter) Observe(ctx context.Context, total int64, labels map[string]string) {
+	if ctr.delta {
+		ctr.client.logger.Warn("ignoring Observe on delta counter", "metric", ctr.name)
+		return
+	}
+	ctr.update(ctx, labels, func(s *counterSeries) {
+		if total < s.total {
+			ctr.client.logger.Info("counter reset detected, starting new series interval", "metric", ctr.name, "previous", s.total, "total", total)
+			s.start = resetStart(s.lastEnd)
+		}
+		s.total = total
+	})
+}
+
+// update applies fn to the series for labels, creating it if the cardinality limit allows
+func (ctr *Counter) update(ctx context.Context, labels map[string]string, fn func(*counterSeries)) {
+	if ctr.client == nil || !ctr.client.spendBudget(ctx, ctr.name, 1) { // nil when metrics are disabled
+		return
+	}
+	if !ctr.client.checkLabels(ctr.name, labels) {
+		return
+	}
+	prepared := ctr.client.prepareLabels(ctr.name, ctr.client.withContextLabels(ctx, labels))
+
+	ctr.mu.Lock()
+	defer ctr.mu.Unlock()
+	resource, err := ctr.client.contextResource(ctx, ctr.resource)
+	if err != nil {
+		ctr.client.logger.Error("dropping counter update with invalid resource", "metric", ctr.name, "error", err)
+		return
+	}
+	key := resourceSeriesKey(resource, seriesKey(prepared))
+	s := ctr.series[key]
+	if s == nil {
+		admitted, ok := ctr.client.cardinality.admit(ctr.name, prepared)
+		if !ok {
+			return
+		}
+		// A collapsed label set may already have a series of its own
+		key = resourceSeriesKey(resource, seriesKey(admitted))
+		if s = ctr.series[key]; s == nil {
+			s = &counterSeries{labels: admitted, resource: resource, start: pointTime(time.Now())}
+			ctr.series[key] = s
+		}
+	}
+	if ctr.client.duplicate(ctx, ctr.name) {
+		return
+	}
+	fn(s)
+	s.dirty = true
+}
+
+// collect publishes the current total of every series
+func (ctr *Counter) collect(c *Client, now time.Time) []*monpb.TimeSeries {
+	metricType := c.metricType(ctr.name)
+
+	ctr.mu.Lock()
+	defer ctr.mu.Unlock()
+	if ctr.delta {
+		return ctr.collectDelta(c, now)
+	}
+	out := make([]*monpb.TimeSeries, 0, len(ctr.series))
+	for _, s := range ctr.series {
+		end := cumulativeEnd(s.start, now)
+		s.lastEnd = end
+		out = append(out, c.cumulativeSeries(metricType, s.resource, s.labels, s.start, end, &monpb.TypedValue{
+			Value: &monpb.TypedValue_Int64Value{Int64Value: s.total},
+		}))
+	}
+	return out
+}
+
+// cumulativeSeries builds a CUMULATIVE series with one point covering start to end, on
+// resource or the global resource if nil
+func (c *Client) cumulativeSeries(metricType string, resource *gcprpb.MonitoredResource, labels map[string]string, start, end time.Time, value *monpb.TypedValue) *monpb.TimeSeries {
+	if resource == nil {
+		resource = c.global
+	}
+	ts, point := newSeries()
+	ts.Metric = c.metric(metricType, labels)
+	ts.Resource = resource
+	ts.MetricKind = mpb.MetricDescriptor_CUMULATIVE
+	ts.ValueType = valueTypeOf(value)
+	ts.Unit = c.unit(metricType)
+	point.Interval = &monpb.TimeInterval{
+		StartTime: timestamppb.New(start),
+		EndTime:   timestamppb.New(end),
+	}
+	point.Value = value
+	return ts
+}
+
+// cumulativeEnd returns the end time for a point published at now. Cloud Monitoring
+// requires a cumulative point to end after it starts.
+func cumulativeEnd(start, now time.Time) time.Time {
+	end := pointTime(now)
+	if !end.After(start) {
+		end = start.Add(time.Millisecond)
+	}
+	return end
+}
+
+// resetStart returns the start time for a series that was reset. It must come after the
+// end of the last point published for the old interval.
+func resetStart(lastEnd time.Time) time.Time {
+	start := pointTime(time.Now())
+	if !start.After(lastEnd) {
+		start = lastEnd.Add(time.Microsecond)
+	}
+	return start
+}
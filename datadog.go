@@ -0,0 +1,244 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultDatadogSite is the Datadog site used when none is configured
+const defaultDatadogSite = "datadoghq.com"
+
+// DatadogConfig configures the Datadog exporter
+type DatadogConfig struct {
+	APIKey     string       // required
+	Site       string       // e.g. datadoghq.eu, defaults to datadoghq.com
+	HTTPClient *http.Client // defaults to a client with a 10 second timeout
+}
+
+// WithDatadog sends metrics to Datadog instead of Cloud Monitoring. Setting
+// METRICS_BACKEND=datadog with DD_API_KEY, and optionally DD_SITE, does the same
+// without code changes.
+func WithDatadog(cfg DatadogConfig) Option {
+	return func(c *config) {
+		c.exporter = NewDatadogExporter(cfg)
+	}
+}
+
+// getDatadog returns the Datadog configuration from the environment, if it selects Datadog
+func getDatadog() (DatadogConfig, bool) {
+	if !strings.EqualFold(os.Getenv("METRICS_BACKEND"), "datadog") {
+		return DatadogConfig{}, false
+	}
+	return DatadogConfig{APIKey: os.Getenv("DD_API_KEY"), Site: os.Getenv("DD_SITE")}, true
+}
+
+// datadogExporter submits points to the Datadog metrics API (v2 series).
+// Metric types lose the custom.googleapis.com/ prefix and use dots for slashes, so
+// custom.googleapis.com/checkout/latency becomes checkout.latency. Labels and resource
+// labels become tags.
+type datadogExporter struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewDatadogExporter returns an Exporter that writes to the Datadog metrics API.
+// Gauges are sent as gauges and cumulative series as monotonic gauges of the running
+// total, distributions as <metric>.count and <metric>.avg gauges. String values,
+// which Datadog can't store, are skipped.
+func NewDatadogExporter(cfg DatadogConfig) Exporter {
+	site := cfg.Site
+	if site == "" {
+		site = defaultDatadogSite
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &datadogExporter{url: "https://api." + site + "/api/v2/series", apiKey: cfg.APIKey, client: client}
+}
+
+// datadogGauge is the v2 series type for gauges
+const datadogGauge = 3
+
+type datadogPayload struct {
+	Series []datadogSeries `json:"series"`
+}
+
+type datadogSeries struct {
+	Metric    string         `json:"metric"`
+	Type      int            `json:"type"`
+	Unit      string         `json:"unit,omitempty"`
+	Points    []datadogPoint `json:"points"`
+	Tags      []string       `json:"tags,omitempty"`
+	Resources []datadogRes   `json:"resources,omitempty"`
+}
+
+type datadogPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+type datadogRes struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (e *datadogExporter) Export(ctx context.Context, series []*monpb.TimeSeries) error {
+	if e.apiKey == "" {
+		return status.Error(codes.FailedPrecondition, "metrics: datadog API key is not set")
+	}
+
+	var payload datadogPayload
+	for _, ts := range series {
+		payload.Series = append(payload.Series, datadogSeriesFor(ts)...)
+	}
+	if len(payload.Series) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", e.apiKey)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return status.Error(httpCode(resp.StatusCode), fmt.Sprintf("metrics: datadog returned %s: %s", resp.Status, bytes.TrimSpace(msg)))
+}
+
+func (e *datadogExporter) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// datadogSeriesFor converts one time series
+func datadogSeriesFor(ts *monpb.TimeSeries) []datadogSeries {
+	name := datadogMetricName(ts.GetMetric().GetType())
+	tags := datadogTags(ts)
+	var out []datadogSeries
+	for _, p := range ts.GetPoints() {
+		at := p.GetInterval().GetEndTime().AsTime().Unix()
+		add := func(metric string, v float64) {
+			out = append(out, datadogSeries{
+				Metric: metric,
+				Type:   datadogGauge,
+				Unit:   datadogUnit(ts.GetUnit()),
+				Points: []datadogPoint{{Timestamp: at, Value: v}},
+				Tags:   tags,
+			})
+		}
+		switch v := p.GetValue().GetValue().(type) {
+		case *monpb.TypedValue_Int64Value:
+			add(name, float64(v.Int64Value))
+		case *monpb.TypedValue_DoubleValue:
+			add(name, v.DoubleValue)
+		case *monpb.TypedValue_BoolValue:
+			if v.BoolValue {
+				add(name, 1)
+			} else {
+				add(name, 0)
+			}
+		case *monpb.TypedValue_DistributionValue:
+			add(name+".count", float64(v.DistributionValue.GetCount()))
+			add(name+".avg", v.DistributionValue.GetMean())
+		}
+	}
+	if ts.GetMetricKind() == mpb.MetricDescriptor_CUMULATIVE {
+		for i := range out {
+			out[i].Tags = append(out[i].Tags, "metric_kind:cumulative")
+		}
+	}
+	return out
+}
+
+// datadogMetricName maps a Cloud Monitoring metric type onto Datadog's dotted names
+func datadogMetricName(metricType string) string {
+	name := strings.TrimPrefix(metricType, metricTypePrefix)
+	return strings.ReplaceAll(name, "/", ".")
+}
+
+// datadogTags returns the metric and resource labels as sorted key:value tags
+func datadogTags(ts *monpb.TimeSeries) []string {
+	labels := ts.GetMetric().GetLabels()
+	res := ts.GetResource().GetLabels()
+	tags := make([]string, 0, len(labels)+len(res))
+	for _, k := range sortedKeys(labels) {
+		tags = append(tags, k+":"+labels[k])
+	}
+	for _, k := range sortedKeys(res) {
+		if _, ok := labels[k]; !ok {
+			tags = append(tags, k+":"+res[k])
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// datadogUnit maps the UCUM units in units.go onto Datadog unit names
+func datadogUnit(unit string) string {
+	switch unit {
+	case UnitPercent:
+		return "percent"
+	case UnitNanoseconds:
+		return "nanosecond"
+	case UnitMicroseconds:
+		return "microsecond"
+	case UnitMilliseconds:
+		return "millisecond"
+	case UnitSeconds:
+		return "second"
+	case UnitBytes:
+		return "byte"
+	case UnitKibibytes:
+		return "kibibyte"
+	case UnitMebibytes:
+		return "mebibyte"
+	case UnitGibibytes:
+		return "gibibyte"
+	case UnitRequests:
+		return "request"
+	case UnitErrors:
+		return "error"
+	}
+	return ""
+}
+
+// httpCode classifies an HTTP status the way retryable expects gRPC codes
+func httpCode(httpStatus int) codes.Code {
+	switch {
+	case httpStatus == http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case httpStatus == http.StatusRequestTimeout || httpStatus >= 500:
+		return codes.Unavailable
+	case httpStatus == http.StatusUnauthorized || httpStatus == http.StatusForbidden:
+		return codes.PermissionDenied
+	}
+	return codes.InvalidArgument
+}
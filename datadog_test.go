@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	distpb "google.golang.org/genproto/googleapis/api/distribution"
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	gcprpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDatadogSeries(t *testing.T) {
+	gauge := gaugePoint("custom.googleapis.com/checkout/latency", map[string]string{"region": "eu", "job": "web"}, 1.5)
+	gauge.Unit = UnitMilliseconds
+	gauge.Resource = &gcprpb.MonitoredResource{Type: "generic_task", Labels: map[string]string{"job": "ignored", "location": "europe-west1"}}
+
+	got := datadogSeriesFor(gauge)
+	if len(got) != 1 {
+		t.Fatalf("got %d series, want 1", len(got))
+	}
+	s := got[0]
+	if s.Metric != "checkout.latency" || s.Type != datadogGauge || s.Unit != "millisecond" {
+		t.Errorf("series = %+v", s)
+	}
+	if want := []string{"job:web", "location:europe-west1", "region:eu"}; !reflect.DeepEqual(s.Tags, want) {
+		t.Errorf("tags = %v, want %v with metric labels winning", s.Tags, want)
+	}
+	if s.Points[0].Timestamp != 1700000000 || s.Points[0].Value != 1.5 {
+		t.Errorf("points = %v", s.Points)
+	}
+
+	dist := &monpb.TimeSeries{
+		Metric:     &mpb.Metric{Type: "custom.googleapis.com/sizes"},
+		MetricKind: mpb.MetricDescriptor_CUMULATIVE,
+		Points: []*monpb.Point{{
+			Interval: &monpb.TimeInterval{EndTime: timestamppb.New(time.Unix(1700000000, 0))},
+			Value:    &monpb.TypedValue{Value: &monpb.TypedValue_DistributionValue{DistributionValue: &distpb.Distribution{Count: 4, Mean: 2.5}}},
+		}},
+	}
+	got = datadogSeriesFor(dist)
+	if len(got) != 2 || got[0].Metric != "sizes.count" || got[0].Points[0].Value != 4 || got[1].Metric != "sizes.avg" || got[1].Points[0].Value != 2.5 {
+		t.Fatalf("distribution series = %+v", got)
+	}
+	if tags := got[0].Tags; len(tags) == 0 || tags[len(tags)-1] != "metric_kind:cumulative" {
+		t.Errorf("tags = %v, want the cumulative kind tagged", tags)
+	}
+}
+
+func TestDatadogExport(t *testing.T) {
+	var gotKey string
+	var got datadogPayload
+	code := http.StatusAccepted
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("DD-API-KEY")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	exp := NewDatadogExporter(DatadogConfig{APIKey: "key", HTTPClient: srv.Client()}).(*datadogExporter)
+	exp.url = srv.URL
+	defer exp.Close()
+	ctx := context.Background()
+	str := &monpb.TimeSeries{
+		Metric: &mpb.Metric{Type: "custom.googleapis.com/state"},
+		Points: []*monpb.Point{{Value: &monpb.TypedValue{Value: &monpb.TypedValue_StringValue{StringValue: "ok"}}}},
+	}
+	if err := exp.Export(ctx, []*monpb.TimeSeries{gaugePoint("custom.googleapis.com/orders", nil, 3), str}); err != nil {
+		t.Fatal(err)
+	}
+	if gotKey != "key" || len(got.Series) != 1 || got.Series[0].Metric != "orders" {
+		t.Errorf("key = %q, payload = %+v, want the string point skipped", gotKey, got)
+	}
+
+	code = http.StatusTooManyRequests
+	if err := exp.Export(ctx, []*monpb.TimeSeries{gaugePoint("custom.googleapis.com/orders", nil, 3)}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("429 = %v, want ResourceExhausted", err)
+	}
+	code = http.StatusBadRequest
+	if err := exp.Export(ctx, []*monpb.TimeSeries{gaugePoint("custom.googleapis.com/orders", nil, 3)}); retryable(err) {
+		t.Errorf("400 = %v, want a permanent error", err)
+	}
+
+	noKey := NewDatadogExporter(DatadogConfig{})
+	if err := noKey.Export(ctx, nil); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("missing API key = %v, want FailedPrecondition", err)
+	}
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// debugState is the document DebugHandler serves
+type debugState struct {
+	Time        time.Time        `json:"time"`
+	LastFlush   *time.Time       `json:"last_flush,omitempty"`
+	Instruments []InstrumentInfo `json:"instruments"`
+	Series      []jsonPoint      `json:"series"`  // what the next flush would publish for instruments
+	Pending     []jsonPoint      `json:"pending"` // points buffered until the next flush
+	Queue       debugQueue       `json:"queue"`
+	Pressure    float64          `json:"pressure"`
+}
+
+// debugQueue counts the work waiting to be exported
+type debugQueue struct {
+	Buffered   int   `json:"buffered"`    // series in flush buffers, priority classes included
+	ExportJobs int   `json:"export_jobs"` // batches queued for the export workers
+	Inflight   int   `json:"inflight"`    // detached exports running
+	SpoolBytes int64 `json:"spool_bytes"` // saved for replay once exports succeed
+}
+
+// snapshotter is a collector that can report its state without publishing it
+type snapshotter interface {
+	snapshot(c *Client, now time.Time) []*monpb.TimeSeries
+}
+
+// DebugHandler returns an HTTP handler that serves the Client's in-memory state as JSON:
+// the instruments it knows, the points each would publish on the next flush, the points
+// buffered for export, the last flush time and the size of the export queues. It changes
+// nothing and exports nothing, though gauge callbacks are sampled to show their values.
+// Mount it on an internal port only, label values can be sensitive.
+func (c *Client) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(c.debugState())
+	})
+}
+
+// debugState gathers the state DebugHandler serves
+func (c *Client) debugState() debugState {
+	now := time.Now()
+	st := debugState{
+		Time:        now,
+		Instruments: c.List(),
+		Series:      []jsonPoint{},
+		Pending:     []jsonPoint{},
+		Pressure:    c.Pressure(),
+	}
+	if ns := c.lastFlush.Load(); ns != 0 {
+		t := time.Unix(0, ns)
+		st.LastFlush = &t
+	}
+
+	c.collectMu.Lock()
+	cols := make([]collector, 0, len(c.collectors))
+	for _, col := range c.collectors {
+		cols = append(cols, col)
+	}
+	c.collectMu.Unlock()
+	for _, col := range cols {
+		if s, ok := col.(snapshotter); ok {
+			for _, ts := range s.snapshot(c, now) {
+				st.Series = append(st.Series, jsonPoints(ts)...)
+			}
+		}
+	}
+
+	var pending []*monpb.TimeSeries
+	if c.buffer != nil {
+		pending = append(pending, c.buffer.snapshot()...)
+	}
+	for _, pc := range c.classes {
+		if pc.buffer != nil {
+			pending = append(pending, pc.buffer.snapshot()...)
+		}
+	}
+	for _, ts := range pending {
+		st.Pending = append(st.Pending, jsonPoints(ts)...)
+	}
+
+	st.Queue.Buffered = len(pending)
+	st.Queue.Inflight = c.inflight.count()
+	if c.pool != nil {
+		st.Queue.ExportJobs = len(c.pool.jobs)
+	}
+	if c.spool != nil {
+		st.Queue.SpoolBytes = c.spool.size.Load()
+	}
+	return st
+}
+
+// snapshot returns what collect would publish without marking it published
+func (ctr *Counter) snapshot(c *Client, now time.Time) []*monpb.TimeSeries {
+	metricType := c.metricType(ctr.name)
+	ctr.mu.Lock()
+	defer ctr.mu.Unlock()
+	out := make([]*monpb.TimeSeries, 0, len(ctr.series))
+	for _, s := range ctr.series {
+		if ctr.delta && !s.dirty {
+			continue
+		}
+		out = append(out, c.cumulativeSeries(metricType, s.resource, s.labels, s.start, cumulativeEnd(s.start, now), &monpb.TypedValue{
+			Value: &monpb.TypedValue_Int64Value{Int64Value: s.total},
+		}))
+	}
+	return out
+}
+
+// snapshot returns what collect would publish without marking it published
+func (h *Histogram) snapshot(c *Client, now time.Time) []*monpb.TimeSeries {
+	metricType := c.metricType(h.name)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]*monpb.TimeSeries, 0, len(h.series))
+	for _, s := range h.series {
+		out = append(out, c.cumulativeSeries(metricType, s.resource, s.labels, s.start, cumulativeEnd(s.start, now), h.value(c, s)))
+	}
+	return out
+}
+
+// snapshot returns the final points of closed windows and the running totals of open
+// ones, without rolling any window over
+func (cs *CalendarSum) snapshot(c *Client, now time.Time) []*monpb.TimeSeries {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	out := make([]*monpb.TimeSeries, 0, len(cs.closed)+len(cs.series))
+	for _, ts := range cs.closed {
+		out = append(out, proto.Clone(ts).(*monpb.TimeSeries)) // reused once collected and exported
+	}
+	for _, s := range cs.series {
+		out = append(out, cs.point(s, cumulativeEnd(s.start, now)))
+	}
+	return out
+}
+
+// snapshot samples the callback without admitting its series to the cardinality guard
+func (g *gaugeFunc) snapshot(c *Client, now time.Time) []*monpb.TimeSeries {
+	v, err := g.sample()
+	if err != nil {
+		return nil
+	}
+	return []*monpb.TimeSeries{c.snapshotGauge(now, g.name, v, c.prepareLabels(g.name, g.labels))}
+}
+
+// snapshot computes the current ratios without admitting series to the cardinality guard
+func (s *SLO) snapshot(c *Client, now time.Time) []*monpb.TimeSeries {
+	var out []*monpb.TimeSeries
+	s.gauges(c, now, func(name string, v float64, labels map[string]string) {
+		out = append(out, c.snapshotGauge(now, name, v, labels))
+	})
+	return out
+}
+
+// snapshotGauge builds the gauge point a flush would publish from prepared labels, like
+// buildGauge but without admitting the series to the cardinality guard or using the pools
+func (c *Client) snapshotGauge(now time.Time, metricName string, v float64, labels map[string]string) *monpb.TimeSeries {
+	metricType := c.metricType(metricName)
+	return &monpb.TimeSeries{
+		Metric:   &mpb.Metric{Type: metricType, Labels: labels},
+		Resource: c.global,
+		Unit:     c.unit(metricType),
+		Points: []*monpb.Point{{
+			Interval: &monpb.TimeInterval{EndTime: timestamppb.New(pointTime(now))},
+			Value:    doubleValue(v),
+		}},
+	}
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// debugGet serves one DebugHandler request and decodes the response
+func debugGet(t *testing.T, c *Client) debugState {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/metrics", nil))
+	var st debugState
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestDebugHandlerChangesNothing(t *testing.T) {
+	c, exp := newTestClient(t, WithDefaultCardinalityLimit(CardinalityLimit{MaxSeries: 100}), WithFlushInterval(time.Hour))
+	ctx := context.Background()
+	slo, err := c.NewSLO("checkout/availability", 0.99, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slo.Record(ctx, false)
+	stale, _ := c.NewPercentiles("checkout/stale", 5*time.Millisecond)
+	stale.Observe(ctx, 1, nil)
+	latency, _ := c.NewPercentiles("checkout/latency", time.Hour, 0.5)
+	latency.Observe(ctx, 20, nil)
+	c.PushMetric(ctx, "checkout/open", 3, nil)
+	time.Sleep(10 * time.Millisecond) // the stale window is empty now
+
+	var st debugState
+	for range 2 {
+		st = debugGet(t, c)
+	}
+	published := make(map[string]bool)
+	for _, p := range st.Series {
+		published[p.Metric] = true
+	}
+	for _, m := range []string{"checkout/availability/error_ratio", "checkout/availability/burn_rate", "checkout/latency/p50"} {
+		if !published["custom.googleapis.com/"+m] {
+			t.Errorf("debug series lack %s: %v", m, published)
+		}
+	}
+	if len(st.Pending) != 1 || st.Queue.Buffered != 1 {
+		t.Errorf("pending = %v, buffered = %d, want the pushed point", st.Pending, st.Queue.Buffered)
+	}
+	if len(exp.exported()) != 0 {
+		t.Error("DebugHandler exported points")
+	}
+	if len(stale.series) != 1 {
+		t.Error("DebugHandler forgot a percentile series")
+	}
+	c.cardinality.mu.Lock()
+	_, admitted := c.cardinality.metrics["checkout/latency/p50"]
+	c.cardinality.mu.Unlock()
+	if admitted {
+		t.Error("DebugHandler admitted series to the cardinality guard")
+	}
+
+	c.Flush(ctx)
+	if n := len(exp.byType("custom.googleapis.com/checkout/availability/burn_rate")); n != 1 {
+		t.Errorf("flush exported %d burn rates, want 1", n)
+	}
+	if n := len(exp.byType("custom.googleapis.com/checkout/latency/p50")); n != 1 {
+		t.Errorf("flush exported %d p50 points, want 1", n)
+	}
+	if len(stale.series) != 0 {
+		t.Error("flush kept an empty percentile series")
+	}
+	if st := debugGet(t, c); st.LastFlush == nil || len(st.Pending) != 0 {
+		t.Errorf("last flush = %v, pending = %v after Flush", st.LastFlush, st.Pending)
+	}
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDuplicate is returned by TryPushMetric for a point whose idempotency key was
+// already recorded for the metric within the deduplication window
+var ErrDuplicate = errors.New("metrics: duplicate point dropped")
+
+// defaultDedupWindow is how long idempotency keys are remembered when no window is set
+const defaultDedupWindow = 5 * time.Minute
+
+// WithDeduplication remembers idempotency keys attached with ContextWithIdempotencyKey
+// for window, dropping repeated records of the same metric under the same key, such as
+// those from a retried handler or a redelivered Pub/Sub message. Zero selects 5 minutes.
+func WithDeduplication(window time.Duration) Option {
+	return func(c *config) {
+		if window <= 0 {
+			window = defaultDedupWindow
+		}
+		c.dedupWindow = window
+	}
+}
+
+type idempotencyKey struct{}
+
+// ContextWithIdempotencyKey returns a context whose gauge points, counter increments and
+// histogram observations are recorded at most once per metric for key, such as a request
+// or message ID, while the Client remembers it. It has no effect without WithDeduplication.
+func ContextWithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// dedup remembers the idempotency keys seen within the window
+type dedup struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // metric and key to when first seen
+	lastSweep time.Time
+}
+
+func newDedup(window time.Duration) *dedup {
+	return &dedup{window: window, seen: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+// duplicate reports whether metricName was already recorded with the idempotency key in
+// ctx, remembering it otherwise. Points without a key are never duplicates.
+func (c *Client) duplicate(ctx context.Context, metricName string) bool {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	if c.dedup == nil || key == "" {
+		return false
+	}
+	d := c.dedup
+	now := time.Now()
+	id := metricName + "\x00" + key
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.lastSweep) >= d.window {
+		for k, t := range d.seen {
+			if now.Sub(t) >= d.window {
+				delete(d.seen, k)
+			}
+		}
+		d.lastSweep = now
+	}
+	if t, ok := d.seen[id]; ok && now.Sub(t) < d.window {
+		c.logger.Debug("dropping duplicate point", "metric", metricName, "idempotency_key", key)
+		return true
+	}
+	d.seen[id] = now
+	return false
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeduplication(t *testing.T) {
+	c, exp := newTestClient(t, WithDeduplication(50*time.Millisecond))
+	ctx := ContextWithIdempotencyKey(context.Background(), "msg-1")
+	if err := c.TryPushMetric(ctx, "orders/placed", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.TryPushMetric(ctx, "orders/placed", 1, nil); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("repeated key = %v, want ErrDuplicate", err)
+	}
+	if err := c.TryPushMetric(ctx, "orders/value", 20, nil); err != nil {
+		t.Errorf("same key on another metric = %v", err)
+	}
+	if err := c.TryPushMetric(context.Background(), "orders/placed", 1, nil); err != nil {
+		t.Errorf("point without a key = %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := c.TryPushMetric(ctx, "orders/placed", 1, nil); err != nil {
+		t.Errorf("key past the window = %v", err)
+	}
+	if n := len(exp.byType("custom.googleapis.com/orders/placed")); n != 3 {
+		t.Errorf("exported %d points, want 3", n)
+	}
+}
+
+func TestIdempotencyKeyWithoutDeduplication(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := ContextWithIdempotencyKey(context.Background(), "msg-1")
+	c.TryPushMetric(ctx, "orders/placed", 1, nil)
+	if err := c.TryPushMetric(ctx, "orders/placed", 1, nil); err != nil {
+		t.Errorf("TryPushMetric = %v, want keys ignored without WithDeduplication", err)
+	}
+}
+
+func TestDuplicateTakesNoCardinalitySlot(t *testing.T) {
+	c, _ := newTestClient(t, WithDeduplication(time.Minute), WithCardinalityLimit("orders/placed", CardinalityLimit{MaxSeries: 2}))
+	ctx := ContextWithIdempotencyKey(context.Background(), "msg-1")
+	if err := c.TryPushMetric(ctx, "orders/placed", 1, map[string]string{"shop": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.TryPushMetric(ctx, "orders/placed", 1, map[string]string{"shop": "b"}); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("repeated key = %v, want ErrDuplicate", err)
+	}
+	if err := c.TryPushMetric(context.Background(), "orders/placed", 1, map[string]string{"shop": "c"}); err != nil {
+		t.Errorf("second series = %v, want a free slot after the duplicate", err)
+	}
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// NewDeltaCounter returns a counter that publishes, on every flush, only the increments
+// recorded since the previous flush. Use it for event counts such as items sold, where
+// summing across instances and time should give exact totals even when a process
+// restarts or a point is dropped: a lost point loses that interval's events, not the
+// baseline of every later point.
+//
+// Cloud Monitoring does not accept DELTA writes to custom metrics, so each interval is
+// written as a CUMULATIVE point starting just after the previous one ended. Aligners
+// treat every point as a reset, so ALIGN_DELTA and ALIGN_RATE read the per-interval
+// increments directly. Series with no increments in an interval publish nothing.
+// Observe is not supported on delta counters. Like counters, delta counters are shared
+// by name.
+func (c *Client) NewDeltaCounter(metricName string) *Counter {
+	existing, err := c.claim(metricName, KindDeltaCounter)
+	if err != nil {
+		c.logger.Error("could not create delta counter", "metric", metricName, "error", err)
+		return &Counter{name: metricName}
+	}
+	if existing != nil {
+		return existing.(*Counter)
+	}
+	ctr := &Counter{client: c, name: metricName, delta: true, series: make(map[string]*counterSeries)}
+	c.remember(metricName, ctr, nil)
+	c.register(ctr)
+	return ctr
+}
+
+// collectDelta publishes the increments of every series recorded since the last flush
+// and starts a new interval for each. Callers hold ctr.mu.
+func (ctr *Counter) collectDelta(c *Client, now time.Time) []*monpb.TimeSeries {
+	metricType := c.metricType(ctr.name)
+	out := make([]*monpb.TimeSeries, 0, len(ctr.series))
+	for _, s := range ctr.series {
+		if !s.dirty {
+			continue
+		}
+		end := cumulativeEnd(s.start, now)
+		out = append(out, c.cumulativeSeries(metricType, s.resource, s.labels, s.start, end, &monpb.TypedValue{
+			Value: &monpb.TypedValue_Int64Value{Int64Value: s.total},
+		}))
+		s.lastEnd = end
+		s.start = end.Add(time.Microsecond)
+		s.total = 0
+		s.dirty = false
+	}
+	return out
+}
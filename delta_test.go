@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// byLabel indexes series by the value of one label
+func byLabel(series []*monpb.TimeSeries, key string) map[string]*monpb.TimeSeries {
+	out := make(map[string]*monpb.TimeSeries, len(series))
+	for _, ts := range series {
+		out[ts.GetMetric().GetLabels()[key]] = ts
+	}
+	return out
+}
+
+func TestDeltaCounterPublishesIncrements(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+	ctr := c.NewDeltaCounter("items/sold")
+	ctr.Add(ctx, 3, map[string]string{"region": "eu"})
+	ctr.Add(ctx, 2, map[string]string{"region": "eu"})
+	ctr.Add(ctx, 1, map[string]string{"region": "us"})
+
+	now := time.Now().Add(time.Second)
+	first := byLabel(ctr.collect(c, now), "region")
+	if len(first) != 2 {
+		t.Fatalf("collected %d series, want 2", len(first))
+	}
+	if v := first["eu"].GetPoints()[0].GetValue().GetInt64Value(); v != 5 {
+		t.Errorf("eu = %d, want 5", v)
+	}
+
+	ctr.Add(ctx, 4, map[string]string{"region": "eu"})
+	ctr.Observe(ctx, 100, map[string]string{"region": "eu"}) // ignored on delta counters
+	second := ctr.collect(c, now.Add(time.Minute))
+	if len(second) != 1 {
+		t.Fatalf("collected %d series, want only the one recorded since the last flush", len(second))
+	}
+	p := second[0].GetPoints()[0]
+	if v := p.GetValue().GetInt64Value(); v != 4 {
+		t.Errorf("eu = %d, want the increment 4", v)
+	}
+	prevEnd := first["eu"].GetPoints()[0].GetInterval().GetEndTime().AsTime()
+	if start := p.GetInterval().GetStartTime().AsTime(); !start.After(prevEnd) {
+		t.Errorf("interval starts at %v, want after the previous end %v", start, prevEnd)
+	}
+
+	if idle := ctr.collect(c, now.Add(2*time.Minute)); len(idle) != 0 {
+		t.Errorf("idle interval published %d series", len(idle))
+	}
+}
+
+func TestDeltaCounterSharedByName(t *testing.T) {
+	c, _ := newTestClient(t)
+	if c.NewDeltaCounter("items/sold") != c.NewDeltaCounter("items/sold") {
+		t.Error("second NewDeltaCounter returned a new counter")
+	}
+	if ctr := c.NewCounter("items/sold"); ctr.client != nil {
+		t.Error("cumulative counter created over a delta counter")
+	}
+}
@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3"
+	lpb "google.golang.org/genproto/googleapis/api/label"
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Descriptor cache defaults. Lookups get a timeout of their own so they don't spend the
+// export's.
+const (
+	defaultDescriptorTTL         = time.Hour
+	defaultDescriptorNegativeTTL = time.Minute
+	descriptorTimeout            = 5 * time.Second
+)
+
+// WithDescriptorCache sets how long a metric descriptor is remembered as existing (ttl)
+// and how long a failed lookup or creation is remembered before being retried
+// (negativeTTL). Zero values keep the defaults of 1 hour and 1 minute.
+func WithDescriptorCache(ttl, negativeTTL time.Duration) Option {
+	return func(c *config) {
+		c.descriptorTTL = ttl
+		c.descriptorNegativeTTL = negativeTTL
+	}
+}
+
+// descriptorCache makes sure each metric's descriptor exists before its first write.
+// Cloud Monitoring would auto-create it, but creating it up front sets its kind, unit
+// and labels explicitly, and the cache keeps that to one Get per metric per TTL. A
+// series with label keys the descriptor doesn't have yet adds them to it.
+type descriptorCache struct {
+	client      *monitoring.MetricClient
+	projectID   string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	logger      *slog.Logger
+	declared    func(metricType string) []string // label keys instruments declare, may be nil
+
+	mu      sync.Mutex
+	entries map[string]descriptorEntry
+}
+
+type descriptorEntry struct {
+	pending bool // a lookup is in flight, others don't wait for it
+	failed  bool // the last lookup failed, so none is retried until it expires
+	expires time.Time
+	keys    map[string]bool // label keys the descriptor is known to have
+}
+
+func newDescriptorCache(client *monitoring.MetricClient, cfg config) *descriptorCache {
+	d := &descriptorCache{
+		client:      client,
+		projectID:   cfg.projectID,
+		ttl:         cfg.descriptorTTL,
+		negativeTTL: cfg.descriptorNegativeTTL,
+		logger:      cfg.logger,
+		declared:    cfg.declaredLabels,
+		entries:     make(map[string]descriptorEntry),
+	}
+	if d.ttl <= 0 {
+		d.ttl = defaultDescriptorTTL
+	}
+	if d.negativeTTL <= 0 {
+		d.negativeTTL = defaultDescriptorNegativeTTL
+	}
+	return d
+}
+
+// ensure looks up, creates or extends the descriptors for the metric types in series.
+// It is best effort: failures are cached and logged, and the write goes ahead regardless.
+func (d *descriptorCache) ensure(ctx context.Context, series []*monpb.TimeSeries) {
+	now := time.Now()
+	batch := make(map[string]*descriptorWant)
+	var order []string
+	for _, ts := range series {
+		typ := ts.GetMetric().GetType()
+		w := batch[typ]
+		if w == nil {
+			w = &descriptorWant{first: ts, keys: make(map[string]bool)}
+			batch[typ] = w
+			order = append(order, typ)
+		}
+		for k := range ts.GetMetric().GetLabels() {
+			w.keys[k] = true
+		}
+	}
+
+	var lookupCtx context.Context
+	for _, typ := range order {
+		w := batch[typ]
+		if !d.claim(typ, w.keys, now) {
+			continue
+		}
+		if d.declared != nil {
+			for _, k := range sanitizedLabelKeys(d.declared(typ)) {
+				w.keys[k] = true
+			}
+		}
+		if lookupCtx == nil {
+			var cancel context.CancelFunc
+			lookupCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), descriptorTimeout)
+			defer cancel()
+		}
+		keys, err := d.lookupOrCreate(lookupCtx, w.first, w.keys)
+		d.settle(typ, keys, err)
+	}
+}
+
+// descriptorWant is what a batch needs of one metric's descriptor
+type descriptorWant struct {
+	first *monpb.TimeSeries
+	keys  map[string]bool
+}
+
+// claim reports whether the caller should look typ up, marking the lookup as in flight.
+// A descriptor known to exist is looked up again when keys has labels it lacks.
+func (d *descriptorCache) claim(typ string, keys map[string]bool, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.entries[typ]
+	if ok && (e.pending || now.Before(e.expires) && (e.failed || hasKeys(e.keys, keys))) {
+		return false
+	}
+	e.pending = true
+	d.entries[typ] = e
+	return true
+}
+
+// hasKeys reports whether have holds every key in want
+func hasKeys(have, want map[string]bool) bool {
+	for k := range want {
+		if !have[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// settle records the outcome of a lookup
+func (d *descriptorCache) settle(typ string, keys map[string]bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		// Keep the known keys, so only series needing new ones wait out the retry
+		d.entries[typ] = descriptorEntry{failed: true, expires: time.Now().Add(d.negativeTTL), keys: d.entries[typ].keys}
+		d.logger.Warn("could not ensure metric descriptor", "metric", typ, "retry_in", d.negativeTTL, "error", err)
+		return
+	}
+	d.entries[typ] = descriptorEntry{expires: time.Now().Add(d.ttl), keys: keys}
+}
+
+// lookupOrCreate makes sure the descriptor for ts exists with at least keys, returning
+// the label keys it has
+func (d *descriptorCache) lookupOrCreate(ctx context.Context, ts *monpb.TimeSeries, keys map[string]bool) (map[string]bool, error) {
+	typ := ts.GetMetric().GetType()
+	name := "projects/" + d.projectID + "/metricDescriptors/" + typ
+	existing, err := d.client.GetMetricDescriptor(ctx, &monpb.GetMetricDescriptorRequest{Name: name})
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+
+	desc := descriptorFor(ts, keys)
+	if err == nil {
+		// Adding labels to an existing descriptor is done by creating it again with the
+		// full set, keeping what it already has
+		for _, l := range existing.GetLabels() {
+			keys[l.GetKey()] = true
+		}
+		if len(existing.GetLabels()) == len(keys) {
+			return keys, nil
+		}
+		desc = proto.Clone(existing).(*mpb.MetricDescriptor)
+		desc.Name = ""
+		desc.Labels = labelDescriptors(keys)
+	}
+
+	_, err = d.client.CreateMetricDescriptor(ctx, &monpb.CreateMetricDescriptorRequest{
+		Name:             "projects/" + d.projectID,
+		MetricDescriptor: desc,
+	})
+	if err != nil && status.Code(err) != codes.AlreadyExists { // created concurrently, e.g. by another instance
+		return nil, err
+	}
+	return keys, nil
+}
+
+// descriptorFor derives a descriptor with label keys from the first series written for a metric
+func descriptorFor(ts *monpb.TimeSeries, keys map[string]bool) *mpb.MetricDescriptor {
+	kind := ts.GetMetricKind()
+	if kind == mpb.MetricDescriptor_METRIC_KIND_UNSPECIFIED {
+		kind = mpb.MetricDescriptor_GAUGE
+	}
+	valueType := ts.GetValueType()
+	if valueType == mpb.MetricDescriptor_VALUE_TYPE_UNSPECIFIED && len(ts.GetPoints()) > 0 {
+		valueType = valueTypeOf(ts.GetPoints()[0].GetValue())
+	}
+
+	return &mpb.MetricDescriptor{
+		Type:       ts.GetMetric().GetType(),
+		MetricKind: kind,
+		ValueType:  valueType,
+		Unit:       ts.GetUnit(),
+		Labels:     labelDescriptors(keys),
+	}
+}
+
+// labelDescriptors returns string label descriptors for keys, sorted
+func labelDescriptors(keys map[string]bool) []*lpb.LabelDescriptor {
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	out := make([]*lpb.LabelDescriptor, 0, len(sorted))
+	for _, k := range sorted {
+		out = append(out, &lpb.LabelDescriptor{Key: k, ValueType: lpb.LabelDescriptor_STRING})
+	}
+	return out
+}
+
+// valueTypeOf returns the descriptor value type matching v
+func valueTypeOf(v *monpb.TypedValue) mpb.MetricDescriptor_ValueType {
+	switch v.GetValue().(type) {
+	case *monpb.TypedValue_Int64Value:
+		return mpb.MetricDescriptor_INT64
+	case *monpb.TypedValue_DoubleValue:
+		return mpb.MetricDescriptor_DOUBLE
+	case *monpb.TypedValue_BoolValue:
+		return mpb.MetricDescriptor_BOOL
+	case *monpb.TypedValue_StringValue:
+		return mpb.MetricDescriptor_STRING
+	case *monpb.TypedValue_DistributionValue:
+		return mpb.MetricDescriptor_DISTRIBUTION
+	}
+	return mpb.MetricDescriptor_VALUE_TYPE_UNSPECIFIED
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func labelledSeries(metricType string, labels map[string]string) *monpb.TimeSeries {
+	return &monpb.TimeSeries{
+		Metric:     &mpb.Metric{Type: metricType, Labels: labels},
+		MetricKind: mpb.MetricDescriptor_GAUGE,
+		ValueType:  mpb.MetricDescriptor_INT64,
+	}
+}
+
+func TestDescriptorLabelsUnionAcrossBatch(t *testing.T) {
+	fake, mc := startFakeMonitoring(t)
+	d := newDescriptorCache(mc, config{projectID: "p", logger: discardLogger})
+	const typ = "custom.googleapis.com/orders"
+
+	d.ensure(context.Background(), []*monpb.TimeSeries{
+		labelledSeries(typ, map[string]string{"region": "eu"}),
+		labelledSeries(typ, map[string]string{"region": "eu", "tier": "gold"}),
+	})
+	if got := fake.labelKeys(typ); !reflect.DeepEqual(got, []string{"region", "tier"}) {
+		t.Fatalf("descriptor labels = %v, want region and tier", got)
+	}
+
+	// Known keys don't trigger another lookup
+	d.ensure(context.Background(), []*monpb.TimeSeries{labelledSeries(typ, map[string]string{"tier": "gold"})})
+	if fake.gets != 1 {
+		t.Errorf("%d lookups, want 1", fake.gets)
+	}
+
+	// A new key extends the existing descriptor
+	d.ensure(context.Background(), []*monpb.TimeSeries{labelledSeries(typ, map[string]string{"channel": "web"})})
+	if got := fake.labelKeys(typ); !reflect.DeepEqual(got, []string{"channel", "region", "tier"}) {
+		t.Errorf("descriptor labels = %v, want channel added", got)
+	}
+}
+
+func TestDescriptorDeclaredLabels(t *testing.T) {
+	fake, mc := startFakeMonitoring(t)
+	cfg := config{projectID: "p", logger: discardLogger, declaredLabels: func(string) []string { return []string{"region", "sku"} }}
+	d := newDescriptorCache(mc, cfg)
+	const typ = "custom.googleapis.com/sold"
+
+	d.ensure(context.Background(), []*monpb.TimeSeries{labelledSeries(typ, map[string]string{"region": "eu"})})
+	if got := fake.labelKeys(typ); !reflect.DeepEqual(got, []string{"region", "sku"}) {
+		t.Errorf("descriptor labels = %v, want the declared keys", got)
+	}
+}
+
+func TestDescriptorDeclaredLabelsAreSanitized(t *testing.T) {
+	fake, mc := startFakeMonitoring(t)
+	cfg := config{projectID: "p", logger: discardLogger, declaredLabels: func(string) []string { return []string{"userId", "User-ID", "region"} }}
+	d := newDescriptorCache(mc, cfg)
+	const typ = "custom.googleapis.com/logins"
+
+	d.ensure(context.Background(), []*monpb.TimeSeries{labelledSeries(typ, map[string]string{"region": "eu"})})
+	if got := fake.labelKeys(typ); !reflect.DeepEqual(got, []string{"region", "user_id", "userid"}) {
+		t.Errorf("descriptor labels = %v, want the keys series carry", got)
+	}
+}
+
+func TestDescriptorExistingIsNotRecreated(t *testing.T) {
+	fake, mc := startFakeMonitoring(t)
+	d := newDescriptorCache(mc, config{projectID: "p", logger: discardLogger})
+	const typ = "custom.googleapis.com/existing"
+	fake.CreateMetricDescriptor(context.Background(), &monpb.CreateMetricDescriptorRequest{
+		Name:             "projects/p",
+		MetricDescriptor: descriptorFor(labelledSeries(typ, nil), map[string]bool{"region": true, "tier": true}),
+	})
+	fake.creates = 0
+
+	d.ensure(context.Background(), []*monpb.TimeSeries{labelledSeries(typ, map[string]string{"region": "eu"})})
+	if fake.gets != 1 || fake.creates != 0 {
+		t.Errorf("%d lookups and %d creates, want 1 and 0", fake.gets, fake.creates)
+	}
+}
+
+func TestDescriptorOwnTimeout(t *testing.T) {
+	fake, mc := startFakeMonitoring(t)
+	d := newDescriptorCache(mc, config{projectID: "p", logger: discardLogger})
+
+	// The export's context is already done, lookups must not inherit that
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d.ensure(ctx, []*monpb.TimeSeries{labelledSeries("custom.googleapis.com/t", nil)})
+	if fake.creates != 1 {
+		t.Errorf("%d creates, want 1 despite the cancelled export context", fake.creates)
+	}
+}
+
+func TestDescriptorNegativeCache(t *testing.T) {
+	fake, mc := startFakeMonitoring(t)
+	fake.getErr = errors.New("unavailable")
+	d := newDescriptorCache(mc, config{projectID: "p", logger: discardLogger, descriptorNegativeTTL: time.Hour})
+	const typ = "custom.googleapis.com/flaky"
+
+	d.ensure(context.Background(), []*monpb.TimeSeries{labelledSeries(typ, nil)})
+	d.ensure(context.Background(), []*monpb.TimeSeries{labelledSeries(typ, map[string]string{"new": "key"})})
+	if fake.gets != 1 {
+		t.Errorf("%d lookups, want the failure cached", fake.gets)
+	}
+}
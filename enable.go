@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// getDisabled reports whether METRICS_DISABLED is set to a true value
+func getDisabled() bool {
+	v, _ := strconv.ParseBool(os.Getenv("METRICS_DISABLED"))
+	return v
+}
+
+// getMetricList returns the comma-separated patterns in env
+func getMetricList(env string) []string {
+	var out []string
+	for _, p := range strings.Split(os.Getenv(env), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// WithAllowedMetrics exports only metrics matching one of patterns, path.Match globs
+// such as "checkout/*" matched against the metric name with or without the namespace.
+// Patterns are also read from METRICS_ALLOW, comma-separated.
+func WithAllowedMetrics(patterns ...string) Option {
+	return func(c *config) {
+		c.allowMetrics = append(c.allowMetrics, patterns...)
+	}
+}
+
+// WithDeniedMetrics drops metrics matching one of patterns, see WithAllowedMetrics. A
+// metric that is both allowed and denied is denied. Patterns are also read from
+// METRICS_DENY, comma-separated.
+func WithDeniedMetrics(patterns ...string) Option {
+	return func(c *config) {
+		c.denyMetrics = append(c.denyMetrics, patterns...)
+	}
+}
+
+// SetEnabled turns exporting on or off at runtime, for shedding metric traffic during
+// an incident. Points recorded while disabled are dropped; counters and histograms keep
+// counting, so their totals are right once enabled again. A Client starts disabled when
+// METRICS_DISABLED is set to a true value.
+func (c *Client) SetEnabled(enabled bool) {
+	c.disabled.Store(!enabled)
+}
+
+// SetMetricFilter replaces the allow and deny patterns of WithAllowedMetrics and
+// WithDeniedMetrics at runtime
+func (c *Client) SetMetricFilter(allow, deny []string) {
+	c.filter.Store(newMetricFilter(allow, deny, c.cfg.namespace))
+}
+
+// metricFilter decides which metric types are exported
+type metricFilter struct {
+	allow, deny []string
+	prefix      string   // metric type prefix with the namespace
+	decisions   sync.Map // metric type to bool, patterns are matched once per type
+}
+
+func newMetricFilter(allow, deny []string, namespace string) *metricFilter {
+	f := &metricFilter{
+		allow:  append([]string(nil), allow...),
+		deny:   append([]string(nil), deny...),
+		prefix: metricTypePrefix,
+	}
+	if namespace != "" {
+		f.prefix += namespace + "/"
+	}
+	return f
+}
+
+// allowed reports whether series of metricType are exported
+func (f *metricFilter) allowed(metricType string) bool {
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return true
+	}
+	if ok, cached := f.decisions.Load(metricType); cached {
+		return ok.(bool)
+	}
+	names := []string{strings.TrimPrefix(metricType, metricTypePrefix), strings.TrimPrefix(metricType, f.prefix)}
+	ok := len(f.allow) == 0 || matchAny(f.allow, names)
+	if ok && matchAny(f.deny, names) {
+		ok = false
+	}
+	f.decisions.Store(metricType, ok)
+	return ok
+}
+
+// matchAny reports whether any of names matches any of patterns
+func matchAny(patterns, names []string) bool {
+	for _, p := range patterns {
+		for _, n := range names {
+			if ok, _ := path.Match(p, n); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// enabledSeries removes the series that are not to be exported, returning nil when the
+// Client is disabled
+func (c *Client) enabledSeries(series []*monpb.TimeSeries) []*monpb.TimeSeries {
+	if c.disabled.Load() {
+		return nil
+	}
+	f := c.filter.Load()
+	kept := series[:0:0]
+	for _, ts := range series {
+		if f.allowed(ts.GetMetric().GetType()) {
+			kept = append(kept, ts)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetEnabled(t *testing.T) {
+	t.Setenv("METRICS_DISABLED", "true")
+	c, exp := newTestClient(t)
+	ctx := context.Background()
+	c.PushMetric(ctx, "orders/open", 1, nil)
+	c.SetEnabled(true)
+	c.PushMetric(ctx, "orders/open", 2, nil)
+
+	got := exp.byType("custom.googleapis.com/orders/open")
+	if len(got) != 1 || got[0].GetPoints()[0].GetValue().GetInt64Value() != 2 {
+		t.Errorf("exported %v, want only the point recorded while enabled", got)
+	}
+}
+
+func TestMetricFilter(t *testing.T) {
+	t.Setenv("METRICS_DENY", "checkout/debug_*")
+	c, exp := newTestClient(t, WithNamespace("shop"), WithAllowedMetrics("checkout/*"))
+	ctx := context.Background()
+	for _, name := range []string{"checkout/orders", "checkout/debug_cache", "search/queries"} {
+		c.PushMetric(ctx, name, 1, nil)
+	}
+	if got := exp.exported(); len(got) != 1 || got[0].GetMetric().GetType() != "custom.googleapis.com/shop/checkout/orders" {
+		t.Errorf("exported %v, want only checkout/orders", got)
+	}
+
+	c.SetMetricFilter(nil, []string{"shop/checkout/*"})
+	c.PushMetric(ctx, "checkout/orders", 1, nil)
+	c.PushMetric(ctx, "search/queries", 1, nil)
+	if got := exp.byType("custom.googleapis.com/shop/search/queries"); len(got) != 1 {
+		t.Errorf("search/queries exported %d times after SetMetricFilter, want 1", len(got))
+	}
+	if got := exp.byType("custom.googleapis.com/shop/checkout/orders"); len(got) != 1 {
+		t.Errorf("checkout/orders exported %d times, want it denied after SetMetricFilter", len(got))
+	}
+}
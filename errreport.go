@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorReport summarizes the export errors seen during one window
+type ErrorReport struct {
+	Start    time.Time
+	End      time.Time
+	Failures int            // failed export calls
+	ByCode   map[string]int // failed calls per gRPC status code
+	ByMetric map[string]int // series in failed calls per metric type
+	Last     string         // message of the most recent error
+}
+
+// WithErrorReport replaces the log line per failed export with a summary of all
+// failures in each window, logged and passed to hook (which may be nil). A window
+// opens at the first failure and the report is produced when it closes.
+func WithErrorReport(window time.Duration, hook func(ErrorReport)) Option {
+	return func(c *config) {
+		c.errorWindow = window
+		c.errorHook = hook
+	}
+}
+
+// errorAggregator collects export errors into ErrorReports
+type errorAggregator struct {
+	window time.Duration
+	hook   func(ErrorReport)
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	report *ErrorReport // nil while no window is open
+	timer  *time.Timer
+}
+
+func newErrorAggregator(window time.Duration, hook func(ErrorReport), logger *slog.Logger) *errorAggregator {
+	return &errorAggregator{window: window, hook: hook, logger: logger}
+}
+
+// record adds one failed export of series to the current window, opening one if needed
+func (a *errorAggregator) record(err error, series []*monpb.TimeSeries) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.report == nil {
+		a.report = &ErrorReport{
+			Start:    time.Now(),
+			ByCode:   make(map[string]int),
+			ByMetric: make(map[string]int),
+		}
+		a.timer = time.AfterFunc(a.window, a.flush)
+	}
+	a.report.Failures++
+	a.report.ByCode[status.Code(err).String()]++
+	for _, ts := range series {
+		a.report.ByMetric[ts.GetMetric().GetType()]++
+	}
+	a.report.Last = err.Error()
+}
+
+// flush closes the current window and publishes its report
+func (a *errorAggregator) flush() {
+	a.mu.Lock()
+	r := a.report
+	a.report = nil
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	a.mu.Unlock()
+	if r == nil {
+		return
+	}
+
+	r.End = time.Now()
+	a.logger.Warn("export errors during window",
+		"window", r.End.Sub(r.Start).Round(time.Second),
+		"failures", r.Failures,
+		"by_code", r.ByCode,
+		"by_metric", r.ByMetric,
+		"last_error", r.Last,
+	)
+	if a.hook != nil {
+		a.hook(*r)
+	}
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// Reporter records the values of one scheduled run, see Every
+type Reporter interface {
+	// Report records a gauge point. Values are converted as for PushMetric.
+	Report(metricName string, value interface{}, labels map[string]string)
+}
+
+// Every runs fn now and then every interval, for publishing snapshot values such as
+// inventory counts or queue backlogs without a ticker and goroutine of one's own. The
+// points fn reports share a timestamp and enter the pipeline together once it returns.
+// Runs never overlap, a run that takes longer than interval delays the next. The context
+// passed to fn is cancelled when the schedule stops: the returned func stops it, and
+// closing the Client stops it too. A zero interval uses the default flush interval.
+func (c *Client) Every(interval time.Duration, fn func(ctx context.Context, r Reporter)) (stop func()) {
+	return c.every(interval, &Scope{}, fn)
+}
+
+// every runs fn on a schedule, placing reported metrics in scope
+func (c *Client) every(interval time.Duration, scope *Scope, fn func(ctx context.Context, r Reporter)) (stop func()) {
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		// Closing the Client cancels a run in progress too
+		select {
+		case <-c.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go func() {
+		defer cancel()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			c.runScheduled(ctx, scope, fn)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(cancel) }
+}
+
+// runScheduled runs fn once and emits what it reported. A panic is logged so one bad
+// run can't stop the schedule.
+func (c *Client) runScheduled(ctx context.Context, scope *Scope, fn func(ctx context.Context, r Reporter)) {
+	r := &reporter{client: c, ctx: ctx, scope: scope, now: time.Now()}
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				c.logger.Error("scheduled report panicked", "panic", p)
+			}
+		}()
+		fn(ctx, r)
+	}()
+
+	r.mu.Lock()
+	series := r.series
+	r.series = nil
+	r.mu.Unlock()
+	if len(series) > 0 {
+		// Export what was reported even if the schedule was stopped during the run
+		c.emit(context.WithoutCancel(ctx), series)
+	}
+}
+
+// reporter collects the points of one scheduled run
+type reporter struct {
+	client *Client
+	ctx    context.Context
+	scope  *Scope
+	now    time.Time
+
+	mu     sync.Mutex // fn may report from several goroutines
+	series []*monpb.TimeSeries
+}
+
+func (r *reporter) Report(metricName string, value interface{}, labels map[string]string) {
+	c := r.client
+	metricName = r.scope.name(metricName)
+	weight, ok := c.sample(metricName)
+	if !ok {
+		return
+	}
+	if !c.spendBudget(r.ctx, metricName, 1) {
+		return
+	}
+	if err := c.registerGauge(metricName, labels); err != nil {
+		return
+	}
+	resource, err := c.contextResource(r.ctx, nil)
+	if err != nil {
+		c.logger.Error("dropping scheduled point with invalid resource", "metric", metricName, "error", err)
+		return
+	}
+	prepared := c.prepareLabels(metricName, weighted(c.withContextLabels(r.ctx, labels), weight))
+	ts, err := c.buildGauge(r.now, resource, metricName, c.declaredDuration(metricName, value), prepared)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	r.series = append(r.series, ts)
+	r.mu.Unlock()
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEveryReportsAndStops(t *testing.T) {
+	c, exp := newTestClient(t)
+	var runs atomic.Int32
+	stop := c.Every(10*time.Millisecond, func(ctx context.Context, r Reporter) {
+		n := runs.Add(1)
+		if n == 2 {
+			panic("bad run")
+		}
+		r.Report("inventory/count", int(n), map[string]string{"sku": "a"})
+		r.Report("inventory/backlog", 1, nil)
+	})
+	if !waitFor(t, func() bool { return runs.Load() >= 3 }) {
+		t.Fatal("schedule stopped after a panicking run")
+	}
+	stop()
+	stop() // stopping twice is safe
+
+	got := exp.byType("custom.googleapis.com/inventory/count")
+	if len(got) == 0 || got[0].GetPoints()[0].GetValue().GetInt64Value() != 1 {
+		t.Fatalf("exported %v, want the first run's point first", got)
+	}
+	backlog := exp.byType("custom.googleapis.com/inventory/backlog")
+	if !got[0].GetPoints()[0].GetInterval().GetEndTime().AsTime().Equal(backlog[0].GetPoints()[0].GetInterval().GetEndTime().AsTime()) {
+		t.Error("points of one run don't share a timestamp")
+	}
+
+	n := runs.Load()
+	time.Sleep(30 * time.Millisecond)
+	if runs.Load() > n+1 {
+		t.Error("schedule kept running after stop")
+	}
+}
+
+func TestEveryCancelledOnClose(t *testing.T) {
+	c, exp := newTestClient(t)
+	started := make(chan struct{})
+	c.Every(time.Hour, func(ctx context.Context, r Reporter) {
+		close(started)
+		<-ctx.Done()
+		r.Report("shutdown/report", 1, nil)
+	})
+	<-started
+	done := make(chan struct{})
+	go func() {
+		c.Close()
+		close(done)
+	}()
+	if !waitFor(t, func() bool { return len(exp.byType("custom.googleapis.com/shutdown/report")) == 1 }) {
+		t.Error("run in progress was not cancelled by Close, or its point was lost")
+	}
+	<-done
+}
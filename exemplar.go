@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	distpb "google.golang.org/genproto/googleapis/api/distribution"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// exemplar is an example observation kept for one histogram bucket
+type exemplar struct {
+	value       float64
+	at          time.Time
+	span        trace.SpanContext
+	attachments map[string]string
+}
+
+// ObserveExemplar records v like Observe and keeps it as its bucket's exemplar, so
+// heatmaps in the console can link to an example request. The trace is taken from
+// the OpenTelemetry span in ctx, if it is sampled, and attachments are shown with the
+// exemplar. Observe already keeps exemplars for observations made inside a sampled
+// span; ObserveExemplar adds attachments and records one even without a span.
+//
+// Each bucket holds the latest exemplar since the last flush, and exemplars are
+// published once, with the point of the flush that follows them.
+func (h *Histogram) ObserveExemplar(ctx context.Context, v float64, labels, attachments map[string]string) {
+	h.observe(ctx, v, labels, &exemplar{value: v, at: time.Now(), span: trace.SpanContextFromContext(ctx), attachments: attachments})
+}
+
+// exemplarFromSpan returns an exemplar for v if ctx carries a sampled span
+func exemplarFromSpan(ctx context.Context, v float64) *exemplar {
+	span := trace.SpanContextFromContext(ctx)
+	if !span.IsValid() || !span.IsSampled() {
+		return nil
+	}
+	return &exemplar{value: v, at: time.Now(), span: span}
+}
+
+// proto converts e, linking the trace in projectID
+func (e *exemplar) proto(projectID string) *distpb.Distribution_Exemplar {
+	out := &distpb.Distribution_Exemplar{Value: e.value, Timestamp: timestamppb.New(pointTime(e.at))}
+	if e.span.IsValid() {
+		spanName := "projects/" + projectID + "/traces/" + e.span.TraceID().String() + "/spans/" + e.span.SpanID().String()
+		if a, err := anypb.New(&monpb.SpanContext{SpanName: spanName}); err == nil {
+			out.Attachments = append(out.Attachments, a)
+		}
+	}
+	if len(e.attachments) > 0 {
+		if a, err := anypb.New(&monpb.DroppedLabels{Label: e.attachments}); err == nil {
+			out.Attachments = append(out.Attachments, a)
+		}
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"context"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// Exporter delivers batches of time series to a metrics backend. Batches hold at most
+// one point per series and at most 200 series. Export errors carrying a gRPC status
+// are classified the way Cloud Monitoring's are when deciding whether to retry. The
+// Client never reuses series passed to an Exporter given with WithExporter, so it may
+// keep them, but must not modify them: messages such as Metric are shared between series.
+type Exporter interface {
+	Export(ctx context.Context, series []*monpb.TimeSeries) error
+	Close() error
+}
+
+// WithExporter sends metrics to e instead of Cloud Monitoring. The Client closes e when it is closed.
+func WithExporter(e Exporter) Option {
+	return func(c *config) {
+		c.exporter = e
+	}
+}
+
+// newExporter returns the exporters cfg asks for, Cloud Monitoring by default
+func newExporter(ctx context.Context, cfg config) (Exporter, error) {
+	primary, err := newPrimaryExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	exporters := []Exporter{primary}
+	fail := func(err error) (Exporter, error) {
+		for _, e := range exporters {
+			e.Close()
+		}
+		return nil, err
+	}
+
+	if cfg.pubsub != nil {
+		pcfg := *cfg.pubsub
+		if pcfg.ProjectID == "" {
+			pcfg.ProjectID = cfg.projectID
+		}
+		ps, err := NewPubSubExporter(ctx, pcfg)
+		if err != nil {
+			return fail(err)
+		}
+		exporters = append(exporters, ps)
+	}
+	if cfg.bigquery != nil {
+		bcfg := *cfg.bigquery
+		if bcfg.ProjectID == "" {
+			bcfg.ProjectID = cfg.projectID
+		}
+		bq, err := NewBigQueryExporter(ctx, bcfg)
+		if err != nil {
+			return fail(err)
+		}
+		exporters = append(exporters, bq)
+	}
+
+	if len(exporters) == 1 {
+		return primary, nil
+	}
+	return &fanoutExporter{exporters: exporters}, nil
+}
+
+// newPrimaryExporter returns the exporter points are classified and retried by
+func newPrimaryExporter(ctx context.Context, cfg config) (Exporter, error) {
+	switch {
+	case cfg.exporter != nil:
+		return cfg.exporter, nil
+	case cfg.statsd != nil:
+		return NewStatsDExporter(*cfg.statsd)
+	case cfg.otlp != nil:
+		return NewOTLPExporter(*cfg.otlp)
+	case cfg.dryRun != nil:
+		return NewJSONExporter(cfg.dryRun), nil
+	}
+	if dd, ok := getDatadog(); ok {
+		return NewDatadogExporter(dd), nil
+	}
+	if oc, ok := getOTLP(); ok {
+		return NewOTLPExporter(oc)
+	}
+	return newCloudMonitoringExporter(ctx, cfg)
+}
+
+// cloudMonitoringExporter writes time series with CreateTimeSeries
+type cloudMonitoringExporter struct {
+	projectID   string
+	client      *monitoring.MetricClient
+	release     func() error
+	descriptors *descriptorCache
+}
+
+func newCloudMonitoringExporter(ctx context.Context, cfg config) (*cloudMonitoringExporter, error) {
+	mc, release, err := connect(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &cloudMonitoringExporter{
+		projectID:   cfg.projectID,
+		client:      mc,
+		release:     release,
+		descriptors: newDescriptorCache(mc, cfg),
+	}, nil
+}
+
+func (e *cloudMonitoringExporter) Export(ctx context.Context, series []*monpb.TimeSeries) error {
+	e.descriptors.ensure(ctx, series)
+	req := &monpb.CreateTimeSeriesRequest{
+		Name:       "projects/" + e.projectID,
+		TimeSeries: series,
+	}
+	return e.client.CreateTimeSeries(ctx, req)
+}
+
+func (e *cloudMonitoringExporter) Close() error {
+	return e.release()
+}
+
+// connect returns the connection to Cloud Monitoring for cfg, shared unless a dedicated
+// one was asked for or client options make it unique
+func connect(ctx context.Context, cfg config) (*monitoring.MetricClient, func() error, error) {
+	if cfg.metricClient != nil {
+		return cfg.metricClient, func() error { return nil }, nil // owned by the caller
+	}
+	opts := monitoringOptions(cfg)
+	if cfg.dedicatedConn || len(cfg.clientOptions) > 0 {
+		mc, err := monitoring.NewMetricClient(ctx, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return mc, mc.Close, nil
+	}
+	return acquireConn(ctx, connKeyFor(cfg), func(ctx context.Context) (*monitoring.MetricClient, error) {
+		return monitoring.NewMetricClient(ctx, opts...) // Connection to cloud monitoring
+	})
+}
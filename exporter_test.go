@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3"
+	"google.golang.org/api/option"
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// fakeMonitoring is an in-process Cloud Monitoring metric service
+type fakeMonitoring struct {
+	monpb.UnimplementedMetricServiceServer
+
+	mu          sync.Mutex
+	descriptors map[string]*mpb.MetricDescriptor
+	gets        int
+	creates     int
+	getErr      error
+	written     []*monpb.TimeSeries
+	listed      []*monpb.ListTimeSeriesRequest
+}
+
+func (f *fakeMonitoring) GetMetricDescriptor(ctx context.Context, req *monpb.GetMetricDescriptorRequest) (*mpb.MetricDescriptor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gets++
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	for _, d := range f.descriptors {
+		if req.GetName() == d.GetName() {
+			return proto.Clone(d).(*mpb.MetricDescriptor), nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "no descriptor")
+}
+
+func (f *fakeMonitoring) CreateMetricDescriptor(ctx context.Context, req *monpb.CreateMetricDescriptorRequest) (*mpb.MetricDescriptor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.creates++
+	d := proto.Clone(req.GetMetricDescriptor()).(*mpb.MetricDescriptor)
+	d.Name = req.GetName() + "/metricDescriptors/" + d.GetType()
+	f.descriptors[d.GetType()] = d
+	return d, nil
+}
+
+func (f *fakeMonitoring) CreateTimeSeries(ctx context.Context, req *monpb.CreateTimeSeriesRequest) (*emptypb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.written = append(f.written, req.GetTimeSeries()...)
+	return &emptypb.Empty{}, nil
+}
+
+// labelKeys returns the label keys of the descriptor for metricType
+func (f *fakeMonitoring) labelKeys(metricType string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for _, l := range f.descriptors[metricType].GetLabels() {
+		keys = append(keys, l.GetKey())
+	}
+	return keys
+}
+
+// startFakeMonitoring serves a fakeMonitoring on localhost and returns a client for it
+func startFakeMonitoring(t *testing.T) (*fakeMonitoring, *monitoring.MetricClient) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeMonitoring{descriptors: make(map[string]*mpb.MetricDescriptor)}
+	srv := grpc.NewServer()
+	monpb.RegisterMetricServiceServer(srv, fake)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	mc, err := monitoring.NewMetricClient(context.Background(),
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mc.Close() })
+	return fake, mc
+}
+
+func TestCloudMonitoringExporter(t *testing.T) {
+	fake, mc := startFakeMonitoring(t)
+	c, err := New(context.Background(), WithProjectID("test-project"), WithLogger(discardLogger), WithMetricClient(mc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.TryPushMetric(context.Background(), "orders/open", 2.5, map[string]string{"region": "eu"}); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.written) != 1 || fake.written[0].GetPoints()[0].GetValue().GetDoubleValue() != 2.5 {
+		t.Fatalf("written = %v", fake.written)
+	}
+	d := fake.descriptors["custom.googleapis.com/orders/open"]
+	if d.GetMetricKind() != mpb.MetricDescriptor_GAUGE || d.GetValueType() != mpb.MetricDescriptor_DOUBLE {
+		t.Errorf("descriptor = %v", d)
+	}
+}
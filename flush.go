@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultFlushInterval is how often gauge callbacks are sampled when no flush interval is set
+const defaultFlushInterval = time.Minute
+
+// WithFlushInterval buffers points in memory and exports them from a background
+// goroutine every d, instead of calling Cloud Monitoring inside PushMetric. Only the
+// latest point per series is kept between flushes. Cloud Monitoring accepts at most
+// one point per series every 5 seconds, so d should not be shorter than that.
+func WithFlushInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.flushInterval = d
+	}
+}
+
+// pointBuffer holds the latest point of each series until the next flush
+type pointBuffer struct {
+	mu     sync.Mutex
+	series map[string]*monpb.TimeSeries
+	order  []string
+}
+
+func newPointBuffer() *pointBuffer {
+	return &pointBuffer{series: make(map[string]*monpb.TimeSeries)}
+}
+
+// add buffers series, replacing any earlier point for the same series
+func (b *pointBuffer) add(series []*monpb.TimeSeries) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ts := range series {
+		key := seriesIdentity(ts)
+		if _, ok := b.series[key]; !ok {
+			b.order = append(b.order, key)
+		}
+		b.series[key] = ts
+	}
+}
+
+// len returns how many series are buffered
+func (b *pointBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.order)
+}
+
+// snapshot returns copies of everything buffered without removing it. Copies, since
+// the buffered series are reused once a flush has exported them.
+func (b *pointBuffer) snapshot() []*monpb.TimeSeries {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]*monpb.TimeSeries, 0, len(b.order))
+	for _, key := range b.order {
+		out = append(out, proto.Clone(b.series[key]).(*monpb.TimeSeries))
+	}
+	return out
+}
+
+// drain removes and returns everything buffered, in first-recorded order
+func (b *pointBuffer) drain() []*monpb.TimeSeries {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]*monpb.TimeSeries, 0, len(b.order))
+	for _, key := range b.order {
+		out = append(out, b.series[key])
+	}
+	b.series = make(map[string]*monpb.TimeSeries, len(b.order))
+	b.order = nil
+	return out
+}
+
+// collector produces series on every flush, from state kept between flushes
+type collector interface {
+	collect(c *Client, now time.Time) []*monpb.TimeSeries
+}
+
+// register adds col to the collectors run on every flush and starts the flusher.
+// The returned func removes it again.
+func (c *Client) register(col collector) (unregister func()) {
+	unregister, _ = c.registerUnless(col, nil)
+	return unregister
+}
+
+// registerUnless is register, but refuses col if taken reports true for a collector
+// already registered
+func (c *Client) registerUnless(col collector, taken func(collector) bool) (unregister func(), ok bool) {
+	c.collectMu.Lock()
+	if taken != nil {
+		for _, other := range c.collectors {
+			if taken(other) {
+				c.collectMu.Unlock()
+				return func() {}, false
+			}
+		}
+	}
+	id := c.nextCollector
+	c.nextCollector++
+	c.collectors[id] = col
+	c.collectMu.Unlock()
+
+	c.startFlusher()
+	return func() {
+		c.collectMu.Lock()
+		delete(c.collectors, id)
+		c.collectMu.Unlock()
+	}, true
+}
+
+// collect runs every registered collector
+func (c *Client) collect() []*monpb.TimeSeries {
+	c.collectMu.Lock()
+	cols := make([]collector, 0, len(c.collectors))
+	for _, col := range c.collectors {
+		cols = append(cols, col)
+	}
+	c.collectMu.Unlock()
+
+	now := time.Now()
+	var series []*monpb.TimeSeries
+	for _, col := range cols {
+		series = append(series, col.collect(c, now)...)
+	}
+	return series
+}
+
+// gaugeFunc is a callback sampled on every flush
+type gaugeFunc struct {
+	name   string
+	labels map[string]string
+	fn     func() float64
+}
+
+// RegisterGaugeFunc samples fn once per flush interval and publishes the result as a gauge.
+// The returned func unregisters the callback. A second callback for the same metric and
+// labels is refused, since two points for one series would fail the whole export.
+func (c *Client) RegisterGaugeFunc(metricName string, labels map[string]string, fn func() float64) (unregister func()) {
+	_, err := c.claim(metricName, KindGaugeFunc)
+	if err == nil && !c.checkLabels(metricName, labels) {
+		err = fmt.Errorf("%w: %q registered with label keys %v", ErrMetricConflict, metricName, sortedKeys(labels))
+	}
+	if err != nil {
+		c.logger.Error("could not register gauge callback", "metric", metricName, "error", err)
+		return func() {}
+	}
+
+	g := &gaugeFunc{
+		name:   sanitizeMetricName(c.logger, metricName),
+		labels: make(map[string]string, len(labels)),
+		fn:     fn,
+	}
+	for k, v := range labels {
+		g.labels[k] = v
+	}
+
+	key := seriesKey(g.labels)
+	unregister, ok := c.registerUnless(g, func(col collector) bool {
+		other, ok := col.(*gaugeFunc)
+		return ok && other.name == g.name && seriesKey(other.labels) == key
+	})
+	if !ok {
+		err := fmt.Errorf("%w: %q already has a callback for labels %v", ErrMetricConflict, metricName, labels)
+		c.logger.Error("could not register gauge callback", "metric", metricName, "error", err)
+	}
+	return unregister
+}
+
+// collect calls the callback and builds its series
+func (g *gaugeFunc) collect(c *Client, now time.Time) []*monpb.TimeSeries {
+	v, err := g.sample()
+	if err != nil {
+		c.logger.Error("gauge callback failed", "metric", g.name, "error", err)
+		return nil
+	}
+	if ts, err := c.buildGauge(now, nil, g.name, v, c.prepareLabels(g.name, g.labels)); err == nil {
+		return []*monpb.TimeSeries{ts}
+	}
+	return nil
+}
+
+// sample runs the callback, turning a panic into an error so one bad gauge can't stop the flusher
+func (g *gaugeFunc) sample() (v float64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return g.fn(), nil
+}
+
+// startFlusher starts the background flush loop if it isn't running yet
+func (c *Client) startFlusher() {
+	c.flusherOnce.Do(func() {
+		interval := c.cfg.flushInterval
+		if interval <= 0 {
+			interval = defaultFlushInterval
+		}
+		c.flusherRunning = true
+		go c.runFlusher(interval)
+	})
+}
+
+// runFlusher flushes every interval until Close stops it
+func (c *Client) runFlusher(interval time.Duration) {
+	defer close(c.flushDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Flush(context.Background())
+		case <-c.stopFlush:
+			return
+		}
+	}
+}
+
+// stopFlusher stops the background flush loop and waits for it to exit
+func (c *Client) stopFlusher() {
+	// Running the Once here keeps a later RegisterGaugeFunc from starting a new loop
+	c.flusherOnce.Do(func() {})
+	if c.flusherRunning {
+		close(c.stopFlush)
+		<-c.flushDone
+	}
+}
+
+// Flush samples gauge callbacks, publishes counters and exports everything buffered, returning once the
+// exports, including detached ones already in flight, finish
+func (c *Client) Flush(ctx context.Context) {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+	defer func() { c.lastFlush.Store(time.Now().UnixNano()) }()
+	defer c.inflight.wait()
+	ctx, span := c.tracer.Start(ctx, "metrics.flush")
+	defer span.End()
+
+	if collected := c.collect(); len(collected) > 0 {
+		c.emit(ctx, collected)
+	}
+	c.flushClasses(ctx)
+	if c.buffer == nil {
+		return
+	}
+	if c.wal != nil {
+		c.recordDuplicates(ctx, c.wal.replay(ctx, c.export))
+	}
+	if series := c.buffer.drain(); len(series) > 0 {
+		c.send(ctx, series)
+	}
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestPointBufferKeepsLatestPoint(t *testing.T) {
+	b := newPointBuffer()
+	b.add([]*monpb.TimeSeries{
+		gaugePoint("custom.googleapis.com/a", map[string]string{"k": "1"}, 1),
+		gaugePoint("custom.googleapis.com/b", nil, 2),
+		gaugePoint("custom.googleapis.com/a", map[string]string{"k": "1"}, 3),
+	})
+	if n := b.len(); n != 2 {
+		t.Fatalf("len = %d, want 2", n)
+	}
+
+	snap := b.snapshot()
+	snap[0].Points[0].Value = doubleValue(99)
+	if b.len() != 2 {
+		t.Error("snapshot removed buffered series")
+	}
+
+	got := b.drain()
+	if len(got) != 2 || got[0].GetMetric().GetType() != "custom.googleapis.com/a" {
+		t.Fatalf("drain = %v, want a then b", got)
+	}
+	if v := got[0].GetPoints()[0].GetValue().GetDoubleValue(); v != 3 {
+		t.Errorf("a = %v, want the latest point 3", v)
+	}
+	if b.len() != 0 {
+		t.Error("drain left series buffered")
+	}
+}
+
+func TestFlushIntervalBuffersUntilFlush(t *testing.T) {
+	c, exp := newTestClient(t, WithFlushInterval(time.Hour))
+	ctx := context.Background()
+	c.PushMetric(ctx, "queue/depth", 1, nil)
+	c.PushMetric(ctx, "queue/depth", 2, nil)
+	if n := len(exp.exported()); n != 0 {
+		t.Fatalf("exported %d series before the flush", n)
+	}
+
+	c.Flush(ctx)
+	got := exp.byType("custom.googleapis.com/queue/depth")
+	if len(got) != 1 {
+		t.Fatalf("exported %d series, want 1", len(got))
+	}
+	if v := got[0].GetPoints()[0].GetValue().GetInt64Value(); v != 2 {
+		t.Errorf("value = %d, want 2", v)
+	}
+}
+
+func TestGaugeFuncPanicIsContained(t *testing.T) {
+	c, exp := newTestClient(t)
+	c.RegisterGaugeFunc("bad/gauge", nil, func() float64 { panic("boom") })
+	unregister := c.RegisterGaugeFunc("good/gauge", nil, func() float64 { return 7 })
+
+	c.Flush(context.Background())
+	if got := exp.byType("custom.googleapis.com/good/gauge"); len(got) != 1 || got[0].GetPoints()[0].GetValue().GetDoubleValue() != 7 {
+		t.Fatalf("good gauge = %v", got)
+	}
+	if got := exp.byType("custom.googleapis.com/bad/gauge"); len(got) != 0 {
+		t.Errorf("panicking gauge exported %v", got)
+	}
+
+	unregister()
+	c.Flush(context.Background())
+	if got := exp.byType("custom.googleapis.com/good/gauge"); len(got) != 1 {
+		t.Errorf("unregistered gauge sampled again, %d points", len(got))
+	}
+}
+
+func TestRegisterGaugeFuncRefusesDuplicateSeries(t *testing.T) {
+	c, exp := newTestClient(t)
+	c.RegisterGaugeFunc("pool/size", map[string]string{"pool": "db"}, func() float64 { return 1 })
+	c.RegisterGaugeFunc("pool/size", map[string]string{"pool": "db"}, func() float64 { return 2 })
+	c.RegisterGaugeFunc("pool/size", map[string]string{"pool": "cache"}, func() float64 { return 3 })
+
+	c.Flush(context.Background())
+	series := exp.byType("custom.googleapis.com/pool/size")
+	got := byLabel(series, "pool")
+	if len(series) != 2 || got["db"].GetPoints()[0].GetValue().GetDoubleValue() != 1 {
+		t.Errorf("exported %v, want the first db callback and the cache one", got)
+	}
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Metrics recorded by the Cloud Functions wrappers
+const (
+	functionInvocations = "function/invocations"
+	functionDuration    = "function/execution_times"
+)
+
+// minFunctionFlushGap keeps flushes from the wrappers at least as far apart as Cloud
+// Monitoring's minimum sampling period, so busy instances don't have points rejected
+const minFunctionFlushGap = 5 * time.Second
+
+// functionMetrics are the instruments shared by every wrapped function
+type functionMetrics struct {
+	client      *Client
+	invocations *Counter
+	duration    *Histogram
+	gap         time.Duration // minFunctionFlushGap
+
+	mu        sync.Mutex
+	lastFlush time.Time
+	deferred  *time.Timer // flushes invocations that came too soon after the last flush
+}
+
+var (
+	functionInit sync.Once
+	functionInst *functionMetrics
+)
+
+// functionInstruments initializes the package-level client and the wrapper instruments,
+// at cold start when called from a function's init
+func functionInstruments() *functionMetrics {
+	functionInit.Do(func() {
+		initClient(context.Background())
+		if defaultClient == nil {
+			return // metrics disabled
+		}
+		functionInst = newFunctionMetrics(defaultClient)
+	})
+	return functionInst
+}
+
+func newFunctionMetrics(c *Client) *functionMetrics {
+	return &functionMetrics{
+		client:      c,
+		invocations: c.NewCounter(functionInvocations),
+		duration:    c.NewHistogram(functionDuration, DefaultLatencyBuckets),
+		gap:         minFunctionFlushGap,
+	}
+}
+
+// record counts one invocation and flushes, since background work is unreliable once
+// Cloud Functions has sent the response. An invocation ending within the minimum gap of
+// the last flush schedules a flush for when the gap is over instead, so its points
+// aren't left waiting for another invocation; if the instance is frozen before then, the
+// flush runs when it thaws.
+func (f *functionMetrics) record(ctx context.Context, name, status string, took time.Duration, extra map[string]string) {
+	if f == nil {
+		return // metrics disabled
+	}
+	labels := map[string]string{"function_name": name, "status": status}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	f.invocations.Add(ctx, 1, labels)
+	f.duration.Observe(ctx, float64(took)/float64(time.Millisecond), labels)
+
+	f.mu.Lock()
+	wait := f.gap - time.Since(f.lastFlush)
+	if wait <= 0 {
+		f.lastFlush = time.Now()
+		if f.deferred != nil {
+			f.deferred.Stop() // this flush covers its points
+			f.deferred = nil
+		}
+	} else if f.deferred == nil {
+		f.deferred = time.AfterFunc(wait, f.deferredFlush)
+	}
+	f.mu.Unlock()
+	if wait <= 0 {
+		f.client.Flush(ctx)
+	}
+}
+
+// deferredFlush flushes the invocations recorded since the last flush
+func (f *functionMetrics) deferredFlush() {
+	f.mu.Lock()
+	f.deferred = nil
+	f.lastFlush = time.Now()
+	f.mu.Unlock()
+	select {
+	case <-f.client.closed:
+		return // Close flushed already
+	default:
+	}
+	f.client.Flush(context.Background())
+}
+
+// WrapHTTP instruments an HTTP function for the functions framework:
+//
+//	func init() {
+//		functions.HTTP("Buy", metrics.WrapHTTP("Buy", buy))
+//	}
+//
+// Each invocation adds to function/invocations and function/execution_times (in ms),
+// labelled with the function name, status ("ok" or "error", for 5xx responses and
+// panics) and response code class such as "2xx". Metrics are flushed before the
+// wrapper returns, at most every 5 seconds; an invocation ending sooner after the last
+// flush has its points flushed once the 5 seconds are up. Panics are recorded and
+// re-raised. The request is attached to the handler's context for label extractors,
+// see HeaderLabels.
+func WrapHTTP(name string, h http.HandlerFunc) http.HandlerFunc {
+	f := functionInstruments()
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(ContextWithRequest(r.Context(), r))
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		started := time.Now()
+		defer func() {
+			p := recover()
+			status := "ok"
+			if p != nil || rec.code >= 500 {
+				status = "error"
+			}
+			code := strconv.Itoa(rec.code/100) + "xx"
+			if p != nil {
+				code = "panic"
+			}
+			f.record(r.Context(), name, status, time.Since(started), map[string]string{"code": code})
+			if p != nil {
+				panic(p)
+			}
+		}()
+		h(rec, r)
+	}
+}
+
+// WrapCloudEvent instruments a CloudEvent function the way WrapHTTP does an HTTP one.
+// E is the framework's event type, so this package needs no CloudEvents dependency:
+//
+//	functions.CloudEvent("OnOrder", metrics.WrapCloudEvent("OnOrder", onOrder))
+//
+// Invocations returning an error, or panicking, have status "error".
+func WrapCloudEvent[E any](name string, fn func(context.Context, E) error) func(context.Context, E) error {
+	f := functionInstruments()
+	return func(ctx context.Context, e E) (err error) {
+		started := time.Now()
+		defer func() {
+			p := recover()
+			status := "ok"
+			if p != nil || err != nil {
+				status = "error"
+			}
+			f.record(ctx, name, status, time.Since(started), map[string]string{"code": "event"})
+			if p != nil {
+				panic(p)
+			}
+		}()
+		return fn(ctx, e)
+	}
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.code, r.wroteHeader = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFunctionTrailingInvocationIsFlushed(t *testing.T) {
+	c, exp := newTestClient(t)
+	f := newFunctionMetrics(c)
+	f.gap = 50 * time.Millisecond
+	ctx := context.Background()
+
+	total := func() int64 {
+		var n int64
+		for _, ts := range exp.byType("custom.googleapis.com/" + functionInvocations) {
+			if v := ts.GetPoints()[0].GetValue().GetInt64Value(); v > n {
+				n = v
+			}
+		}
+		return n
+	}
+
+	f.record(ctx, "Buy", "ok", time.Millisecond, nil)
+	if total() != 1 {
+		t.Fatalf("first invocation not flushed before returning, total %d", total())
+	}
+	f.record(ctx, "Buy", "ok", time.Millisecond, nil) // inside the gap
+	f.record(ctx, "Buy", "ok", time.Millisecond, nil)
+	if total() != 1 {
+		t.Fatalf("flushed inside the minimum gap, total %d", total())
+	}
+	if !waitFor(t, func() bool { return total() == 3 }) {
+		t.Fatalf("trailing invocations never flushed, total %d", total())
+	}
+}
+
+func TestWrapHTTPStatus(t *testing.T) {
+	exp := packageClient(t)
+	h := WrapHTTP("wraptest", func(w http.ResponseWriter, r *http.Request) {
+		if RequestFromContext(r.Context()) == nil {
+			t.Error("request not attached to the context")
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var found bool
+	for _, ts := range exp.byType("custom.googleapis.com/" + functionInvocations) {
+		l := ts.GetMetric().GetLabels()
+		if l["function_name"] == "wraptest" {
+			found = true
+			if l["status"] != "error" || l["code"] != "5xx" {
+				t.Errorf("labels = %v, want status error and code 5xx", l)
+			}
+		}
+	}
+	if !found {
+		t.Error("invocation not flushed before the wrapper returned")
+	}
+}
+
+func TestWrapCloudEventPanics(t *testing.T) {
+	packageClient(t)
+	fn := WrapCloudEvent("eventtest", func(ctx context.Context, e string) error {
+		if e == "panic" {
+			panic("boom")
+		}
+		return errors.New("failed")
+	})
+	if err := fn(context.Background(), "x"); err == nil {
+		t.Error("error from the function was swallowed")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("panic was not re-raised")
+		}
+	}()
+	fn(context.Background(), "panic")
+}
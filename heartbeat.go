@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// heartbeatMetric is the metric StartHeartbeat publishes, in seconds since the heartbeat started
+const heartbeatMetric = "heartbeat/uptime_seconds"
+
+// getServiceVersion returns the deployed version from env, preferring an explicit SERVICE_VERSION
+// over the revision Cloud Run and Cloud Functions set
+func getServiceVersion() string {
+	if v := os.Getenv("SERVICE_VERSION"); v != "" {
+		return v
+	}
+	if v := os.Getenv("K_REVISION"); v != "" {
+		return v
+	}
+	return "unknown"
+}
+
+// getInstanceID returns a name for this instance, the hostname is unique per Cloud Run instance
+func getInstanceID() string {
+	if h, err := os.Hostname(); err == nil && h != "" {
+		return h
+	}
+	return "unknown"
+}
+
+// StartHeartbeat publishes an uptime gauge every interval, labelled with the service version
+// and instance, so alerts can fire when an instance stops reporting. Labels given here are
+// added to, and can override, the version and instance labels. The returned func stops it;
+// closing the Client stops it too. A zero interval uses the default flush interval.
+func (c *Client) StartHeartbeat(interval time.Duration, labels map[string]string) (stop func()) {
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	hb := map[string]string{
+		"version":  getServiceVersion(),
+		"instance": getInstanceID(),
+	}
+	for k, v := range labels {
+		hb[k] = v
+	}
+
+	started := time.Now()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			c.PushMetric(context.Background(), heartbeatMetric, time.Since(started).Seconds(), hb)
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			case <-c.closed:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartHeartbeat(t *testing.T) {
+	c, exp := newTestClient(t)
+	stop := c.StartHeartbeat(10*time.Millisecond, map[string]string{"instance": "i-1", "zone": "a"})
+	time.Sleep(35 * time.Millisecond)
+	stop()
+	stop() // stopping twice is safe
+
+	got := exp.byType("custom.googleapis.com/" + heartbeatMetric)
+	if len(got) < 2 {
+		t.Fatalf("exported %d heartbeats, want at least 2", len(got))
+	}
+	labels := got[0].GetMetric().GetLabels()
+	if labels["instance"] != "i-1" || labels["zone"] != "a" || labels["version"] == "" {
+		t.Errorf("labels = %v", labels)
+	}
+
+	n := len(exp.exported())
+	time.Sleep(25 * time.Millisecond)
+	if len(exp.exported()) != n {
+		t.Error("heartbeat kept publishing after stop")
+	}
+}
+
+func TestStartHeartbeatNonPositiveInterval(t *testing.T) {
+	c, exp := newTestClient(t)
+	for _, interval := range []time.Duration{0, -time.Second} {
+		stop := c.StartHeartbeat(interval, nil) // must not panic
+		defer stop()
+	}
+	if !waitFor(t, func() bool { return len(exp.exported()) >= 2 }) {
+		t.Error("heartbeats with a defaulted interval did not publish their first point")
+	}
+}
@@ -0,0 +1,209 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	distpb "google.golang.org/genproto/googleapis/api/distribution"
+	gcprpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// Histogram is a cumulative DISTRIBUTION metric with explicit bucket bounds, such as
+// request latencies. Like a Counter, each label set is its own series with a start time
+// set when it is first recorded, and histograms are published on every flush.
+type Histogram struct {
+	client  *Client
+	name    string
+	buckets Buckets
+
+	mu       sync.Mutex
+	series   map[string]*histogramSeries
+	resource *gcprpb.MonitoredResource // nil for the global resource
+}
+
+// histogramSeries is the running state of one label set
+type histogramSeries struct {
+	labels   map[string]string
+	resource *gcprpb.MonitoredResource
+	start    time.Time
+	counts   []int64 // len(buckets)+1, the last is the overflow bucket
+	count    int64
+	mean     float64
+	m2       float64 // sum of squared deviations from the mean
+	carry    float64 // fraction of a sampled observation not yet counted
+	lastEnd  time.Time
+
+	exemplars []*exemplar // per bucket, since the last flush
+}
+
+// NewHistogram returns a histogram published on every flush. Invalid buckets are
+// replaced by DefaultLatencyBuckets with an error logged. Histograms are shared by name
+// like counters; a second NewHistogram for the same metric keeps the first one's buckets.
+func (c *Client) NewHistogram(metricName string, buckets Buckets) *Histogram {
+	existing, err := c.claim(metricName, KindHistogram)
+	if err != nil {
+		c.logger.Error("could not create histogram", "metric", metricName, "error", err)
+		return &Histogram{name: metricName}
+	}
+	if existing != nil {
+		h := existing.(*Histogram)
+		if !slices.Equal(h.buckets, buckets) {
+			c.logger.Warn("histogram already exists with other buckets, keeping them", "metric", metricName, "buckets", h.buckets)
+		}
+		return h
+	}
+
+	if err := buckets.Validate(); err != nil {
+		c.logger.Error("invalid histogram buckets, using the default latency buckets", "metric", metricName, "error", err)
+		buckets = DefaultLatencyBuckets
+	}
+	h := &Histogram{client: c, name: metricName, buckets: append(Buckets(nil), buckets...), series: make(map[string]*histogramSeries)}
+	c.remember(metricName, h, h.buckets)
+	c.register(h)
+	return h
+}
+
+// Observe records v in the distribution for labels; NaN and infinite values are ignored.
+// Inside a sampled OpenTelemetry span the observation may be kept as an exemplar, see
+// ObserveExemplar.
+func (h *Histogram) Observe(ctx context.Context, v float64, labels map[string]string) {
+	h.observe(ctx, v, labels, exemplarFromSpan(ctx, v))
+}
+
+func (h *Histogram) observe(ctx context.Context, v float64, labels map[string]string, ex *exemplar) {
+	if h.client == nil { // nil when metrics are disabled
+		return
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		h.client.logger.Warn("ignoring non-finite histogram observation", "metric", h.name, "value", v)
+		return
+	}
+	weight, ok := h.client.sample(h.name)
+	if !ok || !h.client.spendBudget(ctx, h.name, 1) || !h.client.checkLabels(h.name, labels) {
+		return
+	}
+	prepared := h.client.prepareLabels(h.name, h.client.withContextLabels(ctx, labels))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	resource, err := h.client.contextResource(ctx, h.resource)
+	if err != nil {
+		h.client.logger.Error("dropping observation with invalid resource", "metric", h.name, "error", err)
+		return
+	}
+	key := resourceSeriesKey(resource, seriesKey(prepared))
+	s := h.series[key]
+	if s == nil {
+		admitted, ok := h.client.cardinality.admit(h.name, prepared)
+		if !ok {
+			return
+		}
+		// A collapsed label set may already have a series of its own
+		key = resourceSeriesKey(resource, seriesKey(admitted))
+		if s = h.series[key]; s == nil {
+			s = &histogramSeries{labels: admitted, resource: resource, start: pointTime(time.Now()), counts: make([]int64, len(h.buckets)+1)}
+			h.series[key] = s
+		}
+	}
+
+	if h.client.duplicate(ctx, h.name) {
+		return
+	}
+
+	// Bucket i covers [bounds[i-1], bounds[i]), so v goes in the bucket after the last bound <= v
+	bucket := sort.Search(len(h.buckets), func(i int) bool { return h.buckets[i] > v })
+	if ex != nil {
+		if s.exemplars == nil {
+			s.exemplars = make([]*exemplar, len(s.counts))
+		}
+		s.exemplars[bucket] = ex
+	}
+	s.add(bucket, v, weight)
+}
+
+// add counts v in bucket as weight observations, carrying the fraction left over by
+// probability sampling to the next observation
+func (s *histogramSeries) add(bucket int, v, weight float64) {
+	n := int64(1)
+	if weight != 1 {
+		scaled := weight + s.carry
+		whole := math.Floor(scaled)
+		s.carry = scaled - whole
+		n = int64(whole)
+		if n == 0 {
+			return
+		}
+	}
+	s.counts[bucket] += n
+	s.count += n
+	// Welford's update for n equal observations
+	delta := v - s.mean
+	s.mean += delta * float64(n) / float64(s.count)
+	s.m2 += float64(n) * delta * (v - s.mean)
+}
+
+// SetResource writes the histogram's series against res instead of the global resource.
+// Series already recorded keep their resource.
+func (h *Histogram) SetResource(res Resource) error {
+	if h.client == nil {
+		return nil // metrics disabled
+	}
+	resource, err := h.client.resolveResource(res)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.resource = resource
+	h.mu.Unlock()
+	return nil
+}
+
+// ObserveDuration records d in the histogram's declared time unit, or the client's duration unit
+func (h *Histogram) ObserveDuration(ctx context.Context, d time.Duration, labels map[string]string) {
+	if h.client == nil {
+		return // metrics disabled
+	}
+	h.Observe(ctx, durationFloat(d, h.client.durationUnit(h.name)), labels)
+}
+
+// collect publishes the distribution of every series
+func (h *Histogram) collect(c *Client, now time.Time) []*monpb.TimeSeries {
+	metricType := c.metricType(h.name)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]*monpb.TimeSeries, 0, len(h.series))
+	for _, s := range h.series {
+		end := cumulativeEnd(s.start, now)
+		s.lastEnd = end
+		out = append(out, c.cumulativeSeries(metricType, s.resource, s.labels, s.start, end, h.value(c, s)))
+		s.exemplars = nil
+	}
+	return out
+}
+
+// value builds the distribution value of s, with its pending exemplars. Callers hold mu.
+func (h *Histogram) value(c *Client, s *histogramSeries) *monpb.TypedValue {
+	dist := &distpb.Distribution{
+		Count:                 s.count,
+		Mean:                  s.mean,
+		SumOfSquaredDeviation: s.m2,
+		BucketOptions: &distpb.Distribution_BucketOptions{
+			Options: &distpb.Distribution_BucketOptions_ExplicitBuckets{
+				ExplicitBuckets: &distpb.Distribution_BucketOptions_Explicit{Bounds: h.buckets},
+			},
+		},
+		BucketCounts: append([]int64(nil), s.counts...),
+	}
+	for _, ex := range s.exemplars {
+		if ex != nil {
+			dist.Exemplars = append(dist.Exemplars, ex.proto(c.cfg.projectID))
+		}
+	}
+	return &monpb.TypedValue{Value: &monpb.TypedValue_DistributionValue{DistributionValue: dist}}
+}
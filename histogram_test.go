@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestHistogramIgnoresNonFinite(t *testing.T) {
+	c, exp := newTestClient(t)
+	h := c.NewHistogram("latency", Buckets{10, 100})
+	ctx := context.Background()
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), 50} {
+		h.Observe(ctx, v, nil)
+	}
+	c.Flush(ctx)
+
+	got := exp.byType("custom.googleapis.com/latency")
+	if len(got) != 1 {
+		t.Fatalf("exported %d series, want 1", len(got))
+	}
+	dist := got[0].GetPoints()[0].GetValue().GetDistributionValue()
+	if dist.GetCount() != 1 || dist.GetMean() != 50 {
+		t.Errorf("count %d, mean %v, want only the finite observation", dist.GetCount(), dist.GetMean())
+	}
+}
+
+func TestHistogramExemplars(t *testing.T) {
+	c, exp := newTestClient(t)
+	h := c.NewHistogram("latency", Buckets{10, 100})
+	span := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), span)
+	h.Observe(ctx, 50, nil)
+	h.Observe(context.Background(), 5, nil) // no span, no exemplar
+	h.ObserveExemplar(context.Background(), 500, nil, map[string]string{"user": "u1"})
+	c.Flush(ctx)
+	c.Flush(ctx)
+
+	got := exp.byType("custom.googleapis.com/latency")
+	if len(got) != 2 {
+		t.Fatalf("exported %d points, want 2", len(got))
+	}
+	exemplars := got[0].GetPoints()[0].GetValue().GetDistributionValue().GetExemplars()
+	if len(exemplars) != 2 || exemplars[0].GetValue() != 50 || exemplars[1].GetValue() != 500 {
+		t.Fatalf("exemplars %v, want 50 and 500", exemplars)
+	}
+	var sc monpb.SpanContext
+	if err := exemplars[0].GetAttachments()[0].UnmarshalTo(&sc); err != nil {
+		t.Fatal(err)
+	}
+	if want := "projects/test-project/traces/" + span.TraceID().String() + "/spans/" + span.SpanID().String(); sc.GetSpanName() != want {
+		t.Errorf("span name %q, want %q", sc.GetSpanName(), want)
+	}
+	var dropped monpb.DroppedLabels
+	if err := exemplars[1].GetAttachments()[0].UnmarshalTo(&dropped); err != nil || dropped.GetLabel()["user"] != "u1" {
+		t.Errorf("attachments %v, %v", dropped.GetLabel(), err)
+	}
+	if n := len(got[1].GetPoints()[0].GetValue().GetDistributionValue().GetExemplars()); n != 0 {
+		t.Errorf("second flush republished %d exemplars", n)
+	}
+}
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"slices"
+	"sync"
+
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// maxInterned caps the label sets and metrics a Client interns. Past it, new series
+// are built from scratch as before, so a cardinality explosion can't grow the tables
+// without bound.
+const maxInterned = 10000
+
+// interner keeps one immutable copy of each prepared label set, metric type and Metric
+// message, so recurring series are recorded without rebuilding them. Everything it
+// returns is shared and must not be modified.
+type interner struct {
+	mu      sync.RWMutex
+	labels  map[string]map[string]string      // key of the merged labels to the prepared labels
+	metrics map[string]map[string]*mpb.Metric // metric type to label key to Metric
+	types   map[string]string                 // metric name to metric type
+	size    int
+}
+
+func newInterner() *interner {
+	return &interner{
+		labels:  make(map[string]map[string]string),
+		metrics: make(map[string]map[string]*mpb.Metric),
+		types:   make(map[string]string),
+	}
+}
+
+// labelScratch is the reusable working space of prepareLabels
+type labelScratch struct {
+	labels map[string]string
+	keys   []string
+	buf    []byte
+}
+
+// Pools for the scratch space and the messages of exported series
+var (
+	scratchPool = sync.Pool{New: func() any { return &labelScratch{labels: make(map[string]string, 8)} }}
+	seriesPool  = sync.Pool{New: func() any { return new(monpb.TimeSeries) }}
+	pointPool   = sync.Pool{New: func() any { return new(monpb.Point) }}
+)
+
+// key renders labels like seriesKey into the scratch buffer, valid until the next call
+func (s *labelScratch) key(labels map[string]string) []byte {
+	s.keys = s.keys[:0]
+	for k := range labels {
+		s.keys = append(s.keys, k)
+	}
+	slices.Sort(s.keys)
+	s.buf = s.buf[:0]
+	for _, k := range s.keys {
+		s.buf = append(s.buf, k...)
+		s.buf = append(s.buf, '=')
+		s.buf = append(s.buf, labels[k]...)
+		s.buf = append(s.buf, 0)
+	}
+	return s.buf
+}
+
+// release clears the scratch space and returns it to the pool
+func (s *labelScratch) release() {
+	clear(s.labels)
+	scratchPool.Put(s)
+}
+
+// preparedLabels returns the prepared labels interned for the merged labels with key
+func (in *interner) preparedLabels(key []byte) (map[string]string, bool) {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	labels, ok := in.labels[string(key)]
+	return labels, ok
+}
+
+// storeLabels interns the prepared labels for key, unless the table is full
+func (in *interner) storeLabels(key []byte, labels map[string]string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.size < maxInterned {
+		in.labels[string(key)] = labels
+		in.size++
+	}
+}
+
+// metric returns the Metric message for metricType and labels, shared by every point of
+// the series while it is interned
+func (c *Client) metric(metricType string, labels map[string]string) *mpb.Metric {
+	in := c.interned
+	s := scratchPool.Get().(*labelScratch)
+	defer s.release()
+	key := s.key(labels)
+
+	in.mu.RLock()
+	m := in.metrics[metricType][string(key)]
+	in.mu.RUnlock()
+	if m != nil {
+		return m
+	}
+
+	m = &mpb.Metric{Type: metricType, Labels: labels}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.size < maxInterned {
+		byLabels := in.metrics[metricType]
+		if byLabels == nil {
+			byLabels = make(map[string]*mpb.Metric)
+			in.metrics[metricType] = byLabels
+		}
+		byLabels[string(key)] = m
+		in.size++
+	}
+	return m
+}
+
+// internedType returns the metric type of metricName, remembering it
+func (c *Client) internedType(metricName string) string {
+	in := c.interned
+	in.mu.RLock()
+	typ, ok := in.types[metricName]
+	in.mu.RUnlock()
+	if ok {
+		return typ
+	}
+
+	typ = c.metricType(metricName)
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.size < maxInterned {
+		in.types[metricName] = typ
+		in.size++
+	}
+	return typ
+}
+
+// newSeries returns an empty TimeSeries with one empty point, reused from the pool
+func newSeries() (*monpb.TimeSeries, *monpb.Point) {
+	ts := seriesPool.Get().(*monpb.TimeSeries)
+	p := pointPool.Get().(*monpb.Point)
+	ts.Points = append(ts.Points, p)
+	return ts, p
+}
+
+// release returns series to the pool once they have been exported. Only the built-in
+// exporters are known not to keep series after Export returns, so series given to an
+// Exporter from WithExporter are left to the garbage collector. The shared label maps,
+// Metric and MonitoredResource messages the series point to are not touched.
+func (c *Client) release(series []*monpb.TimeSeries) {
+	if !c.recycle {
+		return
+	}
+	for _, ts := range series {
+		points := ts.Points
+		for _, p := range points {
+			p.Reset()
+			pointPool.Put(p)
+		}
+		clear(points)
+		ts.Reset()
+		if cap(points) == 1 {
+			ts.Points = points[:0] // every series the Client builds has one point
+		}
+		seriesPool.Put(ts)
+	}
+}
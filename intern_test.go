@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestPrepareLabelsInterned(t *testing.T) {
+	c, _ := newTestClient(t)
+	labels := map[string]string{"Region": "eu"}
+	a := c.prepareLabels("orders/open", labels)
+	b := c.prepareLabels("orders/open", map[string]string{"Region": "eu"})
+	if len(labels) != 1 || labels["Region"] != "eu" {
+		t.Errorf("caller's labels modified: %v", labels)
+	}
+	if a["region"] != "eu" || a["function_name"] == "" {
+		t.Errorf("prepared labels = %v", a)
+	}
+	a["probe"] = "x"
+	if b["probe"] != "x" {
+		t.Error("repeated label set was not interned")
+	}
+	delete(a, "probe")
+
+	typ := c.internedType("orders/open")
+	if c.metric(typ, a) != c.metric(typ, b) {
+		t.Error("Metric message not shared between points of one series")
+	}
+}
+
+func TestInternerStopsAtLimit(t *testing.T) {
+	c, _ := newTestClient(t)
+	c.interned.size = maxInterned
+	a := c.prepareLabels("orders/open", map[string]string{"region": "us"})
+	b := c.prepareLabels("orders/open", map[string]string{"region": "us"})
+	a["probe"] = "x"
+	if b["probe"] == "x" {
+		t.Error("label set interned past the limit")
+	}
+	if c.interned.size != maxInterned {
+		t.Errorf("size = %d, want %d", c.interned.size, maxInterned)
+	}
+}
+
+func TestReleaseLeavesSharedMessages(t *testing.T) {
+	c, _ := newTestClient(t)
+	c.recycle = true
+	labels := c.prepareLabels("orders/open", map[string]string{"region": "eu"})
+	ts, err := c.buildGauge(time.Now(), nil, "orders/open", 1, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, res := ts.GetMetric(), ts.GetResource()
+
+	c.release([]*monpb.TimeSeries{ts})
+	if ts.GetMetric() != nil || len(ts.GetPoints()) != 0 || cap(ts.Points) != 1 {
+		t.Errorf("released series not reset: %v", ts)
+	}
+	if m.GetType() != "custom.googleapis.com/orders/open" || m.GetLabels()["region"] != "eu" || res.GetType() != "global" {
+		t.Errorf("release modified shared messages: %v %v", m, res)
+	}
+
+	// Series given to a custom exporter are never recycled
+	c.recycle = false
+	ts, _ = c.buildGauge(time.Now(), nil, "orders/open", 2, labels)
+	c.release([]*monpb.TimeSeries{ts})
+	if ts.GetMetric() == nil {
+		t.Error("series released without recycling enabled")
+	}
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KillSwitchConfig configures a KillSwitch
+type KillSwitchConfig struct {
+	// Metric is the base name; the error rate of each window is published as <Metric>/error_rate
+	Metric string
+	// Threshold is the error rate, from 0 to 1, above which a window counts as failing
+	Threshold float64
+	// Windows is how many consecutive failing windows trip the switch, at least 1
+	Windows int
+	// Window is the length of each window, defaults to 1 minute
+	Window time.Duration
+	// MinEvents is how many outcomes a window needs before its error rate is trusted
+	MinEvents int64
+	// OnTrip is called once, from the Record call that closes the last failing window
+	OnTrip func()
+}
+
+// KillSwitch disables a feature when its own error rate stays too high, without waiting
+// for an alert round trip. Record every outcome of the feature, check Tripped before
+// using it, and Reset it once the cause is fixed:
+//
+//	ks := client.NewKillSwitch(metrics.KillSwitchConfig{Metric: "recommendations", Threshold: 0.5, Windows: 3})
+//	if !ks.Tripped() {
+//		err := recommend(ctx)
+//		ks.Record(ctx, err)
+//	}
+//
+// Windows are closed by Record, so no goroutine runs in the background.
+type KillSwitch struct {
+	client  *Client
+	cfg     KillSwitchConfig
+	tripped atomic.Bool
+
+	mu      sync.Mutex
+	start   time.Time // of the current window
+	events  int64
+	errors  int64
+	failing int // consecutive failing windows
+}
+
+// NewKillSwitch returns a KillSwitch that publishes its error rate through c
+func (c *Client) NewKillSwitch(cfg KillSwitchConfig) (*KillSwitch, error) {
+	if cfg.Metric == "" {
+		return nil, fmt.Errorf("metrics: kill switch needs a metric name")
+	}
+	if cfg.Threshold <= 0 || cfg.Threshold > 1 {
+		return nil, fmt.Errorf("metrics: kill switch threshold must be in (0, 1], got %v", cfg.Threshold)
+	}
+	if cfg.Windows < 1 {
+		cfg.Windows = 1
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	return &KillSwitch{client: c, cfg: cfg, start: time.Now()}, nil
+}
+
+// Record counts one outcome of the feature, a nil err being a success
+func (k *KillSwitch) Record(ctx context.Context, err error) {
+	k.mu.Lock()
+	rate, closed, trip := k.advance(time.Now())
+	k.events++
+	if err != nil {
+		k.errors++
+	}
+	k.mu.Unlock()
+
+	if closed && k.client != nil {
+		k.client.PushMetric(ctx, k.cfg.Metric+"/error_rate", rate, nil)
+	}
+	if trip && k.cfg.OnTrip != nil {
+		k.cfg.OnTrip()
+	}
+}
+
+// advance closes the current window if it has ended, reporting its error rate and
+// whether it tripped the switch. Callers hold mu.
+func (k *KillSwitch) advance(now time.Time) (rate float64, closed, trip bool) {
+	if now.Sub(k.start) < k.cfg.Window {
+		return 0, false, false
+	}
+	if k.events > 0 {
+		rate = float64(k.errors) / float64(k.events)
+	}
+	if k.events > 0 && k.events >= k.cfg.MinEvents && rate > k.cfg.Threshold {
+		k.failing++
+	} else {
+		k.failing = 0
+	}
+	if k.failing >= k.cfg.Windows && k.tripped.CompareAndSwap(false, true) {
+		trip = true
+	}
+	if now.Sub(k.start) >= 2*k.cfg.Window {
+		k.failing = 0 // a whole window went by without events, so the run is broken
+	}
+	k.start, k.events, k.errors = now, 0, 0
+	return rate, true, trip
+}
+
+// Tripped reports whether the feature should stay off
+func (k *KillSwitch) Tripped() bool {
+	return k.tripped.Load()
+}
+
+// Reset turns the feature back on and starts counting afresh
+func (k *KillSwitch) Reset() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.tripped.Store(false)
+	k.start, k.events, k.errors, k.failing = time.Now(), 0, 0, 0
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKillSwitchTrips(t *testing.T) {
+	c, exp := newTestClient(t)
+	trips := 0
+	ks, err := c.NewKillSwitch(KillSwitchConfig{Metric: "recs", Threshold: 0.5, Windows: 2, Window: time.Hour, MinEvents: 2, OnTrip: func() { trips++ }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	failed := errors.New("unavailable")
+	endWindow := func() { ks.start = ks.start.Add(-time.Hour) }
+
+	ks.Record(ctx, failed) // too few events to count
+	endWindow()
+	for i := 0; i < 3; i++ {
+		ks.Record(ctx, failed)
+	}
+	endWindow()
+	ks.Record(ctx, nil)
+	if ks.Tripped() {
+		t.Fatal("tripped after one failing window")
+	}
+	ks.Record(ctx, failed)
+	ks.Record(ctx, failed)
+	endWindow()
+	ks.Record(ctx, nil)
+	if !ks.Tripped() || trips != 1 {
+		t.Fatalf("tripped = %v with %d OnTrip calls, want tripped once", ks.Tripped(), trips)
+	}
+
+	rates := exp.byType("custom.googleapis.com/recs/error_rate")
+	if len(rates) != 3 || rates[1].GetPoints()[0].GetValue().GetDoubleValue() != 1 {
+		t.Errorf("published error rates %v, want 3 windows", rates)
+	}
+
+	ks.Reset()
+	if ks.Tripped() {
+		t.Error("still tripped after Reset")
+	}
+}
+
+func TestKillSwitchQuietWindowBreaksRun(t *testing.T) {
+	c, _ := newTestClient(t)
+	ks, err := c.NewKillSwitch(KillSwitchConfig{Metric: "recs", Threshold: 0.5, Windows: 2, Window: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ks.Record(ctx, errors.New("unavailable"))
+	ks.start = ks.start.Add(-3 * time.Hour) // two windows without any events
+	ks.Record(ctx, errors.New("unavailable"))
+	ks.start = ks.start.Add(-time.Hour)
+	ks.Record(ctx, nil)
+	if ks.Tripped() {
+		t.Error("failing windows separated by a quiet one tripped the switch")
+	}
+}
+
+func TestNewKillSwitchValidates(t *testing.T) {
+	c, _ := newTestClient(t)
+	if _, err := c.NewKillSwitch(KillSwitchConfig{Threshold: 0.5}); err == nil {
+		t.Error("kill switch without a metric accepted")
+	}
+	if _, err := c.NewKillSwitch(KillSwitchConfig{Metric: "recs", Threshold: 1.5}); err == nil {
+		t.Error("threshold above 1 accepted")
+	}
+}
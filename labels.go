@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+)
+
+type labelsKey struct{}
+
+type requestKey struct{}
+
+// ContextWithLabels returns a context carrying labels, added to every point recorded
+// with it or a context derived from it, so middleware can attach tenant or route labels
+// once for a whole request. Labels already in ctx are kept unless labels overrides them.
+// Labels passed with a point take precedence over context labels, which take precedence
+// over extracted labels (see WithLabelExtractor) and then default labels.
+func ContextWithLabels(ctx context.Context, labels map[string]string) context.Context {
+	merged := copyLabels(labelsFromContext(ctx))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, labelsKey{}, merged)
+}
+
+// labelsFromContext returns the labels attached by ContextWithLabels, nil if none
+func labelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(labelsKey{}).(map[string]string)
+	return labels
+}
+
+// WithLabelExtractor derives labels from the context of every point recorded, such as a
+// tenant_id taken from request metadata an auth middleware stored in the context, so
+// call sites can't forget them. Extracted labels are added under labels from
+// ContextWithLabels and labels passed with the point, and over default labels. extract
+// runs on the recording goroutine and should be cheap; a panic in it is logged and
+// the point recorded without extracted labels.
+func WithLabelExtractor(extract func(ctx context.Context) map[string]string) Option {
+	return func(c *config) {
+		c.labelExtractor = extract
+	}
+}
+
+// withContextLabels returns labels with the labels carried by ctx, and those the label
+// extractor derives from it, added under them
+func (c *Client) withContextLabels(ctx context.Context, labels map[string]string) map[string]string {
+	extracted := c.extractLabels(ctx)
+	fromCtx := labelsFromContext(ctx)
+	if len(fromCtx) == 0 && len(extracted) == 0 {
+		return labels
+	}
+	merged := copyLabels(extracted)
+	for k, v := range fromCtx {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+// ContextWithRequest returns a context carrying r, for label extractors that read
+// request headers such as HeaderLabels. WrapHTTP attaches the request itself; other
+// servers can call this from a middleware.
+func ContextWithRequest(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, r)
+}
+
+// RequestFromContext returns the request attached by ContextWithRequest, nil if none
+func RequestFromContext(ctx context.Context) *http.Request {
+	r, _ := ctx.Value(requestKey{}).(*http.Request)
+	return r
+}
+
+// HeaderLabels returns a label extractor for WithLabelExtractor that copies request
+// headers to labels, keyed by header name:
+//
+//	metrics.WithLabelExtractor(metrics.HeaderLabels(map[string]string{"X-Tenant-ID": "tenant_id"}))
+//
+// Points recorded without a request in their context, or without the header, get no label.
+func HeaderLabels(headers map[string]string) func(ctx context.Context) map[string]string {
+	return func(ctx context.Context) map[string]string {
+		r := RequestFromContext(ctx)
+		if r == nil {
+			return nil
+		}
+		var labels map[string]string
+		for header, label := range headers {
+			if v := r.Header.Get(header); v != "" {
+				if labels == nil {
+					labels = make(map[string]string, len(headers))
+				}
+				labels[label] = v
+			}
+		}
+		return labels
+	}
+}
+
+// extractLabels runs the label extractor, turning a panic into no labels
+func (c *Client) extractLabels(ctx context.Context) (labels map[string]string) {
+	if c.cfg.labelExtractor == nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Error("label extractor panicked", "panic", r)
+			labels = nil
+		}
+	}()
+	return c.cfg.labelExtractor(ctx)
+}
+
+// WithDefaultLabels adds labels to every series the Client writes, such as environment,
+// region or commit SHA. Labels passed with a point take precedence over them.
+func WithDefaultLabels(labels map[string]string) Option {
+	return func(c *config) {
+		c.defaultLabels = copyLabels(labels)
+	}
+}
+
+// SetDefaultLabels replaces the labels added to every series, see WithDefaultLabels.
+// Series already being tracked, such as counters, keep the labels they started with.
+func (c *Client) SetDefaultLabels(labels map[string]string) {
+	labels = copyLabels(labels)
+	c.defaultLabels.Store(&labels)
+}
+
+// mergeDefaultLabels adds the default labels missing from labels
+func (c *Client) mergeDefaultLabels(labels map[string]string) {
+	defaults := c.defaultLabels.Load()
+	if defaults == nil {
+		return
+	}
+	for k, v := range *defaults {
+		if _, ok := labels[k]; !ok {
+			labels[k] = v
+		}
+	}
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextLabelPrecedence(t *testing.T) {
+	c, exp := newTestClient(t,
+		WithDefaultLabels(map[string]string{"env": "prod", "tier": "default"}),
+		WithLabelExtractor(func(context.Context) map[string]string {
+			return map[string]string{"tier": "extracted", "tenant": "extracted"}
+		}),
+	)
+	ctx := ContextWithLabels(context.Background(), map[string]string{"tenant": "outer", "route": "outer"})
+	ctx = ContextWithLabels(ctx, map[string]string{"tenant": "ctx"})
+	c.PushMetric(ctx, "orders/open", 1, map[string]string{"route": "/buy"})
+
+	got := exp.byType("custom.googleapis.com/orders/open")
+	if len(got) != 1 {
+		t.Fatalf("exported %d series, want 1", len(got))
+	}
+	labels := got[0].GetMetric().GetLabels()
+	for k, want := range map[string]string{"env": "prod", "tier": "extracted", "tenant": "ctx", "route": "/buy"} {
+		if labels[k] != want {
+			t.Errorf("%s = %q, want %q", k, labels[k], want)
+		}
+	}
+}
+
+func TestHeaderLabels(t *testing.T) {
+	extract := HeaderLabels(map[string]string{"X-Tenant-ID": "tenant_id", "X-Region": "region"})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Tenant-ID", "acme")
+
+	labels := extract(ContextWithRequest(context.Background(), r))
+	if len(labels) != 1 || labels["tenant_id"] != "acme" {
+		t.Errorf("labels = %v, want tenant_id only", labels)
+	}
+	if labels := extract(context.Background()); labels != nil {
+		t.Errorf("labels without a request = %v", labels)
+	}
+}
+
+func TestLabelExtractorPanic(t *testing.T) {
+	c, exp := newTestClient(t, WithLabelExtractor(func(context.Context) map[string]string { panic("boom") }))
+	c.PushMetric(context.Background(), "orders/open", 1, map[string]string{"route": "/buy"})
+	if got := exp.byType("custom.googleapis.com/orders/open"); len(got) != 1 || got[0].GetMetric().GetLabels()["route"] != "/buy" {
+		t.Errorf("exported %v, want the point recorded without extracted labels", got)
+	}
+}
@@ -2,23 +2,17 @@ package metrics
 
 import (
 	"context"
-	"log"
+	"net/http"
 	"os"
 	"sync"
 	"time"
-
-	monitoring "cloud.google.com/go/monitoring/apiv3"
-	mpb "google.golang.org/genproto/googleapis/api/metric"
-	gcprpb "google.golang.org/genproto/googleapis/api/monitoredres"
-	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
-	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// Global variables for the GCP Monitoring client
+// Global variables for the client behind the package-level functions
 var (
-	clientInit   sync.Once
-	metricClient *monitoring.MetricClient
-	clientErr    error
+	clientInit    sync.Once
+	defaultClient *Client
+	clientErr     error
 )
 
 // getProjectID returns the GCP project ID from env or default to p48-development for local
@@ -37,84 +31,263 @@ func getFunctionName() string {
 	return "Buy" // TODO prob change this
 }
 
-// initClient initializes the GCP Monitoring client once
-func initClient(ctx context.Context) {
+// initClient initializes the default Client once
+func initClient(ctx context.Context, opts ...Option) {
 	clientInit.Do(func() {
-		metricClient, clientErr = monitoring.NewMetricClient(ctx) // Connection to cloud monitoring
+		defaultClient, clientErr = New(ctx, opts...)
 		if clientErr != nil {
-			log.Printf("[metrics] disabled – failed to create Monitoring client: %v", clientErr)
+			newConfig(opts).logger.Error("metrics disabled, failed to create Monitoring client", "error", clientErr)
 		}
 	})
 }
 
+// Init configures the client used by the package-level functions.
+// It must be called before the first PushMetric; later calls have no effect.
+func Init(ctx context.Context, opts ...Option) error {
+	initClient(ctx, opts...)
+	return clientErr
+}
+
 // PushMetric sends a custom metric with any value type to Google Cloud Monitoring
 func PushMetric(ctx context.Context, metricName string, value interface{}, labels map[string]string) {
 	initClient(ctx) // Initialize the GCP Monitoring client
-	if metricClient == nil {
+	if defaultClient == nil {
 		return // metrics disabled
 	}
+	defaultClient.PushMetric(ctx, callerScope().name(metricName), value, labels)
+}
 
-	projectID := getProjectID()
-	functionName := getFunctionName()
-	now := timestamppb.New(time.Now())
-	projectName := "projects/" + projectID
-
-	// Always include function_name label for consistency
-	if _, ok := labels["function_name"]; !ok {
-		labels["function_name"] = functionName
-	}
-
-	// Create a typed value for the metric - allows for different types of values
-	var typedValue *monpb.TypedValue
-	switch v := value.(type) {
-	case int:
-		typedValue = &monpb.TypedValue{Value: &monpb.TypedValue_Int64Value{Int64Value: int64(v)}}
-	case int32:
-		typedValue = &monpb.TypedValue{Value: &monpb.TypedValue_Int64Value{Int64Value: int64(v)}}
-	case int64:
-		typedValue = &monpb.TypedValue{Value: &monpb.TypedValue_Int64Value{Int64Value: v}}
-	case float32:
-		typedValue = &monpb.TypedValue{Value: &monpb.TypedValue_DoubleValue{DoubleValue: float64(v)}}
-	case float64:
-		typedValue = &monpb.TypedValue{Value: &monpb.TypedValue_DoubleValue{DoubleValue: v}}
-	case string:
-		typedValue = &monpb.TypedValue{Value: &monpb.TypedValue_StringValue{StringValue: v}}
-	case bool:
-		var intVal int64
-		if v {
-			intVal = 1
-		}
-		typedValue = &monpb.TypedValue{Value: &monpb.TypedValue_Int64Value{Int64Value: intVal}}
-	default:
-		log.Printf("[metrics] unsupported value type: %T", v)
-		return
+// TryPushMetric is PushMetric, returning an error for points rejected before export
+func TryPushMetric(ctx context.Context, metricName string, value interface{}, labels map[string]string) error {
+	initClient(ctx)
+	if clientErr != nil {
+		return clientErr
+	}
+	return defaultClient.TryPushMetric(ctx, callerScope().name(metricName), value, labels)
+}
+
+// SetDefaultLabels replaces the labels added to every series, per-call labels take precedence
+func SetDefaultLabels(labels map[string]string) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return // metrics disabled
+	}
+	defaultClient.SetDefaultLabels(labels)
+}
+
+// RegisterGaugeFunc samples fn once per flush interval and publishes the result as a gauge.
+// The returned func unregisters the callback.
+func RegisterGaugeFunc(metricName string, labels map[string]string, fn func() float64) (unregister func()) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return func() {} // metrics disabled
+	}
+	return defaultClient.RegisterGaugeFunc(callerScope().name(metricName), labels, fn)
+}
+
+// Flush exports everything the package-level client has buffered
+func Flush(ctx context.Context) {
+	initClient(ctx)
+	if defaultClient == nil {
+		return // metrics disabled
 	}
+	defaultClient.Flush(ctx)
+}
 
-	point := &monpb.Point{
-		Interval: &monpb.TimeInterval{EndTime: now},
-		Value:    typedValue,
+// StartHeartbeat publishes an uptime gauge every interval with version and instance labels.
+// The returned func stops it.
+func StartHeartbeat(interval time.Duration, labels map[string]string) (stop func()) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return func() {} // metrics disabled
 	}
+	return defaultClient.StartHeartbeat(interval, labels)
+}
 
-	ts := &monpb.TimeSeries{
-		Metric: &mpb.Metric{
-			Type:   "custom.googleapis.com/" + metricName,
-			Labels: labels,
-		},
-		Resource: &gcprpb.MonitoredResource{
-			Type: "global",
-			Labels: map[string]string{
-				"project_id": projectID,
-			},
-		},
-		Points: []*monpb.Point{point},
+// Every runs fn now and then every interval, emitting what it reports through the
+// package-level client. The returned func stops it.
+func Every(interval time.Duration, fn func(ctx context.Context, r Reporter)) (stop func()) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return func() {} // metrics disabled
 	}
+	return defaultClient.every(interval, callerScope(), fn)
+}
 
-	req := &monpb.CreateTimeSeriesRequest{
-		Name:       projectName,
-		TimeSeries: []*monpb.TimeSeries{ts},
+// PublishBuildInfo publishes a constant gauge labelled with the build's version, commit and
+// build date. Calling it again for the same build does nothing.
+func PublishBuildInfo(version, commit, buildDate string) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return // metrics disabled
 	}
+	defaultClient.PublishBuildInfo(version, commit, buildDate)
+}
+
+// DebugHandler returns an HTTP handler serving the package-level client's in-memory state as JSON
+func DebugHandler() http.Handler {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "metrics disabled", http.StatusNotFound)
+		})
+	}
+	return defaultClient.DebugHandler()
+}
+
+// SetEnabled turns exporting by the package-level client on or off at runtime
+func SetEnabled(enabled bool) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return // metrics disabled
+	}
+	defaultClient.SetEnabled(enabled)
+}
+
+// SetMetricFilter replaces the package-level client's allow and deny patterns at runtime
+func SetMetricFilter(allow, deny []string) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return // metrics disabled
+	}
+	defaultClient.SetMetricFilter(allow, deny)
+}
+
+// RecordMulti records several gauges sharing one label set and timestamp in a single call
+func RecordMulti(ctx context.Context, labels map[string]string, values map[string]float64) {
+	initClient(ctx)
+	if defaultClient == nil {
+		return // metrics disabled
+	}
+	defaultClient.RecordMulti(ctx, labels, callerScope().names(values))
+}
+
+// NewCounter returns a cumulative counter published by the package-level client on every flush
+func NewCounter(metricName string) *Counter {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return &Counter{name: metricName} // metrics disabled, records nothing
+	}
+	return defaultClient.NewCounter(callerScope().name(metricName))
+}
+
+// NewDeltaCounter returns a delta counter published by the package-level client on every flush
+func NewDeltaCounter(metricName string) *Counter {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return &Counter{name: metricName} // metrics disabled, records nothing
+	}
+	return defaultClient.NewDeltaCounter(callerScope().name(metricName))
+}
+
+// NewKillSwitch returns a KillSwitch publishing its error rate through the package-level client
+func NewKillSwitch(cfg KillSwitchConfig) (*KillSwitch, error) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return (*Client)(nil).NewKillSwitch(cfg) // metrics disabled, the switch still works
+	}
+	if cfg.Metric != "" {
+		cfg.Metric = callerScope().name(cfg.Metric)
+	}
+	return defaultClient.NewKillSwitch(cfg)
+}
+
+// NewCalendarSum returns a CalendarSum published by the package-level client on every flush
+func NewCalendarSum(metricName string, period CalendarPeriod, timeZone string) (*CalendarSum, error) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return (*Client)(nil).NewCalendarSum(metricName, period, timeZone) // metrics disabled, records nothing
+	}
+	return defaultClient.NewCalendarSum(callerScope().name(metricName), period, timeZone)
+}
+
+// QueryTimeSeries reads series back from Cloud Monitoring through the package-level client
+func QueryTimeSeries(ctx context.Context, filter string, interval Interval, aggregation *Aggregation) ([]Series, error) {
+	initClient(ctx)
+	if clientErr != nil {
+		return nil, clientErr
+	}
+	return defaultClient.QueryTimeSeries(ctx, filter, interval, aggregation)
+}
+
+// EnsureAlertPolicy creates or updates an alert policy on a metric of the package-level client
+func EnsureAlertPolicy(ctx context.Context, p AlertPolicy) (string, error) {
+	initClient(ctx)
+	if clientErr != nil {
+		return "", clientErr
+	}
+	return defaultClient.EnsureAlertPolicy(ctx, p)
+}
+
+// EnsureNotificationChannel creates or updates a notification channel in the package-level client's project
+func EnsureNotificationChannel(ctx context.Context, ch NotificationChannel) (string, error) {
+	initClient(ctx)
+	if clientErr != nil {
+		return "", clientErr
+	}
+	return defaultClient.EnsureNotificationChannel(ctx, ch)
+}
+
+// Pressure returns how strained the package-level client's pipeline is, from 0 to 1
+func Pressure() float64 {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return 0 // metrics disabled
+	}
+	return defaultClient.Pressure()
+}
+
+// NewSLO returns an SLO published by the package-level client on every flush
+func NewSLO(metricName string, objective float64, labels map[string]string, windows ...time.Duration) (*SLO, error) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return (*Client)(nil).NewSLO(metricName, objective, labels, windows...) // metrics disabled, records nothing
+	}
+	return defaultClient.NewSLO(callerScope().name(metricName), objective, labels, windows...)
+}
+
+// NewPercentiles returns percentile gauges computed over a sliding window, published by the
+// package-level client on every flush
+func NewPercentiles(metricName string, window time.Duration, quantiles ...float64) (*Percentiles, error) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return (*Client)(nil).NewPercentiles(metricName, window, quantiles...) // metrics disabled, records nothing
+	}
+	return defaultClient.NewPercentiles(callerScope().name(metricName), window, quantiles...)
+}
+
+// PushDuration records d through the package-level client in the configured duration unit
+func PushDuration(ctx context.Context, metricName string, d time.Duration, labels map[string]string) {
+	initClient(ctx)
+	if defaultClient == nil {
+		return // metrics disabled
+	}
+	defaultClient.PushDuration(ctx, callerScope().name(metricName), d, labels)
+}
+
+// NewHistogram returns a cumulative distribution published by the package-level client on every flush
+func NewHistogram(metricName string, buckets Buckets) *Histogram {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return &Histogram{name: metricName} // metrics disabled, records nothing
+	}
+	return defaultClient.NewHistogram(callerScope().name(metricName), buckets)
+}
+
+// List describes every metric the package-level client has recorded or created an instrument for
+func List() []InstrumentInfo {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return nil // metrics disabled
+	}
+	return defaultClient.List()
+}
 
-	if err := metricClient.CreateTimeSeries(ctx, req); err != nil {
-		log.Printf("[metrics] could not write time series: %v", err)
+// Describe returns what the package-level client knows about metricName
+func Describe(metricName string) (InstrumentInfo, bool) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return InstrumentInfo{}, false // metrics disabled
 	}
+	return defaultClient.Describe(metricName)
 }
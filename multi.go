@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// RecordMulti records several related gauges that share one label set and timestamp,
+// such as the values a handler reports at the end of each request. The labels are
+// prepared once and all points enter the pipeline together, in one export when unbuffered.
+func (c *Client) RecordMulti(ctx context.Context, labels map[string]string, values map[string]float64) {
+	if len(values) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resource, err := c.contextResource(ctx, nil)
+	if err != nil {
+		c.logger.Error("dropping points with invalid resource", "error", err)
+		return
+	}
+
+	now := time.Now()
+	prepared := c.prepareLabels(names[0], c.withContextLabels(ctx, labels))
+	series := make([]*monpb.TimeSeries, 0, len(names))
+	for _, name := range names {
+		weight, ok := c.sample(name)
+		if !ok {
+			continue
+		}
+		if !c.spendBudget(ctx, name, 1) {
+			continue
+		}
+		if err := c.registerGauge(name, labels); err != nil || c.duplicate(ctx, name) {
+			continue
+		}
+		pointLabels := prepared
+		if weight != 1 {
+			pointLabels = c.prepareLabels(name, weighted(c.withContextLabels(ctx, labels), weight))
+		}
+		if ts, err := c.buildGauge(now, resource, name, values[name], pointLabels); err == nil {
+			series = append(series, ts)
+		}
+	}
+	if len(series) > 0 {
+		c.emit(ctx, series)
+	}
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRecordMultiChargesEachMetric(t *testing.T) {
+	var logs bytes.Buffer
+	c, exp := newTestClient(t, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	ctx := ContextWithBudget(context.Background(), 2)
+	c.RecordMulti(ctx, nil, map[string]float64{"a": 1, "b": 2, "c": 3})
+
+	if n := len(exp.exported()); n != 2 {
+		t.Fatalf("exported %d series, want the 2 the budget allows", n)
+	}
+	for _, ts := range exp.exported() {
+		if ts.GetMetric().GetType() == "custom.googleapis.com/c" {
+			t.Error("point past the budget exported")
+		}
+	}
+	if !strings.Contains(logs.String(), "metric=c") {
+		t.Errorf("budget overrun not reported against metric c:\n%s", logs.String())
+	}
+}
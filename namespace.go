@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithNamespace places every metric under namespace, so "orders" is written as
+// custom.googleapis.com/<namespace>/orders. Use a path per team or service, such as
+// "videogameshop/checkout", to keep metric types from colliding. Names that become
+// too long with the namespace added are truncated with a warning.
+func WithNamespace(namespace string) Option {
+	return func(c *config) {
+		c.namespace = strings.Trim(namespace, "/")
+	}
+}
+
+// validateNamespace checks the configured namespace is a valid metric path
+func validateNamespace(namespace string) error {
+	if namespace == "" {
+		return nil
+	}
+	if err := ValidateMetricName(namespace); err != nil {
+		return fmt.Errorf("metrics: invalid namespace: %w", err)
+	}
+	return nil
+}
+
+// qualify returns metricName under the configured namespace
+func (c *Client) qualify(metricName string) string {
+	if c.cfg.namespace == "" {
+		return metricName
+	}
+	return c.cfg.namespace + "/" + strings.TrimLeft(metricName, "/")
+}
+
+// metricType returns the full Cloud Monitoring type for metricName
+func (c *Client) metricType(metricName string) string {
+	return metricTypePrefix + sanitizeMetricName(c.logger, c.qualify(metricName))
+}
+
+// metricTypes maps metricType over names
+func (c *Client) metricTypes(names []string) []string {
+	types := make([]string, len(names))
+	for i, n := range names {
+		types[i] = c.metricType(n)
+	}
+	return types
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// LabelNormalizer rewrites a label value into its canonical form
+type LabelNormalizer func(value string) string
+
+// WithLabelNormalizer applies fn to the value of label key on every recorded point.
+// Normalizers registered for the same key run in the order given.
+func WithLabelNormalizer(key string, fn LabelNormalizer) Option {
+	return func(c *config) {
+		if c.normalizers == nil {
+			c.normalizers = make(map[string][]LabelNormalizer)
+		}
+		c.normalizers[key] = append(c.normalizers[key], fn)
+	}
+}
+
+// normalizeLabels applies the configured normalizers to labels in place
+func (c *Client) normalizeLabels(labels map[string]string) {
+	for key, fns := range c.cfg.normalizers {
+		v, ok := labels[key]
+		if !ok {
+			continue
+		}
+		for _, fn := range fns {
+			v = fn(v)
+		}
+		labels[key] = v
+	}
+}
+
+// Lowercase trims surrounding space and lowercases the value
+func Lowercase(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// countryAliases maps common non-ISO spellings to ISO 3166-1 alpha-2 codes
+var countryAliases = map[string]string{
+	"UK":  "GB",
+	"GBR": "GB",
+	"USA": "US",
+	"CAN": "CA",
+	"DEU": "DE",
+	"FRA": "FR",
+	"ESP": "ES",
+	"ITA": "IT",
+	"NLD": "NL",
+	"IRL": "IE",
+	"AUS": "AU",
+	"NZL": "NZ",
+	"JPN": "JP",
+	"IND": "IN",
+	"BRA": "BR",
+	"MEX": "MX",
+}
+
+// CountryCode canonicalizes country codes to upper-case ISO 3166-1 alpha-2, mapping
+// common alpha-3 codes and aliases such as "uk". Anything unrecognized becomes "unknown".
+func CountryCode(value string) string {
+	v := strings.ToUpper(strings.TrimSpace(value))
+	if alias, ok := countryAliases[v]; ok {
+		return alias
+	}
+	if len(v) == 2 && v[0] >= 'A' && v[0] <= 'Z' && v[1] >= 'A' && v[1] <= 'Z' {
+		return v
+	}
+	return "unknown"
+}
+
+// NumericRanges returns a normalizer that replaces numeric values with the range they
+// fall in, so a label like quantity="17" becomes "10-50" for bounds 10, 50. Values
+// below the first bound become "<10", values at or above the last "50+", and
+// non-numeric values "nan".
+func NumericRanges(bounds ...float64) LabelNormalizer {
+	b := Buckets(bounds).With() // sorted copy without duplicates
+	return func(value string) string {
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || math.IsNaN(f) {
+			return "nan"
+		}
+		if len(b) == 0 {
+			return value
+		}
+		if f < b[0] {
+			return "<" + formatBound(b[0])
+		}
+		for i := 1; i < len(b); i++ {
+			if f < b[i] {
+				return fmt.Sprintf("%s-%s", formatBound(b[i-1]), formatBound(b[i]))
+			}
+		}
+		return formatBound(b[len(b)-1]) + "+"
+	}
+}
+
+func formatBound(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,353 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	distpb "google.golang.org/genproto/googleapis/api/distribution"
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLPProtocol is the transport the OTLP exporter uses
+type OTLPProtocol int
+
+const (
+	// OTLPGRPC exports with OTLP/gRPC, by default to localhost:4317
+	OTLPGRPC OTLPProtocol = iota
+	// OTLPHTTP exports binary protobuf with OTLP/HTTP, by default to http://localhost:4318
+	OTLPHTTP
+)
+
+// otlpScope names this package as the instrumentation scope of exported metrics
+const otlpScope = "github.com/henrydvies/metrics"
+
+// OTLPConfig configures the OTLP exporter
+type OTLPConfig struct {
+	Protocol OTLPProtocol
+	// Endpoint is a base URL, /v1/metrics is appended for HTTP. For gRPC host:port is
+	// accepted too, and an http:// URL implies Insecure.
+	Endpoint string
+	// Insecure disables TLS for gRPC, for a collector sidecar on localhost
+	Insecure   bool
+	Headers    map[string]string // sent with every export, e.g. for collector auth
+	HTTPClient *http.Client      // for OTLPHTTP, defaults to a client with a 10 second timeout
+}
+
+// WithOTLP sends metrics to an OpenTelemetry Collector instead of Cloud Monitoring, so
+// routing, filtering and transformation can be configured centrally. Setting
+// METRICS_BACKEND=otlp does the same without code changes, reading the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_PROTOCOL (grpc or http/protobuf)
+// and OTEL_EXPORTER_OTLP_INSECURE variables.
+func WithOTLP(cfg OTLPConfig) Option {
+	return func(c *config) {
+		c.otlp = &cfg
+	}
+}
+
+// getOTLP returns the OTLP configuration from the environment, if it selects OTLP
+func getOTLP() (OTLPConfig, bool) {
+	if !strings.EqualFold(os.Getenv("METRICS_BACKEND"), "otlp") {
+		return OTLPConfig{}, false
+	}
+	cfg := OTLPConfig{Endpoint: os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")}
+	if strings.HasPrefix(os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"), "http") {
+		cfg.Protocol = OTLPHTTP
+	}
+	cfg.Insecure = strings.EqualFold(os.Getenv("OTEL_EXPORTER_OTLP_INSECURE"), "true")
+	return cfg, true
+}
+
+// otlpExporter converts time series to OTLP and exports them to a collector
+type otlpExporter struct {
+	cfg    OTLPConfig
+	conn   *grpc.ClientConn // for OTLPGRPC
+	client colmetricpb.MetricsServiceClient
+	url    string // for OTLPHTTP
+	http   *http.Client
+}
+
+// NewOTLPExporter returns an Exporter that writes to an OpenTelemetry Collector. Metric
+// types lose the custom.googleapis.com/ prefix, so custom.googleapis.com/checkout/latency
+// is exported as checkout/latency. Gauges become OTLP gauges, cumulative series monotonic
+// cumulative sums and distributions cumulative histograms; the monitored resource becomes
+// the OTLP resource, its type in the gcp.resource_type attribute. String points are
+// skipped. Rejected points are reported as an InvalidArgument error.
+func NewOTLPExporter(cfg OTLPConfig) (Exporter, error) {
+	e := &otlpExporter{cfg: cfg}
+	if cfg.Protocol == OTLPHTTP {
+		base := cfg.Endpoint
+		if base == "" {
+			base = "http://localhost:4318"
+		}
+		e.url = strings.TrimRight(base, "/") + "/v1/metrics"
+		e.http = cfg.HTTPClient
+		if e.http == nil {
+			e.http = &http.Client{Timeout: 10 * time.Second}
+		}
+		return e, nil
+	}
+
+	endpoint, insecureScheme, err := otlpGRPCTarget(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	creds := credentials.NewTLS(&tls.Config{})
+	if cfg.Insecure || insecureScheme {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient(endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("metrics: create otlp connection: %w", err)
+	}
+	e.conn, e.client = conn, colmetricpb.NewMetricsServiceClient(conn)
+	return e, nil
+}
+
+// otlpGRPCTarget returns the host:port to dial for a gRPC endpoint, given either as
+// host:port or, as OTEL_EXPORTER_OTLP_ENDPOINT is, as a URL whose http scheme means no TLS
+func otlpGRPCTarget(endpoint string) (target string, insecure bool, err error) {
+	if endpoint == "" {
+		return "localhost:4317", false, nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, false, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("metrics: invalid otlp endpoint %q", endpoint)
+	}
+	switch u.Scheme {
+	case "http":
+		insecure = true
+	case "https":
+	default:
+		return "", false, fmt.Errorf("metrics: otlp endpoint %q has unsupported scheme %q", endpoint, u.Scheme)
+	}
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "4317"), insecure, nil
+	}
+	return u.Host, insecure, nil
+}
+
+func (e *otlpExporter) Export(ctx context.Context, series []*monpb.TimeSeries) error {
+	req := otlpRequest(series)
+	if len(req.ResourceMetrics) == 0 {
+		return nil
+	}
+
+	var resp *colmetricpb.ExportMetricsServiceResponse
+	var err error
+	if e.client != nil {
+		if len(e.cfg.Headers) > 0 {
+			md := metadata.New(e.cfg.Headers)
+			ctx = metadata.NewOutgoingContext(ctx, md)
+		}
+		resp, err = e.client.Export(ctx, req)
+	} else {
+		resp, err = e.post(ctx, req)
+	}
+	if err != nil {
+		return err
+	}
+	if ps := resp.GetPartialSuccess(); ps.GetRejectedDataPoints() > 0 {
+		return status.Errorf(codes.InvalidArgument, "metrics: otlp collector rejected %d points: %s", ps.GetRejectedDataPoints(), ps.GetErrorMessage())
+	}
+	return nil
+}
+
+// post exports req with OTLP/HTTP
+func (e *otlpExporter) post(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.cfg.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := e.http.Do(httpReq)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, "metrics: otlp export: "+err.Error())
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return nil, status.Errorf(httpCode(resp.StatusCode), "metrics: otlp export: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	out := &colmetricpb.ExportMetricsServiceResponse{}
+	proto.Unmarshal(data, out) // an empty or unparsable body means full success
+	return out, nil
+}
+
+func (e *otlpExporter) Close() error {
+	if e.conn != nil {
+		return e.conn.Close()
+	}
+	return nil
+}
+
+// otlpRequest converts series, grouping them by resource and metric
+func otlpRequest(series []*monpb.TimeSeries) *colmetricpb.ExportMetricsServiceRequest {
+	req := &colmetricpb.ExportMetricsServiceRequest{}
+	resources := make(map[string]*metricpb.ScopeMetrics)
+	metrics := make(map[string]*metricpb.Metric)
+	for _, ts := range series {
+		res := ts.GetResource()
+		resKey := res.GetType() + "\x00" + seriesKey(res.GetLabels())
+		sm := resources[resKey]
+		if sm == nil {
+			attrs := otlpAttributes(res.GetLabels())
+			attrs = append(attrs, otlpAttribute("gcp.resource_type", res.GetType()))
+			sm = &metricpb.ScopeMetrics{Scope: &commonpb.InstrumentationScope{Name: otlpScope}}
+			req.ResourceMetrics = append(req.ResourceMetrics, &metricpb.ResourceMetrics{
+				Resource:     &resourcepb.Resource{Attributes: attrs},
+				ScopeMetrics: []*metricpb.ScopeMetrics{sm},
+			})
+			resources[resKey] = sm
+		}
+
+		key := resKey + "\x00" + ts.GetMetric().GetType() + "\x00" + ts.GetMetricKind().String()
+		for _, p := range ts.GetPoints() {
+			otlpAdd(sm, metrics, key, ts, p)
+		}
+	}
+
+	// Drop resources whose points were all skipped
+	kept := req.ResourceMetrics[:0]
+	for _, rm := range req.ResourceMetrics {
+		if len(rm.ScopeMetrics[0].Metrics) > 0 {
+			kept = append(kept, rm)
+		}
+	}
+	req.ResourceMetrics = kept
+	return req
+}
+
+// otlpAdd adds one point of ts to the metric for key in sm, creating it if needed.
+// It reports false for points OTLP can't hold, which are skipped.
+func otlpAdd(sm *metricpb.ScopeMetrics, metrics map[string]*metricpb.Metric, key string, ts *monpb.TimeSeries, p *monpb.Point) bool {
+	attrs := otlpAttributes(ts.GetMetric().GetLabels())
+	end := uint64(p.GetInterval().GetEndTime().AsTime().UnixNano())
+	var start uint64
+	if st := p.GetInterval().GetStartTime(); st != nil {
+		start = uint64(st.AsTime().UnixNano())
+	}
+	cumulative := ts.GetMetricKind() == mpb.MetricDescriptor_CUMULATIVE
+
+	m := metrics[key]
+	newMetric := func(data func() *metricpb.Metric) *metricpb.Metric {
+		if m == nil {
+			m = data()
+			m.Name = strings.TrimPrefix(ts.GetMetric().GetType(), metricTypePrefix)
+			m.Unit = ts.GetUnit()
+			metrics[key] = m
+			sm.Metrics = append(sm.Metrics, m)
+		}
+		return m
+	}
+
+	if dist := p.GetValue().GetDistributionValue(); dist != nil {
+		h := newMetric(func() *metricpb.Metric {
+			return &metricpb.Metric{Data: &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+				AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			}}}
+		}).GetHistogram()
+		h.DataPoints = append(h.DataPoints, otlpHistogramPoint(dist, attrs, start, end))
+		return true
+	}
+
+	dp := &metricpb.NumberDataPoint{Attributes: attrs, StartTimeUnixNano: start, TimeUnixNano: end}
+	switch v := p.GetValue().GetValue().(type) {
+	case *monpb.TypedValue_Int64Value:
+		dp.Value = &metricpb.NumberDataPoint_AsInt{AsInt: v.Int64Value}
+	case *monpb.TypedValue_DoubleValue:
+		dp.Value = &metricpb.NumberDataPoint_AsDouble{AsDouble: v.DoubleValue}
+	case *monpb.TypedValue_BoolValue:
+		var n int64
+		if v.BoolValue {
+			n = 1
+		}
+		dp.Value = &metricpb.NumberDataPoint_AsInt{AsInt: n}
+	default:
+		return false
+	}
+	if cumulative {
+		s := newMetric(func() *metricpb.Metric {
+			return &metricpb.Metric{Data: &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+				AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+			}}}
+		}).GetSum()
+		s.DataPoints = append(s.DataPoints, dp)
+		return true
+	}
+	g := newMetric(func() *metricpb.Metric {
+		return &metricpb.Metric{Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{}}}
+	}).GetGauge()
+	g.DataPoints = append(g.DataPoints, dp)
+	return true
+}
+
+// otlpHistogramPoint converts a distribution with explicit buckets. Other bucket layouts
+// are exported with their count and sum only.
+func otlpHistogramPoint(dist *distpb.Distribution, attrs []*commonpb.KeyValue, start, end uint64) *metricpb.HistogramDataPoint {
+	sum := dist.GetMean() * float64(dist.GetCount())
+	hp := &metricpb.HistogramDataPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      end,
+		Count:             uint64(dist.GetCount()),
+		Sum:               &sum,
+	}
+	bounds := dist.GetBucketOptions().GetExplicitBuckets().GetBounds()
+	if len(bounds) == 0 {
+		return hp
+	}
+	hp.ExplicitBounds = bounds
+	hp.BucketCounts = make([]uint64, len(bounds)+1)
+	for i, n := range dist.GetBucketCounts() {
+		if i < len(hp.BucketCounts) {
+			hp.BucketCounts[i] = uint64(n)
+		}
+	}
+	return hp
+}
+
+// otlpAttributes converts labels to string attributes, sorted by key
+func otlpAttributes(labels map[string]string) []*commonpb.KeyValue {
+	out := make([]*commonpb.KeyValue, 0, len(labels)+1)
+	for _, k := range sortedKeys(labels) {
+		out = append(out, otlpAttribute(k, labels[k]))
+	}
+	return out
+}
+
+func otlpAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
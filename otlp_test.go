@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	distpb "google.golang.org/genproto/googleapis/api/distribution"
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	gcprpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestOTLPRequest(t *testing.T) {
+	global := &gcprpb.MonitoredResource{Type: "global", Labels: map[string]string{"project_id": "p"}}
+	task := &gcprpb.MonitoredResource{Type: "generic_task", Labels: map[string]string{"job": "checkout"}}
+	start := timestamppb.New(time.Unix(1700000000, 0))
+	end := timestamppb.New(time.Unix(1700000060, 0))
+
+	gauge := gaugePoint("custom.googleapis.com/checkout/latency", map[string]string{"region": "eu"}, 1.5)
+	gauge.Resource, gauge.Unit = global, UnitMilliseconds
+	other := gaugePoint("custom.googleapis.com/checkout/latency", map[string]string{"region": "us"}, 2)
+	other.Resource = global
+	counter := &monpb.TimeSeries{
+		Metric:     &mpb.Metric{Type: "custom.googleapis.com/orders"},
+		Resource:   task,
+		MetricKind: mpb.MetricDescriptor_CUMULATIVE,
+		Points: []*monpb.Point{{
+			Interval: &monpb.TimeInterval{StartTime: start, EndTime: end},
+			Value:    &monpb.TypedValue{Value: &monpb.TypedValue_Int64Value{Int64Value: 7}},
+		}},
+	}
+	dist := &monpb.TimeSeries{
+		Metric:     &mpb.Metric{Type: "custom.googleapis.com/sizes"},
+		Resource:   task,
+		MetricKind: mpb.MetricDescriptor_CUMULATIVE,
+		Points: []*monpb.Point{{
+			Interval: &monpb.TimeInterval{StartTime: start, EndTime: end},
+			Value: &monpb.TypedValue{Value: &monpb.TypedValue_DistributionValue{DistributionValue: &distpb.Distribution{
+				Count: 3, Mean: 2,
+				BucketOptions: &distpb.Distribution_BucketOptions{Options: &distpb.Distribution_BucketOptions_ExplicitBuckets{
+					ExplicitBuckets: &distpb.Distribution_BucketOptions_Explicit{Bounds: []float64{1, 5}},
+				}},
+				BucketCounts: []int64{1, 2},
+			}}},
+		}},
+	}
+	str := &monpb.TimeSeries{
+		Metric:   &mpb.Metric{Type: "custom.googleapis.com/state"},
+		Resource: &gcprpb.MonitoredResource{Type: "gce_instance"},
+		Points:   []*monpb.Point{{Interval: &monpb.TimeInterval{EndTime: end}, Value: &monpb.TypedValue{Value: &monpb.TypedValue_StringValue{StringValue: "ok"}}}},
+	}
+
+	req := otlpRequest([]*monpb.TimeSeries{gauge, counter, other, dist, str})
+	if len(req.ResourceMetrics) != 2 {
+		t.Fatalf("got %d resources, want 2 with the string-only resource dropped", len(req.ResourceMetrics))
+	}
+
+	rm := req.ResourceMetrics[0]
+	if attrs := rm.GetResource().GetAttributes(); attrs[len(attrs)-1].GetValue().GetStringValue() != "global" {
+		t.Errorf("resource attributes = %v", attrs)
+	}
+	metrics := rm.GetScopeMetrics()[0].GetMetrics()
+	if len(metrics) != 1 || metrics[0].GetName() != "checkout/latency" || metrics[0].GetUnit() != UnitMilliseconds {
+		t.Fatalf("metrics = %v", metrics)
+	}
+	if pts := metrics[0].GetGauge().GetDataPoints(); len(pts) != 2 || pts[0].GetAsDouble() != 1.5 {
+		t.Errorf("gauge points = %v", pts)
+	}
+
+	metrics = req.ResourceMetrics[1].GetScopeMetrics()[0].GetMetrics()
+	if len(metrics) != 2 {
+		t.Fatalf("metrics = %v", metrics)
+	}
+	sum := metrics[0].GetSum()
+	if !sum.GetIsMonotonic() || sum.GetDataPoints()[0].GetAsInt() != 7 || sum.GetDataPoints()[0].GetStartTimeUnixNano() == 0 {
+		t.Errorf("sum = %v", sum)
+	}
+	hp := metrics[1].GetHistogram().GetDataPoints()[0]
+	if hp.GetCount() != 3 || hp.GetSum() != 6 || len(hp.GetBucketCounts()) != 3 || hp.GetBucketCounts()[1] != 2 {
+		t.Errorf("histogram point = %v", hp)
+	}
+}
+
+func TestOTLPHTTPExport(t *testing.T) {
+	var rejected int64
+	var failWith int // HTTP status to fail with when set
+	var gotHeader string
+	var got *colmetricpb.ExportMetricsServiceRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		if failWith != 0 {
+			http.Error(w, "overloaded", failWith)
+			return
+		}
+		gotHeader = r.Header.Get("X-Tenant")
+		body, _ := io.ReadAll(r.Body)
+		got = &colmetricpb.ExportMetricsServiceRequest{}
+		proto.Unmarshal(body, got)
+		resp := &colmetricpb.ExportMetricsServiceResponse{}
+		if rejected > 0 {
+			resp.PartialSuccess = &colmetricpb.ExportMetricsPartialSuccess{RejectedDataPoints: rejected, ErrorMessage: "bad point"}
+		}
+		out, _ := proto.Marshal(resp)
+		w.Write(out)
+	}))
+	defer srv.Close()
+
+	exp, err := NewOTLPExporter(OTLPConfig{Protocol: OTLPHTTP, Endpoint: srv.URL + "/", Headers: map[string]string{"X-Tenant": "shop"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Close()
+	ctx := context.Background()
+	series := []*monpb.TimeSeries{gaugePoint("custom.googleapis.com/checkout/latency", nil, 1)}
+	if err := exp.Export(ctx, series); err != nil {
+		t.Fatal(err)
+	}
+	if gotHeader != "shop" || len(got.GetResourceMetrics()) != 1 {
+		t.Errorf("header = %q, request = %v", gotHeader, got)
+	}
+
+	rejected = 1
+	if err := exp.Export(ctx, series); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("partial success = %v, want InvalidArgument", err)
+	}
+	failWith = http.StatusServiceUnavailable
+	if err := exp.Export(ctx, series); !retryable(err) || status.Code(err) != codes.Unavailable {
+		t.Errorf("503 = %v, want a retryable Unavailable", err)
+	}
+}
+
+// fakeCollector is an in-process OTLP/gRPC collector
+type fakeCollector struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+	mu       sync.Mutex
+	requests []*colmetricpb.ExportMetricsServiceRequest
+}
+
+func (f *fakeCollector) Export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLPGRPCEndpointFromEnvironment(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeCollector{}
+	srv := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(srv, fake)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	// As the OpenTelemetry operator injects it, with no OTEL_EXPORTER_OTLP_INSECURE
+	t.Setenv("METRICS_BACKEND", "otlp")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://"+lis.Addr().String())
+	c, err := New(context.Background(), WithProjectID("test-project"), WithLogger(discardLogger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.TryPushMetric(context.Background(), "checkout/latency", 12.5, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.requests) != 1 {
+		t.Fatalf("collector got %d requests, want 1", len(fake.requests))
+	}
+	m := fake.requests[0].GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics()[0]
+	if m.GetName() != "checkout/latency" || m.GetGauge().GetDataPoints()[0].GetAsDouble() != 12.5 {
+		t.Errorf("metric = %v", m)
+	}
+}
+
+func TestOTLPGRPCTarget(t *testing.T) {
+	tests := []struct {
+		endpoint, target string
+		insecure, ok     bool
+	}{
+		{"", "localhost:4317", false, true},
+		{"collector:4317", "collector:4317", false, true},
+		{"http://collector:4317", "collector:4317", true, true},
+		{"https://collector.example.com", "collector.example.com:4317", false, true},
+		{"ftp://collector:21", "", false, false},
+	}
+	for _, tt := range tests {
+		target, insecure, err := otlpGRPCTarget(tt.endpoint)
+		if (err == nil) != tt.ok || target != tt.target || insecure != tt.insecure {
+			t.Errorf("otlpGRPCTarget(%q) = %q, %v, %v", tt.endpoint, target, insecure, err)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// Percentiles defaults
+const (
+	defaultPercentileWindow = 5 * time.Minute
+	percentileSlices        = 5    // the window slides in steps of a fifth
+	percentileAccuracy      = 0.01 // relative error of the reported values
+)
+
+// DefaultQuantiles are the quantiles published when none are given
+var DefaultQuantiles = []float64{0.5, 0.95, 0.99}
+
+// Percentiles computes approximate quantiles of the values observed over a sliding
+// window and publishes each as a gauge on every flush, for dashboards that need p50 or
+// p99 lines without DISTRIBUTION metrics. Quantile 0.95 of metric "latency" is published
+// as "latency/p95". Values are kept in a sketch with 1% relative error, so memory
+// grows with the spread of the values, not their number. Prefer a Histogram where
+// percentiles across instances are needed: these can't be averaged meaningfully.
+type Percentiles struct {
+	client    *Client
+	name      string
+	window    time.Duration
+	quantiles []float64
+
+	mu     sync.Mutex
+	series map[string]*percentileSeries
+}
+
+// percentileSeries is the window of one label set
+type percentileSeries struct {
+	labels map[string]string
+	slices [percentileSlices]percentileSlice
+}
+
+// percentileSlice holds the values of one step of the window
+type percentileSlice struct {
+	step   int64 // time since the epoch in steps
+	sketch sketch
+}
+
+// NewPercentiles returns percentile gauges for metricName over window (5 minutes if
+// zero) for quantiles in (0, 1) (DefaultQuantiles if none). Like counters, they are
+// shared by name, a second NewPercentiles for the same metric returns the first one.
+func (c *Client) NewPercentiles(metricName string, window time.Duration, quantiles ...float64) (*Percentiles, error) {
+	if window <= 0 {
+		window = defaultPercentileWindow
+	}
+	if len(quantiles) == 0 {
+		quantiles = DefaultQuantiles
+	}
+	quantiles = append([]float64(nil), quantiles...)
+	sort.Float64s(quantiles)
+	for _, q := range quantiles {
+		if q <= 0 || q >= 1 {
+			return nil, fmt.Errorf("metrics: quantile must be between 0 and 1, got %v", q)
+		}
+	}
+
+	p := &Percentiles{client: c, name: metricName, window: window, quantiles: quantiles, series: make(map[string]*percentileSeries)}
+	if c == nil {
+		return p, nil // metrics disabled
+	}
+	existing, err := c.claim(metricName, KindPercentiles)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing.(*Percentiles), nil
+	}
+	c.remember(metricName, p, nil)
+	c.register(p)
+	return p, nil
+}
+
+// Observe adds v to the window for labels
+func (p *Percentiles) Observe(ctx context.Context, v float64, labels map[string]string) {
+	if p.client == nil || math.IsNaN(v) || math.IsInf(v, 0) { // nil when metrics are disabled
+		return
+	}
+	if _, ok := p.client.sample(p.name); !ok {
+		return
+	}
+	if !p.client.spendBudget(ctx, p.name, 1) || !p.client.checkLabels(p.name, labels) {
+		return
+	}
+	prepared := p.client.prepareLabels(p.name, p.client.withContextLabels(ctx, labels))
+	key := seriesKey(prepared)
+	step := time.Now().UnixNano() / int64(p.step())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.series[key]
+	if s == nil {
+		admitted, ok := p.client.cardinality.admit(p.name, prepared)
+		if !ok {
+			return
+		}
+		// A collapsed label set may already have a series of its own
+		key = seriesKey(admitted)
+		if s = p.series[key]; s == nil {
+			s = &percentileSeries{labels: admitted}
+			p.series[key] = s
+		}
+	}
+	if p.client.duplicate(ctx, p.name) {
+		return
+	}
+	sl := &s.slices[step%percentileSlices]
+	if sl.step != step {
+		*sl = percentileSlice{step: step}
+	}
+	sl.sketch.add(v)
+}
+
+// ObserveDuration adds d in the metric's declared time unit, or the client's duration unit
+func (p *Percentiles) ObserveDuration(ctx context.Context, d time.Duration, labels map[string]string) {
+	if p.client == nil {
+		return // metrics disabled
+	}
+	p.Observe(ctx, durationFloat(d, p.client.durationUnit(p.name)), labels)
+}
+
+// step is how far the window slides at a time
+func (p *Percentiles) step() time.Duration {
+	return max(p.window/percentileSlices, time.Millisecond)
+}
+
+// collect publishes the quantiles of every series with values in the window,
+// forgetting series without any
+func (p *Percentiles) collect(c *Client, now time.Time) []*monpb.TimeSeries {
+	var out []*monpb.TimeSeries
+	p.gauges(now, true, func(name string, v float64, labels map[string]string) {
+		if ts, err := c.buildGauge(now, nil, name, v, labels); err == nil {
+			out = append(out, ts)
+		}
+	})
+	return out
+}
+
+// snapshot computes the current quantiles, leaving series without values in place and
+// the cardinality guard untouched
+func (p *Percentiles) snapshot(c *Client, now time.Time) []*monpb.TimeSeries {
+	var out []*monpb.TimeSeries
+	p.gauges(now, false, func(name string, v float64, labels map[string]string) {
+		out = append(out, c.snapshotGauge(now, name, v, labels))
+	})
+	return out
+}
+
+// gauges passes the quantiles of every series with values in the window as of now to
+// add, deleting series without any when prune is set
+func (p *Percentiles) gauges(now time.Time, prune bool, add func(name string, v float64, labels map[string]string)) {
+	current := now.UnixNano() / int64(p.step())
+
+	p.mu.Lock()
+	merged := make(map[string]*sketch, len(p.series))
+	labels := make(map[string]map[string]string, len(p.series))
+	for key, s := range p.series {
+		var sk sketch
+		for i := range s.slices {
+			if sl := &s.slices[i]; current-sl.step < percentileSlices {
+				sk.merge(&sl.sketch)
+			}
+		}
+		if sk.count == 0 {
+			if prune {
+				delete(p.series, key)
+			}
+			continue
+		}
+		merged[key], labels[key] = &sk, s.labels
+	}
+	p.mu.Unlock()
+
+	for key, sk := range merged {
+		for _, q := range p.quantiles {
+			add(p.name+"/"+quantileName(q), sk.quantile(q), labels[key])
+		}
+	}
+}
+
+// quantileName renders 0.95 as "p95" and 0.999 as "p99.9"
+func quantileName(q float64) string {
+	pct := math.Round(q*1e6) / 1e4 // drops floating point noise, e.g. in 0.999*100
+	return "p" + strconv.FormatFloat(pct, 'f', -1, 64)
+}
+
+// sketch is a mergeable quantile sketch in the manner of DDSketch: values are counted
+// in logarithmically sized bins, so any quantile is reported within percentileAccuracy
+// of its true value
+type sketch struct {
+	pos, neg map[int]int64 // bin index of |v| to count
+	zero     int64
+	count    int64
+	min, max float64
+}
+
+// sketchGamma is the ratio between consecutive bin bounds
+var sketchGamma = (1 + percentileAccuracy) / (1 - percentileAccuracy)
+
+var sketchLogGamma = math.Log(sketchGamma)
+
+func (s *sketch) add(v float64) {
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	switch {
+	case v > 0:
+		if s.pos == nil {
+			s.pos = make(map[int]int64)
+		}
+		s.pos[sketchIndex(v)]++
+	case v < 0:
+		if s.neg == nil {
+			s.neg = make(map[int]int64)
+		}
+		s.neg[sketchIndex(-v)]++
+	default:
+		s.zero++
+	}
+}
+
+func (s *sketch) merge(o *sketch) {
+	if o.count == 0 {
+		return
+	}
+	if s.count == 0 || o.min < s.min {
+		s.min = o.min
+	}
+	if s.count == 0 || o.max > s.max {
+		s.max = o.max
+	}
+	s.count += o.count
+	s.zero += o.zero
+	for i, n := range o.pos {
+		if s.pos == nil {
+			s.pos = make(map[int]int64)
+		}
+		s.pos[i] += n
+	}
+	for i, n := range o.neg {
+		if s.neg == nil {
+			s.neg = make(map[int]int64)
+		}
+		s.neg[i] += n
+	}
+}
+
+// quantile returns the approximate value at quantile q of a non-empty sketch
+func (s *sketch) quantile(q float64) float64 {
+	rank := int64(q * float64(s.count-1))
+	var seen int64
+
+	// Ascending order: negatives from the largest magnitude, zero, then positives
+	neg := sortedBins(s.neg)
+	for i := len(neg) - 1; i >= 0; i-- {
+		if seen += s.neg[neg[i]]; seen > rank {
+			return clamp(-sketchValue(neg[i]), s.min, s.max)
+		}
+	}
+	if seen += s.zero; seen > rank {
+		return 0
+	}
+	for _, idx := range sortedBins(s.pos) {
+		if seen += s.pos[idx]; seen > rank {
+			return clamp(sketchValue(idx), s.min, s.max)
+		}
+	}
+	return s.max
+}
+
+// sketchIndex returns the bin of v > 0, covering (gamma^(i-1), gamma^i]
+func sketchIndex(v float64) int {
+	return int(math.Ceil(math.Log(v) / sketchLogGamma))
+}
+
+// sketchValue returns the value representing bin i, within percentileAccuracy of any value in it
+func sketchValue(i int) float64 {
+	return 2 * math.Pow(sketchGamma, float64(i)) / (sketchGamma + 1)
+}
+
+func sortedBins(bins map[int]int64) []int {
+	out := make([]int, 0, len(bins))
+	for i := range bins {
+		out = append(out, i)
+	}
+	sort.Ints(out)
+	return out
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Min(math.Max(v, lo), hi)
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSketchQuantiles(t *testing.T) {
+	var s sketch
+	for v := -100; v <= 1000; v++ {
+		s.add(float64(v))
+	}
+	for q, want := range map[float64]float64{0.01: -90, 0.5: 450, 0.99: 989} {
+		if got := s.quantile(q); math.Abs(got-want) > math.Abs(want)*percentileAccuracy {
+			t.Errorf("quantile(%v) = %v, want %v within 1%%", q, got, want)
+		}
+	}
+
+	var merged sketch
+	merged.merge(&s)
+	merged.add(0)
+	if merged.count != s.count+1 || merged.min != -100 || merged.max != 1000 {
+		t.Errorf("merged count %d, range [%v, %v]", merged.count, merged.min, merged.max)
+	}
+}
+
+func TestPercentilesWindow(t *testing.T) {
+	c, _ := newTestClient(t)
+	p, err := c.NewPercentiles("latency", time.Minute, 0.5, 0.999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for v := 1; v <= 100; v++ {
+		p.Observe(ctx, float64(v), nil)
+	}
+	p.Observe(ctx, math.NaN(), nil)
+
+	got := map[string]float64{}
+	for _, ts := range p.collect(c, time.Now()) {
+		got[ts.GetMetric().GetType()] = ts.GetPoints()[0].GetValue().GetDoubleValue()
+	}
+	if v := got["custom.googleapis.com/latency/p50"]; math.Abs(v-50) > 50*percentileAccuracy {
+		t.Errorf("p50 = %v, want 50", v)
+	}
+	if v := got["custom.googleapis.com/latency/p99.9"]; math.Abs(v-99) > 99*percentileAccuracy {
+		t.Errorf("p99.9 = %v, want 99", v)
+	}
+
+	if out := p.collect(c, time.Now().Add(time.Minute+p.step())); len(out) != 0 {
+		t.Errorf("published %d series after the window passed, want none", len(out))
+	}
+	if len(p.series) != 0 {
+		t.Error("series without values in the window kept")
+	}
+}
+
+func TestNewPercentilesValidates(t *testing.T) {
+	c, _ := newTestClient(t)
+	if _, err := c.NewPercentiles("latency", 0, 0.5, 1); err == nil {
+		t.Error("quantile of 1 accepted")
+	}
+}
+
+func TestQuantileName(t *testing.T) {
+	for q, want := range map[float64]string{0.5: "p50", 0.95: "p95", 0.999: "p99.9"} {
+		if got := quantileName(q); got != want {
+			t.Errorf("quantileName(%v) = %q, want %q", q, got, want)
+		}
+	}
+}
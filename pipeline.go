@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// emit hands freshly recorded series to the pipeline, dropping those of disabled or
+// filtered metrics. Series covered by the WAL are logged before emit returns. When
+// buffering, the rest wait for the next flush; otherwise everything is exported before
+// emit returns.
+func (c *Client) emit(ctx context.Context, series []*monpb.TimeSeries) {
+	if series = c.enabledSeries(series); len(series) == 0 {
+		return
+	}
+	if c.wal != nil {
+		direct := series[:0:0]
+		logged := false
+		for _, ts := range series {
+			if !c.wal.covers(ts) {
+				direct = append(direct, ts)
+				continue
+			}
+			if err := c.wal.append(ts); err != nil {
+				c.logger.Error("could not append to wal, exporting directly", "error", err)
+				direct = append(direct, ts)
+				continue
+			}
+			logged = true
+		}
+		if logged && c.buffer == nil {
+			if c.cfg.detached {
+				c.detach(ctx, func(ctx context.Context) { c.recordDuplicates(ctx, c.wal.replay(ctx, c.export)) })
+			} else {
+				c.recordDuplicates(ctx, c.wal.replay(ctx, c.export))
+			}
+		}
+		series = direct
+	}
+	if c.classes != nil {
+		series = c.route(ctx, series)
+	}
+	if len(series) == 0 {
+		return
+	}
+
+	switch {
+	case c.buffer != nil:
+		c.buffer.add(series)
+	case c.cfg.detached:
+		c.detach(ctx, func(ctx context.Context) { c.send(ctx, series) })
+	default:
+		c.send(ctx, series)
+	}
+}
+
+// send exports series in request-sized batches, spooling batches that fail while offline
+func (c *Client) send(ctx context.Context, series []*monpb.TimeSeries) {
+	ctx, span := c.startSpan(ctx, "metrics.send", len(series))
+	defer span.End()
+	for len(series) > 0 {
+		n := min(len(series), maxSeriesPerRequest)
+		if c.pool != nil {
+			c.enqueue(ctx, series[:n])
+		} else {
+			c.sendBatch(ctx, series[:n])
+		}
+		series = series[n:]
+	}
+}
+
+// sendBatch exports one batch of at most maxSeriesPerRequest series, which are done with
+// once it returns
+func (c *Client) sendBatch(ctx context.Context, series []*monpb.TimeSeries) {
+	defer c.release(series)
+	// While batches are waiting on disk, queue behind them so points stay in order
+	if c.spool != nil && !c.spool.empty() {
+		err := c.spool.save(series)
+		if err == nil {
+			c.recordDuplicates(ctx, c.spool.replay(ctx, c.export))
+			return
+		}
+		c.logger.Error("could not spool batch, exporting directly", "error", err)
+	}
+
+	if err := c.export(ctx, series); err != nil {
+		if c.spool != nil && retryable(err) {
+			serr := c.spool.save(series)
+			if serr == nil {
+				c.failLog.Warn("could not write time series, batch spooled for retry", "series", len(series), "error", err)
+				return
+			}
+			c.logger.Error("could not spool batch", "error", serr)
+		}
+		c.failLog.Error("could not write time series", "series", len(series), "error", err)
+	}
+}
+
+// export hands series to the exporter in a single call, bounded by the export timeout
+func (c *Client) export(ctx context.Context, series []*monpb.TimeSeries) error {
+	ctx, cancel := c.exportContext(ctx)
+	defer cancel()
+	ctx, span := c.startSpan(ctx, "metrics.export", len(series))
+	started := time.Now()
+	err := c.exporter.Export(ctx, series)
+	endExportSpan(span, err, len(series))
+
+	// Points the API already has are counted as duplicates, not errors
+	failed := false
+	if err != nil {
+		_, only := duplicatePoints(err, len(series))
+		failed = !only
+	}
+	c.health.observe(time.Since(started), c.exportTimeout(), failed)
+	if failed && c.errors != nil {
+		c.errors.record(err, series)
+	}
+	return err
+}
+
+// seriesIdentity returns a key that is equal for points of the same time series
+func seriesIdentity(ts *monpb.TimeSeries) string {
+	return ts.GetMetric().GetType() + "\x00" + seriesKey(ts.GetMetric().GetLabels()) +
+		"\x00" + ts.GetResource().GetType() + "\x00" + seriesKey(ts.GetResource().GetLabels())
+}
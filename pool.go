@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// WithExportWorkers exports batches from a pool of workers goroutines instead of one
+// at a time on the calling goroutine, so a large flush or a burst of PushMetric calls
+// isn't limited by the latency of a single export. Up to queueDepth batches wait for a
+// worker; once the queue is full, callers block until a worker frees a slot, or drop the
+// batch if their context is done first. Batches may then reach the exporter out of
+// order. Flush and Close wait for queued batches. A queueDepth of 0 means 2*workers.
+func WithExportWorkers(workers, queueDepth int) Option {
+	return func(c *config) {
+		c.exportWorkers = workers
+		c.exportQueue = queueDepth
+	}
+}
+
+// exportPool runs sendBatch on a fixed set of workers
+type exportPool struct {
+	jobs chan exportJob
+	wg   sync.WaitGroup
+
+	mu     sync.RWMutex // held for reading while enqueueing, so stop can close jobs safely
+	closed bool
+}
+
+type exportJob struct {
+	ctx    context.Context
+	series []*monpb.TimeSeries
+}
+
+// startPool starts the export workers configured for c
+func (c *Client) startPool() {
+	queue := c.cfg.exportQueue
+	if queue <= 0 {
+		queue = 2 * c.cfg.exportWorkers
+	}
+	p := &exportPool{jobs: make(chan exportJob, queue)}
+	for range c.cfg.exportWorkers {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				c.sendBatch(job.ctx, job.series)
+				c.inflight.done()
+			}
+		}()
+	}
+	c.pool = p
+}
+
+// enqueue hands one batch to the workers, exporting it directly once the pool is stopped
+func (c *Client) enqueue(ctx context.Context, series []*monpb.TimeSeries) {
+	p := c.pool
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		c.sendBatch(ctx, series)
+		return
+	}
+	defer p.mu.RUnlock()
+
+	c.inflight.add()
+	job := exportJob{ctx: context.WithoutCancel(ctx), series: series}
+	select {
+	case p.jobs <- job:
+		return
+	default:
+	}
+	select {
+	case p.jobs <- job:
+	case <-ctx.Done():
+		c.inflight.done()
+		c.failLog.Error("export queue full, dropping batch", "series", len(series), "error", ctx.Err())
+	}
+}
+
+// depth returns the queued batches as a share of the queue size
+func (p *exportPool) depth() float64 {
+	return float64(len(p.jobs)) / float64(cap(p.jobs))
+}
+
+// stop lets the workers finish the queue and waits for them to exit
+func (p *exportPool) stop() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// blockingExporter holds every Export until release is closed
+type blockingExporter struct {
+	captureExporter
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newBlockingExporter() *blockingExporter {
+	return &blockingExporter{started: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (e *blockingExporter) Export(ctx context.Context, series []*monpb.TimeSeries) error {
+	e.started <- struct{}{}
+	<-e.release
+	return e.captureExporter.Export(ctx, series)
+}
+
+func (e *blockingExporter) unblock() { e.once.Do(func() { close(e.release) }) }
+
+func TestExportWorkersFlushWaitsForQueue(t *testing.T) {
+	c, exp := newTestClient(t, WithExportWorkers(4, 0), WithFlushInterval(time.Hour))
+	ctx := context.Background()
+	for i := range 450 {
+		c.PushMetric(ctx, "jobs/size", i, map[string]string{"job": fmt.Sprint(i)})
+	}
+	c.Flush(ctx)
+	if n := len(exp.exported()); n != 450 {
+		t.Errorf("exported %d series after Flush, want 450", n)
+	}
+}
+
+func TestExportQueueFullDropsWhenContextDone(t *testing.T) {
+	exp := newBlockingExporter()
+	c, err := New(context.Background(), WithProjectID("test-project"), WithLogger(discardLogger),
+		WithExporter(exp), WithExportWorkers(1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		exp.unblock()
+		c.Close()
+	}()
+
+	ctx := context.Background()
+	c.PushMetric(ctx, "a", 1, nil)
+	<-exp.started // the only worker is busy
+	c.PushMetric(ctx, "b", 1, nil)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		c.PushMetric(cancelled, "c", 1, nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("PushMetric blocked on a full queue with a cancelled context")
+	}
+
+	exp.unblock()
+	c.Flush(ctx)
+	if got := exp.byType("custom.googleapis.com/c"); len(got) != 0 {
+		t.Errorf("dropped batch was exported: %v", got)
+	}
+	if n := len(exp.exported()); n != 2 {
+		t.Errorf("exported %d series, want 2", n)
+	}
+}
+
+func TestExportAfterPoolStopIsDirect(t *testing.T) {
+	c, exp := newTestClient(t, WithExportWorkers(2, 0))
+	c.pool.stop()
+	c.PushMetric(context.Background(), "late/metric", 1, nil)
+	if n := len(exp.byType("custom.googleapis.com/late/metric")); n != 1 {
+		t.Errorf("exported %d series after the pool stopped, want 1", n)
+	}
+}
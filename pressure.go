@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Pressure tuning: the weight of each new export in the moving averages, and the queue
+// sizes counted as full
+const (
+	pressureAlpha       = 0.2
+	pressureQueueSeries = 50 * maxSeriesPerRequest
+	pressureInflight    = 64
+)
+
+// exportHealth keeps moving averages of export latency and failures
+type exportHealth struct {
+	mu       sync.Mutex
+	latency  float64 // share of the export timeout used, 0 to 1
+	failures float64 // share of exports failing, 0 to 1
+}
+
+// observe folds one export into the averages
+func (h *exportHealth) observe(took, timeout time.Duration, failed bool) {
+	lat := math.Min(float64(took)/float64(timeout), 1)
+	fail := 0.0
+	if failed {
+		fail = 1
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.latency += pressureAlpha * (lat - h.latency)
+	h.failures += pressureAlpha * (fail - h.failures)
+}
+
+func (h *exportHealth) load() (latency, failures float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.latency, h.failures
+}
+
+// Pressure returns how strained the metrics pipeline is, from 0 (idle) to 1 (saturated),
+// for use as an input to load shedding or admission control. It is the highest of:
+//
+//   - queue depth: points buffered for the next flush, spooled bytes against the spool
+//     cap, batches waiting for an export worker, and detached exports in flight
+//   - export latency: a moving average of export time as a share of the export timeout
+//   - failure rate: a moving average of the share of exports that fail
+//
+// A value near 1 usually means Cloud Monitoring is slow or unreachable, which often
+// accompanies wider trouble the application may want to back off from.
+func (c *Client) Pressure() float64 {
+	queue := float64(c.inflight.count()) / pressureInflight
+	if c.buffer != nil {
+		queue = math.Max(queue, float64(c.buffer.len())/pressureQueueSeries)
+	}
+	if c.spool != nil {
+		queue = math.Max(queue, c.spool.fill())
+	}
+	if c.pool != nil {
+		queue = math.Max(queue, c.pool.depth())
+	}
+	latency, failures := c.health.load()
+	return math.Min(math.Max(queue, math.Max(latency, failures)), 1)
+}
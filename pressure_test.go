@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestExportHealth(t *testing.T) {
+	var h exportHealth
+	h.observe(2*time.Second, time.Second, false) // capped at the whole timeout
+	h.observe(0, time.Second, true)
+	latency, failures := h.load()
+	if want := 0.8 * pressureAlpha; math.Abs(latency-want) > 1e-9 {
+		t.Errorf("latency = %v, want %v", latency, want)
+	}
+	if math.Abs(failures-pressureAlpha) > 1e-9 {
+		t.Errorf("failures = %v, want %v", failures, pressureAlpha)
+	}
+}
+
+func TestPressureRisesWithFailures(t *testing.T) {
+	c, exp := newTestClient(t)
+	ctx := context.Background()
+	c.PushMetric(ctx, "orders/open", 1, nil)
+	if p := c.Pressure(); p > 0.1 {
+		t.Errorf("Pressure() = %v after a healthy export, want near 0", p)
+	}
+
+	exp.mu.Lock()
+	exp.err = errors.New("unavailable")
+	exp.mu.Unlock()
+	for i := 0; i < 10; i++ {
+		c.PushMetric(ctx, "orders/open", 1, nil)
+	}
+	if p := c.Pressure(); p < 0.8 || p > 1 {
+		t.Errorf("Pressure() = %v after failing exports, want near 1", p)
+	}
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// Priority assigns a metric to a class with its own flush interval and drop policy
+type Priority int
+
+const (
+	// PriorityNormal metrics follow WithFlushInterval and are never dropped for pressure
+	PriorityNormal Priority = iota
+	// PriorityCritical metrics, such as payment failures, are exported as soon as they are
+	// recorded, even when the Client buffers, and are never dropped for pressure
+	PriorityCritical
+	// PriorityLow metrics, such as debug counters, are exported every minute and dropped
+	// while Pressure is above 0.5
+	PriorityLow
+)
+
+// PriorityClass is the behavior of a Priority
+type PriorityClass struct {
+	// FlushInterval is how often points are exported, 0 exports them as they are
+	// recorded. It doesn't apply to PriorityNormal, which uses WithFlushInterval.
+	FlushInterval time.Duration
+	// DropAbove drops new points while Pressure is above it, 0 never drops
+	DropAbove float64
+}
+
+// defaultPriorityClasses are the classes used unless WithPriorityClass overrides them
+var defaultPriorityClasses = map[Priority]PriorityClass{
+	PriorityCritical: {},
+	PriorityLow:      {FlushInterval: time.Minute, DropAbove: 0.5},
+}
+
+// WithPriority assigns metricName to priority p. Metrics default to PriorityNormal.
+func WithPriority(metricName string, p Priority) Option {
+	return func(c *config) {
+		if c.priorities == nil {
+			c.priorities = make(map[string]Priority)
+		}
+		c.priorities[metricName] = p
+	}
+}
+
+// WithPriorityClass changes the flush interval and drop policy of priority p
+func WithPriorityClass(p Priority, cls PriorityClass) Option {
+	return func(c *config) {
+		if c.priorityClasses == nil {
+			c.priorityClasses = make(map[Priority]PriorityClass)
+		}
+		c.priorityClasses[p] = cls
+	}
+}
+
+// priorityClass is the running state of a class
+type priorityClass struct {
+	PriorityClass
+	buffer *pointBuffer // nil when points are exported as they are recorded
+}
+
+// startPriorities sets up the classes of the metrics given priorities, starting a flush
+// loop for each class with its own interval
+func (c *Client) startPriorities() {
+	c.priorityOf = make(map[string]Priority, len(c.cfg.priorities))
+	for name, p := range c.cfg.priorities {
+		c.priorityOf[c.metricType(name)] = p
+	}
+	c.classes = make(map[Priority]*priorityClass)
+	used := make([]Priority, 0, len(c.priorityOf)+1)
+	for _, p := range c.priorityOf {
+		used = append(used, p)
+	}
+	if _, ok := c.cfg.priorityClasses[PriorityNormal]; ok {
+		used = append(used, PriorityNormal) // applies to every unassigned metric
+	}
+	for _, p := range used {
+		if _, ok := c.classes[p]; ok {
+			continue
+		}
+		cls, ok := c.cfg.priorityClasses[p]
+		if !ok {
+			cls = defaultPriorityClasses[p]
+		}
+		pc := &priorityClass{PriorityClass: cls}
+		if p != PriorityNormal && cls.FlushInterval > 0 {
+			pc.buffer = newPointBuffer()
+			c.classLoops.Add(1)
+			go c.runClassFlusher(pc)
+		}
+		c.classes[p] = pc
+	}
+}
+
+// runClassFlusher exports the buffer of pc every interval until the Client is closed
+func (c *Client) runClassFlusher(pc *priorityClass) {
+	defer c.classLoops.Done()
+	ticker := time.NewTicker(pc.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.flushClass(context.Background(), pc)
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// flushClass exports everything pc has buffered
+func (c *Client) flushClass(ctx context.Context, pc *priorityClass) {
+	if series := pc.buffer.drain(); len(series) > 0 {
+		c.send(ctx, series)
+	}
+}
+
+// route handles series of metrics with a priority other than normal, returning the
+// rest for the normal path. Metrics without a priority are PriorityNormal, which only
+// has a class if WithPriorityClass configured one.
+func (c *Client) route(ctx context.Context, series []*monpb.TimeSeries) []*monpb.TimeSeries {
+	normal := series[:0:0]
+	var now []*monpb.TimeSeries
+	var pressure *float64 // computed once, if a class needs it
+	for _, ts := range series {
+		p, ok := c.priorityOf[ts.GetMetric().GetType()]
+		if !ok {
+			p = PriorityNormal
+		}
+		pc := c.classes[p]
+		if pc == nil {
+			normal = append(normal, ts)
+			continue
+		}
+		if pc.DropAbove > 0 {
+			if pressure == nil {
+				p := c.Pressure()
+				pressure = &p
+			}
+			if *pressure > pc.DropAbove {
+				c.stats.priorityDrops.Add(1)
+				c.startSelfMetrics()
+				continue
+			}
+		}
+		switch {
+		case pc.buffer != nil:
+			pc.buffer.add([]*monpb.TimeSeries{ts})
+		case p == PriorityNormal:
+			normal = append(normal, ts)
+		default:
+			now = append(now, ts)
+		}
+	}
+	if len(now) > 0 {
+		if c.cfg.detached {
+			c.detach(ctx, func(ctx context.Context) { c.send(ctx, now) })
+		} else {
+			c.send(ctx, now)
+		}
+	}
+	return normal
+}
+
+// flushClasses exports the buffers of every class
+func (c *Client) flushClasses(ctx context.Context) {
+	for _, pc := range c.classes {
+		if pc.buffer != nil {
+			c.flushClass(ctx, pc)
+		}
+	}
+}
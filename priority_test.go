@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPriorityRouting(t *testing.T) {
+	c, exp := newTestClient(t,
+		WithFlushInterval(time.Hour),
+		WithPriority("payments/failed", PriorityCritical),
+		WithPriority("debug/ticks", PriorityLow),
+		WithPriorityClass(PriorityCritical, PriorityClass{}),
+		WithPriorityClass(PriorityLow, PriorityClass{FlushInterval: time.Hour}))
+	ctx := context.Background()
+	c.PushMetric(ctx, "payments/failed", 1, nil)
+	c.PushMetric(ctx, "debug/ticks", 1, nil)
+	c.PushMetric(ctx, "orders", 1, nil) // no priority
+
+	if len(exp.byType("custom.googleapis.com/payments/failed")) != 1 {
+		t.Error("critical point not exported as it was recorded")
+	}
+	if len(exp.byType("custom.googleapis.com/orders")) != 0 || len(exp.byType("custom.googleapis.com/debug/ticks")) != 0 {
+		t.Error("buffered points exported before a flush")
+	}
+
+	c.Flush(ctx)
+	for _, typ := range []string{"orders", "debug/ticks"} {
+		if len(exp.byType("custom.googleapis.com/"+typ)) != 1 {
+			t.Errorf("%s not exported by Flush", typ)
+		}
+	}
+}
+
+func TestUnassignedMetricsWithoutNormalClass(t *testing.T) {
+	// Classes configured, none of them normal, and no metric assigned
+	c, exp := newTestClient(t, WithPriorityClass(PriorityLow, PriorityClass{DropAbove: 0.1}))
+	c.PushMetric(context.Background(), "orders", 1, nil)
+	if len(exp.byType("custom.googleapis.com/orders")) != 1 {
+		t.Error("unassigned metric dropped")
+	}
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/pubsub/v2"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+// PubSubFormat selects how points are encoded in Pub/Sub messages
+type PubSubFormat int
+
+const (
+	// PubSubJSON publishes one message per point, in the JSON shape of NewJSONExporter
+	PubSubJSON PubSubFormat = iota
+	// PubSubProto publishes one message per series, a serialized monitoring.v3.TimeSeries
+	PubSubProto
+)
+
+// PubSubConfig configures the Pub/Sub exporter
+type PubSubConfig struct {
+	ProjectID string // project of the topic, defaults to the Client's project
+	Topic     string // topic ID or projects/<p>/topics/<t>
+	Format    PubSubFormat
+}
+
+// WithPubSub publishes every point to a Pub/Sub topic as well as exporting it as usual,
+// so downstream pipelines such as Dataflow or a BigQuery subscription see the same data.
+// To publish to Pub/Sub only, pass NewPubSubExporter to WithExporter instead. Publish
+// failures are logged and counted in metrics_client/secondary_export_failures, but
+// don't make the batch retry. Batches retried for Cloud Monitoring are published again,
+// so consumers should deduplicate on the metric, labels and time attributes.
+func WithPubSub(cfg PubSubConfig) Option {
+	return func(c *config) {
+		c.pubsub = &cfg
+	}
+}
+
+// pubsubExporter publishes points to a topic
+type pubsubExporter struct {
+	client    *pubsub.Client
+	publisher *pubsub.Publisher
+	format    PubSubFormat
+}
+
+// NewPubSubExporter returns an Exporter that publishes points to a Pub/Sub topic.
+// Messages carry metric and kind attributes for filtering subscriptions.
+func NewPubSubExporter(ctx context.Context, cfg PubSubConfig) (Exporter, error) {
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("metrics: pub/sub exporter needs a topic")
+	}
+	if cfg.ProjectID == "" {
+		cfg.ProjectID = getProjectID()
+	}
+	client, err := pubsub.NewClient(ctx, cfg.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: create pub/sub client: %w", err)
+	}
+	return &pubsubExporter{client: client, publisher: client.Publisher(cfg.Topic), format: cfg.Format}, nil
+}
+
+func (e *pubsubExporter) Export(ctx context.Context, series []*monpb.TimeSeries) error {
+	var results []*pubsub.PublishResult
+	for _, ts := range series {
+		msgs, err := e.messages(ts)
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			results = append(results, e.publisher.Publish(ctx, m))
+		}
+	}
+
+	var errs []error
+	for _, r := range results {
+		if _, err := r.Get(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("metrics: %d of %d messages not published: %w", len(errs), len(results), errs[0])
+	}
+	return nil
+}
+
+// messages encodes ts in the configured format
+func (e *pubsubExporter) messages(ts *monpb.TimeSeries) ([]*pubsub.Message, error) {
+	attrs := map[string]string{
+		"metric": ts.GetMetric().GetType(),
+		"kind":   ts.GetMetricKind().String(),
+	}
+	if e.format == PubSubProto {
+		data, err := proto.Marshal(ts)
+		if err != nil {
+			return nil, err
+		}
+		return []*pubsub.Message{{Data: data, Attributes: attrs}}, nil
+	}
+
+	var msgs []*pubsub.Message
+	for _, jp := range jsonPoints(ts) {
+		data, err := json.Marshal(jp)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, &pubsub.Message{Data: data, Attributes: attrs})
+	}
+	return msgs, nil
+}
+
+func (e *pubsubExporter) Close() error {
+	e.publisher.Stop() // flushes outstanding messages
+	return e.client.Close()
+}
+
+// fanoutExporter exports to a primary exporter and then to secondary ones
+type fanoutExporter struct {
+	exporters []Exporter
+	failed    func(err error, series int) // reports a secondary failure, set by New
+}
+
+// Export returns only the primary exporter's error, so retries and spooling follow it
+// alone. Secondary failures are reported to failed instead.
+func (f *fanoutExporter) Export(ctx context.Context, series []*monpb.TimeSeries) error {
+	err := f.exporters[0].Export(ctx, series)
+	for _, e := range f.exporters[1:] {
+		if serr := e.Export(ctx, series); serr != nil && f.failed != nil {
+			f.failed(serr, len(series))
+		}
+	}
+	return err
+}
+
+func (f *fanoutExporter) Close() error {
+	var errs []error
+	for _, e := range f.exporters {
+		errs = append(errs, e.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPubSubMessages(t *testing.T) {
+	ts := gaugePoint("custom.googleapis.com/orders", map[string]string{"region": "eu"}, 2)
+
+	msgs, err := (&pubsubExporter{format: PubSubJSON}).messages(ts)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("messages = %v, %v", msgs, err)
+	}
+	var jp jsonPoint
+	if err := json.Unmarshal(msgs[0].Data, &jp); err != nil || jp.Metric != "custom.googleapis.com/orders" || jp.Labels["region"] != "eu" {
+		t.Errorf("JSON message = %s, %v", msgs[0].Data, err)
+	}
+	if msgs[0].Attributes["metric"] != "custom.googleapis.com/orders" || msgs[0].Attributes["kind"] == "" {
+		t.Errorf("attributes = %v", msgs[0].Attributes)
+	}
+
+	msgs, err = (&pubsubExporter{format: PubSubProto}).messages(ts)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("messages = %v, %v", msgs, err)
+	}
+	got := &monpb.TimeSeries{}
+	if err := proto.Unmarshal(msgs[0].Data, got); err != nil || !proto.Equal(got, ts) {
+		t.Errorf("proto message = %v, %v", got, err)
+	}
+}
+
+func TestFanoutSecondaryFailureIsNotRetried(t *testing.T) {
+	c, primary := newTestClient(t, WithSpool(t.TempDir(), 0, 0))
+	secondary := &captureExporter{err: status.Error(codes.Unavailable, "pub/sub down")}
+	c.exporter = &fanoutExporter{exporters: []Exporter{primary, secondary}, failed: c.secondaryFailed}
+	ctx := context.Background()
+
+	c.PushMetric(ctx, "orders/open", 1, nil)
+	if n := len(primary.byType("custom.googleapis.com/orders/open")); n != 1 {
+		t.Fatalf("primary got %d series, want 1", n)
+	}
+	if !c.spool.empty() {
+		t.Error("batch the primary accepted was spooled for a secondary failure")
+	}
+	if n := c.stats.secondary.Load(); n != 1 {
+		t.Errorf("secondary failures = %d, want 1", n)
+	}
+
+	c.Flush(ctx)
+	got := primary.byType("custom.googleapis.com/" + selfMetricPrefix + "secondary_export_failures")
+	if len(got) != 1 || got[0].GetPoints()[0].GetValue().GetInt64Value() != 1 {
+		t.Errorf("self metric = %v", got)
+	}
+
+	// The primary's error still decides retries
+	primary.mu.Lock()
+	primary.err = status.Error(codes.Unavailable, "offline")
+	primary.mu.Unlock()
+	c.PushMetric(ctx, "orders/open", 2, nil)
+	if c.spool.empty() {
+		t.Error("primary failure was not spooled")
+	}
+}
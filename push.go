@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Number is the set of types Push accepts, including named types such as time.Duration
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Label is one metric label, for the variadic label lists of Push
+type Label struct {
+	Key, Value string
+}
+
+// L returns a Label
+func L(key, value string) Label {
+	return Label{Key: key, Value: value}
+}
+
+// WithDurationUnit sets the unit time.Duration values are recorded in: UnitMilliseconds
+// (the default), UnitSeconds, UnitMicroseconds or UnitNanoseconds
+func WithDurationUnit(unit string) Option {
+	return func(c *config) {
+		c.durationUnit = unit
+	}
+}
+
+// Push records a gauge through the package-level client. Unlike PushMetric the value's
+// type is checked at compile time; integers are written as INT64 (as DOUBLE once past
+// the INT64 range) and floats as DOUBLE. A time.Duration is converted to the configured
+// duration unit.
+func Push[T Number](ctx context.Context, metricName string, v T, labels ...Label) {
+	initClient(ctx)
+	if defaultClient == nil {
+		return // metrics disabled
+	}
+	PushTo(defaultClient, ctx, callerScope().name(metricName), v, labels...)
+}
+
+// PushTo is Push for a specific Client
+func PushTo[T Number](c *Client, ctx context.Context, metricName string, v T, labels ...Label) {
+	var value interface{}
+	if d, ok := any(v).(time.Duration); ok {
+		value = durationValue(d, c.durationUnit(metricName))
+	} else {
+		value = numberValue(v)
+	}
+	c.PushMetric(ctx, metricName, value, labelMap(labels))
+}
+
+// PushDuration records d in the metric's declared time unit, or the configured duration unit
+func (c *Client) PushDuration(ctx context.Context, metricName string, d time.Duration, labels map[string]string) {
+	c.PushMetric(ctx, metricName, durationValue(d, c.durationUnit(metricName)), labels)
+}
+
+// numberValue converts v to the int64 or float64 PushMetric records
+func numberValue[T Number](v T) interface{} {
+	var one T = 1
+	if one/2 != 0 {
+		return float64(v) // floating point
+	}
+	if v < 0 || uint64(v) <= math.MaxInt64 {
+		return int64(v)
+	}
+	return float64(v)
+}
+
+// durationValue converts d to unit, keeping nanoseconds as an integer
+func durationValue(d time.Duration, unit string) interface{} {
+	if unit == UnitNanoseconds {
+		return int64(d)
+	}
+	return durationFloat(d, unit)
+}
+
+// durationFloat converts d to unit, milliseconds if unit is unknown
+func durationFloat(d time.Duration, unit string) float64 {
+	switch unit {
+	case UnitNanoseconds:
+		return float64(d)
+	case UnitMicroseconds:
+		return float64(d) / float64(time.Microsecond)
+	case UnitSeconds:
+		return d.Seconds()
+	}
+	return float64(d) / float64(time.Millisecond)
+}
+
+// labelMap converts a label list, later labels overriding earlier ones with the same key
+func labelMap(labels []Label) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(labels))
+	for _, l := range labels {
+		m[l.Key] = l.Value
+	}
+	return m
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+type queueDepth uint16
+
+func TestPushTo(t *testing.T) {
+	c, exp := newTestClient(t)
+	ctx := context.Background()
+	PushTo(c, ctx, "int", -3)
+	PushTo(c, ctx, "named", queueDepth(7))
+	PushTo(c, ctx, "huge", uint64(math.MaxUint64))
+	PushTo(c, ctx, "float", float32(0.5))
+	PushTo(c, ctx, "latency", 1500*time.Microsecond)
+	PushTo(c, ctx, "labelled", 1, L("region", "eu"), L("region", "us"))
+
+	tests := []struct {
+		metric string
+		want   *monpb.TypedValue
+	}{
+		{"int", int64Value(-3)},
+		{"named", int64Value(7)},
+		{"huge", doubleValue(math.MaxUint64)},
+		{"float", doubleValue(0.5)},
+		{"latency", doubleValue(1.5)},
+	}
+	for _, tt := range tests {
+		got := exp.byType("custom.googleapis.com/" + tt.metric)
+		if len(got) != 1 {
+			t.Errorf("%s: exported %d series, want 1", tt.metric, len(got))
+			continue
+		}
+		if v := got[0].GetPoints()[0].GetValue(); !proto.Equal(v, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.metric, v, tt.want)
+		}
+	}
+	if got := exp.byType("custom.googleapis.com/labelled"); len(got) != 1 || got[0].GetMetric().GetLabels()["region"] != "us" {
+		t.Errorf("labelled exported %v, want the later region label", got)
+	}
+}
@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3"
+	"google.golang.org/api/iterator"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Aligner and Reducer are Cloud Monitoring's per-series and cross-series aggregations
+type (
+	Aligner = monpb.Aggregation_Aligner
+	Reducer = monpb.Aggregation_Reducer
+)
+
+// Common aligners and reducers, see monitoring.v3.Aggregation for the rest
+const (
+	AlignNone         = monpb.Aggregation_ALIGN_NONE
+	AlignMean         = monpb.Aggregation_ALIGN_MEAN
+	AlignSum          = monpb.Aggregation_ALIGN_SUM
+	AlignMin          = monpb.Aggregation_ALIGN_MIN
+	AlignMax          = monpb.Aggregation_ALIGN_MAX
+	AlignRate         = monpb.Aggregation_ALIGN_RATE
+	AlignDelta        = monpb.Aggregation_ALIGN_DELTA
+	AlignPercentile99 = monpb.Aggregation_ALIGN_PERCENTILE_99
+	AlignPercentile50 = monpb.Aggregation_ALIGN_PERCENTILE_50
+
+	ReduceNone  = monpb.Aggregation_REDUCE_NONE
+	ReduceMean  = monpb.Aggregation_REDUCE_MEAN
+	ReduceSum   = monpb.Aggregation_REDUCE_SUM
+	ReduceMin   = monpb.Aggregation_REDUCE_MIN
+	ReduceMax   = monpb.Aggregation_REDUCE_MAX
+	ReduceCount = monpb.Aggregation_REDUCE_COUNT
+)
+
+// Interval is the time range a query reads, End defaults to now
+type Interval struct {
+	Start, End time.Time
+}
+
+// Aggregation aligns each series into Period-long buckets with Aligner, then optionally
+// combines series with Reducer, keeping the labels in GroupBy (such as "metric.label.region")
+type Aggregation struct {
+	Period  time.Duration
+	Aligner Aligner
+	Reducer Reducer
+	GroupBy []string
+}
+
+// Series is one time series read back from Cloud Monitoring, newest point first
+type Series struct {
+	Metric         string
+	Labels         map[string]string
+	Resource       string
+	ResourceLabels map[string]string
+	Kind           string // GAUGE, DELTA or CUMULATIVE
+	Points         []Sample
+}
+
+// Sample is one point. Numbers and bools are in Value, with bools as 0 or 1; strings
+// are in Text and distributions in Distribution.
+type Sample struct {
+	Start, End   time.Time
+	Value        float64
+	Text         string
+	Distribution *DistributionValue
+}
+
+// DistributionValue summarizes a distribution point
+type DistributionValue struct {
+	Count        int64
+	Mean         float64
+	Bounds       []float64
+	BucketCounts []int64
+}
+
+// MetricFilter returns a filter matching metricName as this Client writes it, namespace included
+func (c *Client) MetricFilter(metricName string) string {
+	return fmt.Sprintf("metric.type = %q", c.metricType(metricName))
+}
+
+// QueryTimeSeries reads the series matching filter, e.g. MetricFilter("orders") +
+// ` AND metric.label.region = "eu"`, over interval. A nil aggregation returns raw points.
+// It always reads from Cloud Monitoring, whatever exporter the Client writes to.
+func (c *Client) QueryTimeSeries(ctx context.Context, filter string, interval Interval, aggregation *Aggregation) ([]Series, error) {
+	mc, err := c.reader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	end := interval.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	req := &monpb.ListTimeSeriesRequest{
+		Name:   "projects/" + c.cfg.projectID,
+		Filter: filter,
+		Interval: &monpb.TimeInterval{
+			StartTime: timestamppb.New(interval.Start),
+			EndTime:   timestamppb.New(end),
+		},
+		View: monpb.ListTimeSeriesRequest_FULL,
+	}
+	if aggregation != nil {
+		req.Aggregation = &monpb.Aggregation{
+			AlignmentPeriod:    durationpb.New(aggregation.Period),
+			PerSeriesAligner:   aggregation.Aligner,
+			CrossSeriesReducer: aggregation.Reducer,
+			GroupByFields:      aggregation.GroupBy,
+		}
+	}
+
+	var out []Series
+	it := mc.ListTimeSeries(ctx, req)
+	for {
+		ts, err := it.Next()
+		if err == iterator.Done {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("metrics: query time series: %w", err)
+		}
+		out = append(out, decodeSeries(ts))
+	}
+}
+
+// reader returns a Cloud Monitoring connection for queries, opened on first use
+func (c *Client) reader(ctx context.Context) (*monitoring.MetricClient, error) {
+	c.readerMu.Lock()
+	defer c.readerMu.Unlock()
+	if c.readerConn != nil {
+		return c.readerConn, nil
+	}
+	mc, release, err := connect(ctx, c.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: connect for queries: %w", err)
+	}
+	c.readerConn, c.readerRelease = mc, release
+	return mc, nil
+}
+
+// closeReader releases the query connection, if one was opened
+func (c *Client) closeReader() {
+	c.readerMu.Lock()
+	defer c.readerMu.Unlock()
+	if c.readerRelease != nil {
+		c.readerRelease()
+		c.readerConn, c.readerRelease = nil, nil
+	}
+}
+
+func decodeSeries(ts *monpb.TimeSeries) Series {
+	s := Series{
+		Metric:         ts.GetMetric().GetType(),
+		Labels:         ts.GetMetric().GetLabels(),
+		Resource:       ts.GetResource().GetType(),
+		ResourceLabels: ts.GetResource().GetLabels(),
+		Kind:           ts.GetMetricKind().String(),
+		Points:         make([]Sample, 0, len(ts.GetPoints())),
+	}
+	for _, p := range ts.GetPoints() {
+		sample := Sample{End: p.GetInterval().GetEndTime().AsTime()}
+		if st := p.GetInterval().GetStartTime(); st != nil {
+			sample.Start = st.AsTime()
+		}
+		switch v := p.GetValue().GetValue().(type) {
+		case *monpb.TypedValue_Int64Value:
+			sample.Value = float64(v.Int64Value)
+		case *monpb.TypedValue_DoubleValue:
+			sample.Value = v.DoubleValue
+		case *monpb.TypedValue_BoolValue:
+			if v.BoolValue {
+				sample.Value = 1
+			}
+		case *monpb.TypedValue_StringValue:
+			sample.Text = v.StringValue
+		case *monpb.TypedValue_DistributionValue:
+			d := v.DistributionValue
+			sample.Distribution = &DistributionValue{
+				Count:        d.GetCount(),
+				Mean:         d.GetMean(),
+				Bounds:       d.GetBucketOptions().GetExplicitBuckets().GetBounds(),
+				BucketCounts: d.GetBucketCounts(),
+			}
+		}
+		s.Points = append(s.Points, sample)
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	distpb "google.golang.org/genproto/googleapis/api/distribution"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ListTimeSeries returns every series written to the fake, whatever the filter
+func (f *fakeMonitoring) ListTimeSeries(ctx context.Context, req *monpb.ListTimeSeriesRequest) (*monpb.ListTimeSeriesResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listed = append(f.listed, req)
+	return &monpb.ListTimeSeriesResponse{TimeSeries: f.written}, nil
+}
+
+func TestQueryTimeSeries(t *testing.T) {
+	fake, mc := startFakeMonitoring(t)
+	c, err := New(context.Background(), WithProjectID("test-project"), WithLogger(discardLogger), WithMetricClient(mc), WithNamespace("shop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	end := time.Unix(1_700_000_000, 0).UTC()
+	point := func(v *monpb.TypedValue) *monpb.Point {
+		return &monpb.Point{Interval: &monpb.TimeInterval{EndTime: timestamppb.New(end)}, Value: v}
+	}
+	fake.written = []*monpb.TimeSeries{
+		gaugePoint("custom.googleapis.com/shop/orders", map[string]string{"region": "eu"}, 2.5),
+		{Points: []*monpb.Point{point(int64Value(3)), point(&monpb.TypedValue{Value: &monpb.TypedValue_BoolValue{BoolValue: true}})}},
+		{Points: []*monpb.Point{point(&monpb.TypedValue{Value: &monpb.TypedValue_DistributionValue{DistributionValue: &distpb.Distribution{
+			Count:         4,
+			Mean:          20,
+			BucketOptions: &distpb.Distribution_BucketOptions{Options: &distpb.Distribution_BucketOptions_ExplicitBuckets{ExplicitBuckets: &distpb.Distribution_BucketOptions_Explicit{Bounds: []float64{10}}}},
+			BucketCounts:  []int64{1, 3},
+		}}})}},
+	}
+
+	filter := c.MetricFilter("orders")
+	if filter != `metric.type = "custom.googleapis.com/shop/orders"` {
+		t.Errorf("MetricFilter = %s", filter)
+	}
+	got, err := c.QueryTimeSeries(context.Background(), filter, Interval{Start: end.Add(-time.Hour), End: end}, &Aggregation{Period: time.Minute, Aligner: AlignMean, Reducer: ReduceSum, GroupBy: []string{"metric.label.region"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("read %d series, want 3", len(got))
+	}
+	if s := got[0]; s.Metric != "custom.googleapis.com/shop/orders" || s.Labels["region"] != "eu" || s.Points[0].Value != 2.5 {
+		t.Errorf("gauge series %+v", s)
+	}
+	if p := got[1].Points; p[0].Value != 3 || p[1].Value != 1 || !p[0].End.Equal(end) {
+		t.Errorf("int and bool points %+v", p)
+	}
+	if d := got[2].Points[0].Distribution; d == nil || d.Count != 4 || d.Bounds[0] != 10 || d.BucketCounts[1] != 3 {
+		t.Errorf("distribution %+v", d)
+	}
+
+	req := fake.listed[0]
+	if req.GetName() != "projects/test-project" || req.GetFilter() != filter {
+		t.Errorf("request name %q, filter %q", req.GetName(), req.GetFilter())
+	}
+	if a := req.GetAggregation(); a.GetAlignmentPeriod().AsDuration() != time.Minute || a.GetPerSeriesAligner() != AlignMean || a.GetCrossSeriesReducer() != ReduceSum || a.GetGroupByFields()[0] != "metric.label.region" {
+		t.Errorf("aggregation %v", a)
+	}
+}
@@ -0,0 +1,231 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMetricConflict is returned when a metric name is already in use by a different
+// kind of instrument, or is recorded with a different set of label keys
+var ErrMetricConflict = errors.New("metrics: metric registered with a different kind or label keys")
+
+// InstrumentKind is what records a metric
+type InstrumentKind string
+
+// Instrument kinds
+const (
+	KindGauge        InstrumentKind = "gauge" // PushMetric, RecordMulti and AutoscalingMetric
+	KindGaugeFunc    InstrumentKind = "gauge_func"
+	KindCounter      InstrumentKind = "counter"
+	KindDeltaCounter InstrumentKind = "delta_counter"
+	KindHistogram    InstrumentKind = "histogram"
+	KindCalendarSum  InstrumentKind = "calendar_sum"
+	KindSLO          InstrumentKind = "slo" // its good and total counters are listed separately
+	KindPercentiles  InstrumentKind = "percentiles"
+)
+
+// InstrumentInfo describes a metric known to a Client
+type InstrumentInfo struct {
+	Name      string         `json:"name"` // as passed to the Client
+	Type      string         `json:"type"` // full metric type, namespace included
+	Kind      InstrumentKind `json:"kind"`
+	LabelKeys []string       `json:"label_keys"` // keys callers pass, without default, context or function_name labels
+	// OtherLabelKeys are further key sets a gauge was pushed with. PushMetric gauges
+	// don't have a fixed schema, so these are recorded for debugging rather than rejected.
+	OtherLabelKeys [][]string `json:"other_label_keys,omitempty"`
+	Buckets        Buckets    `json:"buckets,omitempty"` // for histograms
+	Unit           string     `json:"unit,omitempty"`
+	Created        time.Time  `json:"created"`
+}
+
+// registry tracks every metric a Client records. A name belongs to one kind of
+// instrument, so two parts of a program can't write incompatible series to the same
+// metric. Instruments other than PushMetric gauges also have one set of label keys,
+// fixed by their first use.
+type registry struct {
+	mu      sync.Mutex
+	entries map[string]*registryEntry
+}
+
+type registryEntry struct {
+	info       InstrumentInfo
+	instrument any  // the shared instrument for counters, histograms and calendar sums
+	hasSchema  bool // whether LabelKeys has been fixed yet
+	warned     bool // whether a label key mismatch was logged
+	conflicted bool // whether a gauge pushed under the name of another kind was logged
+}
+
+func newRegistry() *registry {
+	return &registry{entries: make(map[string]*registryEntry)}
+}
+
+// claim registers metricName as kind, returning the instrument already registered
+// under it if any. It fails if the name is in use by another kind.
+func (c *Client) claim(metricName string, kind InstrumentKind) (existing any, err error) {
+	r := c.registry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.entries[metricName]; ok {
+		if e.info.Kind != kind {
+			return nil, fmt.Errorf("%w: %q is a %s, not a %s", ErrMetricConflict, metricName, e.info.Kind, kind)
+		}
+		return e.instrument, nil
+	}
+	r.entries[metricName] = &registryEntry{info: InstrumentInfo{
+		Name:    metricName,
+		Type:    c.metricType(metricName),
+		Kind:    kind,
+		Created: time.Now(),
+	}}
+	return nil, nil
+}
+
+// remember stores the instrument created for a name claimed by claim
+func (c *Client) remember(metricName string, instrument any, buckets Buckets) {
+	r := c.registry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.entries[metricName]; ok {
+		e.instrument = instrument
+		e.info.Buckets = buckets
+	}
+}
+
+// maxOtherLabelKeys caps the key sets recorded for a gauge beyond its first
+const maxOtherLabelKeys = 10
+
+// checkLabels reports whether labels have the label keys metricName was first recorded
+// with, fixing them on first use. Mismatches are logged once per metric.
+func (c *Client) checkLabels(metricName string, labels map[string]string) bool {
+	r := c.registry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[metricName]
+	if !ok || e.matchLabels(labels) {
+		return true // not an instrument, e.g. a self metric, or a match
+	}
+	if !e.warned {
+		e.warned = true
+		c.logger.Error("dropping points with mismatched label keys", "metric", metricName,
+			"want", strings.Join(e.info.LabelKeys, ","), "got", strings.Join(sortedKeys(labels), ","))
+	}
+	return false
+}
+
+// matchLabels reports whether labels have the entry's label keys, fixing them if it has
+// none yet. Callers hold the registry's mu.
+func (e *registryEntry) matchLabels(labels map[string]string) bool {
+	if !e.hasSchema {
+		e.info.LabelKeys = sortedKeys(labels)
+		e.hasSchema = true
+		return true
+	}
+	return sameKeys(e.info.LabelKeys, labels)
+}
+
+// sameKeys reports whether labels has exactly keys
+func sameKeys(keys []string, labels map[string]string) bool {
+	if len(labels) != len(keys) {
+		return false
+	}
+	for _, k := range keys {
+		if _, ok := labels[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// registerGauge claims metricName as a gauge pushed through PushMetric and the like.
+// Such gauges may be pushed with optional labels, so their label keys are recorded
+// for Describe but not enforced. A name in use by another kind is logged once.
+func (c *Client) registerGauge(metricName string, labels map[string]string) error {
+	_, err := c.claim(metricName, KindGauge)
+	r := c.registry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.entries[metricName]
+	if err != nil {
+		// PushMetric has no error to return, so log the conflict once per metric
+		if !e.conflicted {
+			e.conflicted = true
+			c.logger.Error("dropping gauge points for a metric of another kind", "metric", metricName, "error", err)
+		}
+		return err
+	}
+	if e.matchLabels(labels) || len(e.info.OtherLabelKeys) >= maxOtherLabelKeys {
+		return nil
+	}
+	for _, keys := range e.info.OtherLabelKeys {
+		if sameKeys(keys, labels) {
+			return nil
+		}
+	}
+	e.info.OtherLabelKeys = append(e.info.OtherLabelKeys, sortedKeys(labels))
+	return nil
+}
+
+// declareGauge claims metricName for a gauge instrument created with a fixed label set,
+// failing if the metric is already recorded with other label keys
+func (c *Client) declareGauge(metricName string, labels map[string]string) error {
+	if _, err := c.claim(metricName, KindGauge); err != nil {
+		return err
+	}
+	r := c.registry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.entries[metricName]
+	if !e.matchLabels(labels) {
+		return fmt.Errorf("%w: %q recorded with label keys %v, not %v", ErrMetricConflict, metricName, e.info.LabelKeys, sortedKeys(labels))
+	}
+	return nil
+}
+
+// labelKeys returns the label keys instruments writing metricType are declared with
+func (r *registry) labelKeys(metricType string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.info.Type == metricType && e.hasSchema {
+			keys := e.info.LabelKeys
+			for _, other := range e.info.OtherLabelKeys {
+				keys = append(keys[:len(keys):len(keys)], other...)
+			}
+			return keys
+		}
+	}
+	return nil
+}
+
+// List describes every metric recorded or instrument created, sorted by name
+func (c *Client) List() []InstrumentInfo {
+	r := c.registry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]InstrumentInfo, 0, len(r.entries))
+	for _, e := range r.entries {
+		info := e.info
+		info.Unit = c.unit(info.Type)
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Describe returns what is known about metricName
+func (c *Client) Describe(metricName string) (InstrumentInfo, bool) {
+	r := c.registry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[metricName]
+	if !ok {
+		return InstrumentInfo{}, false
+	}
+	info := e.info
+	info.Unit = c.unit(info.Type)
+	return info, true
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPushMetricOptionalLabels(t *testing.T) {
+	c, exp := newTestClient(t)
+	ctx := context.Background()
+	c.PushMetric(ctx, "orders", 1, map[string]string{"region": "eu"})
+	c.PushMetric(ctx, "orders", 2, map[string]string{"region": "eu", "coupon": "x"})
+	c.PushMetric(ctx, "orders", 3, nil)
+	c.PushMetric(ctx, "orders", 4, map[string]string{"coupon": "y", "region": "us"})
+
+	if n := len(exp.byType("custom.googleapis.com/orders")); n != 4 {
+		t.Fatalf("exported %d points, want all 4", n)
+	}
+	info, ok := c.Describe("orders")
+	if !ok || info.Kind != KindGauge {
+		t.Fatalf("Describe = %+v, %v", info, ok)
+	}
+	if !reflect.DeepEqual(info.LabelKeys, []string{"region"}) {
+		t.Errorf("LabelKeys = %v", info.LabelKeys)
+	}
+	if want := [][]string{{"coupon", "region"}, {}}; !reflect.DeepEqual(info.OtherLabelKeys, want) {
+		t.Errorf("OtherLabelKeys = %v, want %v", info.OtherLabelKeys, want)
+	}
+}
+
+func TestRegistryKindConflicts(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+	c.PushMetric(ctx, "shared", 1, nil)
+	if ctr := c.NewCounter("shared"); ctr.client != nil {
+		t.Error("counter created over a gauge")
+	}
+	c.NewCounter("hits")
+	if err := c.TryPushMetric(ctx, "hits", 1, nil); !errors.Is(err, ErrMetricConflict) {
+		t.Errorf("gauge over a counter: %v, want ErrMetricConflict", err)
+	}
+	if a, b := c.NewCounter("same"), c.NewCounter("same"); a != b {
+		t.Error("second NewCounter returned a new counter")
+	}
+}
+
+func TestGaugeKindConflictLoggedOnce(t *testing.T) {
+	var logs bytes.Buffer
+	c, _ := newTestClient(t, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	ctx := context.Background()
+	c.NewCounter("orders")
+	c.PushMetric(ctx, "orders", 1, nil)
+	c.RecordMulti(ctx, nil, map[string]float64{"orders": 2})
+	c.TryPushMetric(ctx, "orders", 3, nil)
+	if n := strings.Count(logs.String(), "dropping gauge points for a metric of another kind"); n != 1 {
+		t.Errorf("conflict logged %d times, want once:\n%s", n, logs.String())
+	}
+}
+
+func TestDeclaredGaugeSchema(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+	if _, err := c.NewAutoscalingMetric(ctx, "backlog", PerService, map[string]string{"queue": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.NewAutoscalingMetric(ctx, "backlog", PerService, map[string]string{"queue": "b"}); err != nil {
+		t.Errorf("same keys rejected: %v", err)
+	}
+	_, err := c.NewAutoscalingMetric(ctx, "backlog", PerService, map[string]string{"topic": "a"})
+	if !errors.Is(err, ErrMetricConflict) {
+		t.Errorf("mismatched keys: %v, want ErrMetricConflict at registration", err)
+	}
+}
+
+func TestInstrumentLabelSchema(t *testing.T) {
+	c, exp := newTestClient(t)
+	ctx := context.Background()
+	ctr := c.NewCounter("requests")
+	ctr.Add(ctx, 1, map[string]string{"code": "200"})
+	ctr.Add(ctx, 1, map[string]string{"route": "/"}) // mismatched keys are dropped for instruments
+	c.Flush(ctx)
+	if n := len(exp.byType("custom.googleapis.com/requests")); n != 1 {
+		t.Errorf("exported %d series, want 1", n)
+	}
+}
+
+func TestList(t *testing.T) {
+	c, _ := newTestClient(t)
+	c.NewHistogram("b/latency", DefaultLatencyBuckets)
+	c.PushMetric(context.Background(), "a/gauge", 1, nil)
+	list := c.List()
+	if len(list) != 2 || list[0].Name != "a/gauge" || list[1].Kind != KindHistogram || len(list[1].Buckets) == 0 {
+		t.Errorf("List = %+v", list)
+	}
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/compute/metadata"
+	gcprpb "google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+// ErrInvalidResource is returned for a Resource missing labels its type requires
+var ErrInvalidResource = errors.New("metrics: invalid monitored resource")
+
+// Resource is the monitored resource a series is written against, such as a
+// generic_task or gce_instance. project_id defaults to the Client's project.
+type Resource struct {
+	Type   string
+	Labels map[string]string
+}
+
+// requiredResourceLabels lists the labels Cloud Monitoring requires for the resource
+// types custom metrics are commonly written against. Other types are not checked.
+var requiredResourceLabels = map[string][]string{
+	"global":        {"project_id"},
+	"generic_task":  {"project_id", "location", "namespace", "job", "task_id"},
+	"generic_node":  {"project_id", "location", "namespace", "node_id"},
+	"gce_instance":  {"project_id", "instance_id", "zone"},
+	"k8s_cluster":   {"project_id", "location", "cluster_name"},
+	"k8s_node":      {"project_id", "location", "cluster_name", "node_name"},
+	"k8s_pod":       {"project_id", "location", "cluster_name", "namespace_name", "pod_name"},
+	"k8s_container": {"project_id", "location", "cluster_name", "namespace_name", "pod_name", "container_name"},
+}
+
+// serverlessResourceTypes are resource types Cloud Monitoring doesn't accept custom
+// metrics for. Cloud Run and Cloud Functions instances write against generic_task instead.
+var serverlessResourceTypes = map[string]bool{
+	"cloud_run_revision": true,
+	"cloud_run_job":      true,
+	"cloud_function":     true,
+}
+
+// Validate reports whether r has a type and, for known types, every required label
+func (r Resource) Validate() error {
+	if r.Type == "" {
+		return fmt.Errorf("%w: type is empty", ErrInvalidResource)
+	}
+	if serverlessResourceTypes[r.Type] {
+		return fmt.Errorf("%w: %s does not accept custom metrics, use ServerlessResource for a generic_task", ErrInvalidResource, r.Type)
+	}
+	var missing []string
+	for _, k := range requiredResourceLabels[r.Type] {
+		if r.Labels[k] == "" {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: %s requires labels %s", ErrInvalidResource, r.Type, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ServerlessResource describes this Cloud Run or Cloud Functions instance as the
+// generic_task custom metrics can be written against, mapped as Google's OpenTelemetry
+// exporters do: location is the region, namespace is "cloud_run" or "cloud_functions",
+// job is the service (K_SERVICE) and task_id the instance ID. Region and instance ID are
+// read from the metadata server, CLOUD_RUN_REGION and the hostname are used off GCP.
+func ServerlessResource(ctx context.Context) (Resource, error) {
+	job := os.Getenv("K_SERVICE")
+	if job == "" {
+		job = os.Getenv("CLOUD_RUN_JOB")
+	}
+	namespace := "cloud_run"
+	if os.Getenv("FUNCTION_TARGET") != "" {
+		namespace = "cloud_functions"
+	}
+
+	location := os.Getenv("CLOUD_RUN_REGION")
+	taskID := ""
+	if metadata.OnGCE() {
+		if region, err := metadata.GetWithContext(ctx, "instance/region"); err == nil {
+			location = path.Base(strings.TrimSpace(region)) // projects/<number>/regions/<region>
+		}
+		if id, err := metadata.InstanceIDWithContext(ctx); err == nil {
+			taskID = id
+		}
+	}
+	if taskID == "" {
+		taskID = getInstanceID()
+	}
+
+	res := Resource{Type: "generic_task", Labels: map[string]string{
+		"location":  location,
+		"namespace": namespace,
+		"job":       job,
+		"task_id":   taskID,
+	}}
+	if job == "" || location == "" {
+		return res, fmt.Errorf("%w: not running on Cloud Run or Cloud Functions, set K_SERVICE and CLOUD_RUN_REGION", ErrInvalidResource)
+	}
+	return res, nil
+}
+
+type resourceKey struct{}
+
+// ContextWithResource returns a context whose gauges, counter increments and histogram
+// observations are written against res instead of the global resource. It overrides
+// the resource set on an instrument with SetResource.
+func ContextWithResource(ctx context.Context, res Resource) context.Context {
+	res.Labels = copyLabels(res.Labels)
+	return context.WithValue(ctx, resourceKey{}, res)
+}
+
+// resolveResource validates res and converts it, filling in project_id
+func (c *Client) resolveResource(res Resource) (*gcprpb.MonitoredResource, error) {
+	labels := copyLabels(res.Labels)
+	if labels["project_id"] == "" {
+		labels["project_id"] = c.cfg.projectID
+	}
+	res.Labels = labels
+	if err := res.Validate(); err != nil {
+		return nil, err
+	}
+	return &gcprpb.MonitoredResource{Type: res.Type, Labels: labels}, nil
+}
+
+// contextResource returns the resource attached by ContextWithResource, or fallback
+// when there is none
+func (c *Client) contextResource(ctx context.Context, fallback *gcprpb.MonitoredResource) (*gcprpb.MonitoredResource, error) {
+	res, ok := ctx.Value(resourceKey{}).(Resource)
+	if !ok {
+		return fallback, nil
+	}
+	return c.resolveResource(res)
+}
+
+// resourceSeriesKey extends a label set's series key with the resource it is written against
+func resourceSeriesKey(res *gcprpb.MonitoredResource, labelKey string) string {
+	if res == nil {
+		return labelKey
+	}
+	return res.GetType() + "\x00" + seriesKey(res.GetLabels()) + "\x00" + labelKey
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResourceValidate(t *testing.T) {
+	tests := []struct {
+		res Resource
+		ok  bool
+	}{
+		{Resource{Type: "global", Labels: map[string]string{"project_id": "p"}}, true},
+		{Resource{Type: "generic_task", Labels: map[string]string{"project_id": "p", "location": "l", "namespace": "n", "job": "j"}}, false},
+		{Resource{Type: "cloud_run_revision", Labels: map[string]string{"project_id": "p", "location": "l", "service_name": "s", "revision_name": "r", "configuration_name": "c"}}, false},
+		{Resource{Type: "cloud_function", Labels: map[string]string{"project_id": "p", "region": "r", "function_name": "f"}}, false},
+		{Resource{Type: "some_other_type"}, true},
+		{Resource{}, false},
+	}
+	for _, tt := range tests {
+		err := tt.res.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("Validate(%s) = %v, want ok %v", tt.res.Type, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidResource) {
+			t.Errorf("Validate(%s) = %v, want ErrInvalidResource", tt.res.Type, err)
+		}
+	}
+}
+
+func TestServerlessResource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/instance/region"):
+			w.Write([]byte("projects/123/regions/europe-west1"))
+		case strings.HasSuffix(r.URL.Path, "/instance/id"):
+			w.Write([]byte("00bf4bf02d"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+	t.Setenv("K_SERVICE", "checkout")
+
+	res, err := ServerlessResource(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"location": "europe-west1", "namespace": "cloud_run", "job": "checkout", "task_id": "00bf4bf02d"}
+	if res.Type != "generic_task" {
+		t.Errorf("type = %q, want generic_task", res.Type)
+	}
+	for k, v := range want {
+		if res.Labels[k] != v {
+			t.Errorf("%s = %q, want %q", k, res.Labels[k], v)
+		}
+	}
+
+	t.Setenv("FUNCTION_TARGET", "Buy")
+	res, err = ServerlessResource(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Labels["namespace"] != "cloud_functions" {
+		t.Errorf("namespace = %q, want cloud_functions", res.Labels["namespace"])
+	}
+
+	res.Labels["project_id"] = "p"
+	if err := res.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+)
+
+// sampleWeightLabel holds the sampling weight of gauge points kept by a sampled metric
+const sampleWeightLabel = "sample_weight"
+
+// Sampling records only a share of the events of a metric
+type Sampling struct {
+	every int64   // record every nth event, if set
+	p     float64 // otherwise record each event with probability p
+}
+
+// OneIn records every nth event
+func OneIn(n int) Sampling {
+	return Sampling{every: int64(max(n, 1))}
+}
+
+// Probability records each event with probability p, in (0, 1]
+func Probability(p float64) Sampling {
+	return Sampling{p: math.Min(math.Max(p, 0), 1)}
+}
+
+// WithSampling samples events of metricName for high frequency metrics that only
+// need a statistical signal. Increments of a Counter or CalendarSum and observations
+// of a Histogram that are kept are scaled up by the inverse of the sampling rate, so
+// totals and bucket counts stay correct on average. A gauge level can't be scaled, so
+// kept gauge points carry the weight in a sample_weight label for reweighting sums at
+// query time. Percentiles are unaffected by uniform sampling and are not weighted.
+func WithSampling(metricName string, s Sampling) Option {
+	return func(c *config) {
+		if c.sampling == nil {
+			c.sampling = make(map[string]Sampling)
+		}
+		c.sampling[metricName] = s
+	}
+}
+
+// sampler decides which events of one metric are recorded
+type sampler struct {
+	Sampling
+	seen atomic.Int64
+}
+
+func newSamplers(cfg map[string]Sampling) map[string]*sampler {
+	samplers := make(map[string]*sampler, len(cfg))
+	for name, s := range cfg {
+		samplers[name] = &sampler{Sampling: s}
+	}
+	return samplers
+}
+
+// weighted returns labels with the sampling weight of a kept gauge point added.
+// Unsampled points keep their labels.
+func weighted(labels map[string]string, weight float64) map[string]string {
+	if weight == 1 {
+		return labels
+	}
+	out := copyLabels(labels)
+	out[sampleWeightLabel] = strconv.FormatFloat(weight, 'g', -1, 64)
+	return out
+}
+
+// sample reports whether an event of metricName should be recorded, and the weight
+// to scale a recorded increment by
+func (c *Client) sample(metricName string) (weight float64, ok bool) {
+	s := c.samplers[metricName]
+	if s == nil {
+		return 1, true
+	}
+	if s.every > 0 {
+		return float64(s.every), s.seen.Add(1)%s.every == 0
+	}
+	if s.p <= 0 {
+		return 0, false
+	}
+	return 1 / s.p, rand.Float64() < s.p
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestSampledGaugesCarryWeight(t *testing.T) {
+	c, exp := newTestClient(t, WithSampling("sampled", OneIn(4)))
+	ctx := context.Background()
+	for i := 0; i < 8; i++ {
+		c.PushMetric(ctx, "sampled", 1, nil)
+	}
+	c.PushMetric(ctx, "plain", 1, nil)
+	c.RecordMulti(ctx, map[string]string{"k": "v"}, map[string]float64{"sampled": 1, "plain": 2})
+
+	sampled := exp.byType("custom.googleapis.com/sampled")
+	if len(sampled) != 2 {
+		t.Fatalf("exported %d sampled points, want 2 of 9", len(sampled))
+	}
+	for _, ts := range sampled {
+		if w := ts.GetMetric().GetLabels()[sampleWeightLabel]; w != "4" {
+			t.Errorf("sample_weight = %q, want 4", w)
+		}
+	}
+	for _, ts := range exp.byType("custom.googleapis.com/plain") {
+		if _, ok := ts.GetMetric().GetLabels()[sampleWeightLabel]; ok {
+			t.Error("unsampled point has a sample_weight label")
+		}
+	}
+}
+
+func TestSampledHistogramIsWeighted(t *testing.T) {
+	c, exp := newTestClient(t, WithSampling("latency", OneIn(10)))
+	h := c.NewHistogram("latency", Buckets{10, 100})
+	ctx := context.Background()
+	for i := 0; i < 1000; i++ {
+		h.Observe(ctx, 50, nil)
+	}
+	c.Flush(ctx)
+
+	got := exp.byType("custom.googleapis.com/latency")
+	if len(got) != 1 {
+		t.Fatalf("exported %d series, want 1", len(got))
+	}
+	dist := got[0].GetPoints()[0].GetValue().GetDistributionValue()
+	if dist.GetCount() != 1000 || dist.GetBucketCounts()[1] != 1000 {
+		t.Errorf("count %d, buckets %v, want 1000 in the middle bucket", dist.GetCount(), dist.GetBucketCounts())
+	}
+	if dist.GetMean() != 50 || dist.GetSumOfSquaredDeviation() != 0 {
+		t.Errorf("mean %v, ssd %v, want 50 and 0", dist.GetMean(), dist.GetSumOfSquaredDeviation())
+	}
+}
+
+func TestWeightedHistogramStatistics(t *testing.T) {
+	s := &histogramSeries{counts: make([]int64, 2)}
+	s.add(0, 1, 2)
+	s.add(0, 4, 1)
+	s.add(0, 2.5, 0.5) // carried, counted with the next fractional weight
+	s.add(0, 2.5, 0.5)
+	// Equivalent to observing 1, 1, 4 and 2.5
+	values := []float64{1, 1, 4, 2.5}
+	var mean, ssd float64
+	for _, v := range values {
+		mean += v / float64(len(values))
+	}
+	for _, v := range values {
+		ssd += (v - mean) * (v - mean)
+	}
+	if s.count != 4 || math.Abs(s.mean-mean) > 1e-9 || math.Abs(s.m2-ssd) > 1e-9 {
+		t.Errorf("count %d mean %v ssd %v, want 4, %v, %v", s.count, s.mean, s.m2, mean, ssd)
+	}
+}
+
+func TestSampledCounterIsScaled(t *testing.T) {
+	c, exp := newTestClient(t, WithSampling("hits", OneIn(5)))
+	ctr := c.NewCounter("hits")
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		ctr.Add(ctx, 1, nil)
+	}
+	c.Flush(ctx)
+	got := exp.byType("custom.googleapis.com/hits")
+	if len(got) != 1 || got[0].GetPoints()[0].GetValue().GetInt64Value() != 100 {
+		t.Errorf("exported %v, want a total of 100", got)
+	}
+}
@@ -0,0 +1,283 @@
+package metrics
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope is a view of the package-level recording API (gauges, counters, histograms and
+// the other instruments, kill switches, PushScoped and Every) that places metrics under
+// a namespace of its own, below any namespace from WithNamespace. Client-wide calls such
+// as Flush or SetEnabled, and StartHeartbeat and PublishBuildInfo, which describe the
+// process rather than a module, are not scoped and have no Scope method. Libraries that
+// record metrics through the package-level client should use one so their metric names
+// can't collide with the application's:
+//
+//	var scope = metrics.ModuleScope() // "hits" is written as custom.googleapis.com/github.com/acme/cache/hits
+type Scope struct {
+	namespace string
+}
+
+// NewScope returns a Scope that writes metrics under namespace
+func NewScope(namespace string) *Scope {
+	return &Scope{namespace: strings.Trim(namespace, "/")}
+}
+
+// ModuleScope returns a Scope named after the Go module of its caller
+func ModuleScope() *Scope {
+	pc, _, _, _ := runtime.Caller(1)
+	return NewScope(moduleNamespace(pc))
+}
+
+// WithModuleNamespaces scopes package-level calls made from outside the main module
+// automatically, as if each dependency used ModuleScope. Calls from the main module
+// are unaffected.
+func WithModuleNamespaces() Option {
+	return func(c *config) {
+		c.moduleNamespaces = true
+	}
+}
+
+func (s *Scope) name(metricName string) string {
+	if s.namespace == "" {
+		return metricName
+	}
+	return s.namespace + "/" + strings.TrimLeft(metricName, "/")
+}
+
+// PushMetric is the package-level PushMetric within the scope
+func (s *Scope) PushMetric(ctx context.Context, metricName string, value interface{}, labels map[string]string) {
+	initClient(ctx)
+	if defaultClient == nil {
+		return // metrics disabled
+	}
+	defaultClient.PushMetric(ctx, s.name(metricName), value, labels)
+}
+
+// TryPushMetric is the package-level TryPushMetric within the scope
+func (s *Scope) TryPushMetric(ctx context.Context, metricName string, value interface{}, labels map[string]string) error {
+	initClient(ctx)
+	if clientErr != nil {
+		return clientErr
+	}
+	return defaultClient.TryPushMetric(ctx, s.name(metricName), value, labels)
+}
+
+// RegisterGaugeFunc is the package-level RegisterGaugeFunc within the scope
+func (s *Scope) RegisterGaugeFunc(metricName string, labels map[string]string, fn func() float64) (unregister func()) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return func() {} // metrics disabled
+	}
+	return defaultClient.RegisterGaugeFunc(s.name(metricName), labels, fn)
+}
+
+// RecordMulti is the package-level RecordMulti within the scope
+func (s *Scope) RecordMulti(ctx context.Context, labels map[string]string, values map[string]float64) {
+	initClient(ctx)
+	if defaultClient == nil {
+		return // metrics disabled
+	}
+	defaultClient.RecordMulti(ctx, labels, s.names(values))
+}
+
+// NewCounter is the package-level NewCounter within the scope
+func (s *Scope) NewCounter(metricName string) *Counter {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return &Counter{name: s.name(metricName)} // metrics disabled, records nothing
+	}
+	return defaultClient.NewCounter(s.name(metricName))
+}
+
+// NewDeltaCounter is the package-level NewDeltaCounter within the scope
+func (s *Scope) NewDeltaCounter(metricName string) *Counter {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return &Counter{name: s.name(metricName)} // metrics disabled, records nothing
+	}
+	return defaultClient.NewDeltaCounter(s.name(metricName))
+}
+
+// NewHistogram is the package-level NewHistogram within the scope
+func (s *Scope) NewHistogram(metricName string, buckets Buckets) *Histogram {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return &Histogram{name: s.name(metricName)} // metrics disabled, records nothing
+	}
+	return defaultClient.NewHistogram(s.name(metricName), buckets)
+}
+
+// NewCalendarSum is the package-level NewCalendarSum within the scope
+func (s *Scope) NewCalendarSum(metricName string, period CalendarPeriod, timeZone string) (*CalendarSum, error) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return (*Client)(nil).NewCalendarSum(s.name(metricName), period, timeZone) // metrics disabled, records nothing
+	}
+	return defaultClient.NewCalendarSum(s.name(metricName), period, timeZone)
+}
+
+// NewSLO is the package-level NewSLO within the scope
+func (s *Scope) NewSLO(metricName string, objective float64, labels map[string]string, windows ...time.Duration) (*SLO, error) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return (*Client)(nil).NewSLO(s.name(metricName), objective, labels, windows...) // metrics disabled, records nothing
+	}
+	return defaultClient.NewSLO(s.name(metricName), objective, labels, windows...)
+}
+
+// NewPercentiles is the package-level NewPercentiles within the scope
+func (s *Scope) NewPercentiles(metricName string, window time.Duration, quantiles ...float64) (*Percentiles, error) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return (*Client)(nil).NewPercentiles(s.name(metricName), window, quantiles...) // metrics disabled, records nothing
+	}
+	return defaultClient.NewPercentiles(s.name(metricName), window, quantiles...)
+}
+
+// NewKillSwitch is the package-level NewKillSwitch within the scope, cfg.Metric is placed in it
+func (s *Scope) NewKillSwitch(cfg KillSwitchConfig) (*KillSwitch, error) {
+	initClient(context.Background())
+	if cfg.Metric != "" {
+		cfg.Metric = s.name(cfg.Metric)
+	}
+	if defaultClient == nil {
+		return (*Client)(nil).NewKillSwitch(cfg) // metrics disabled, the switch still works
+	}
+	return defaultClient.NewKillSwitch(cfg)
+}
+
+// PushDuration is the package-level PushDuration within the scope
+func (s *Scope) PushDuration(ctx context.Context, metricName string, d time.Duration, labels map[string]string) {
+	initClient(ctx)
+	if defaultClient == nil {
+		return // metrics disabled
+	}
+	defaultClient.PushDuration(ctx, s.name(metricName), d, labels)
+}
+
+// Every is the package-level Every within the scope, metrics fn reports are placed in it
+func (s *Scope) Every(interval time.Duration, fn func(ctx context.Context, r Reporter)) (stop func()) {
+	initClient(context.Background())
+	if defaultClient == nil {
+		return func() {} // metrics disabled
+	}
+	return defaultClient.every(interval, s, fn)
+}
+
+// PushScoped is Push within scope s. Go methods can't have type parameters, so it is
+// a function rather than a method of Scope.
+func PushScoped[T Number](s *Scope, ctx context.Context, metricName string, v T, labels ...Label) {
+	initClient(ctx)
+	if defaultClient == nil {
+		return // metrics disabled
+	}
+	PushTo(defaultClient, ctx, s.name(metricName), v, labels...)
+}
+
+// names returns values keyed by scoped names
+func (s *Scope) names(values map[string]float64) map[string]float64 {
+	if s.namespace == "" {
+		return values
+	}
+	scoped := make(map[string]float64, len(values))
+	for name, v := range values {
+		scoped[s.name(name)] = v
+	}
+	return scoped
+}
+
+// callerScope returns the scope for the caller of a package-level function: the caller's
+// module when WithModuleNamespaces is set and it isn't the main module, or an empty scope
+func callerScope() *Scope {
+	if defaultClient == nil || !defaultClient.cfg.moduleNamespaces {
+		return &Scope{}
+	}
+	pc, _, _, _ := runtime.Caller(2) // skip callerScope and the package-level function
+	if mod, ok := callerModules.Load(pc); ok {
+		return mod.(*Scope)
+	}
+	s := &Scope{}
+	if path := modulePath(pc); path != mainModule() {
+		s = NewScope(sanitizeModulePath(path))
+	}
+	callerModules.Store(pc, s)
+	return s
+}
+
+// callerModules caches callerScope by program counter
+var callerModules sync.Map
+
+// moduleNamespace returns the namespace for the module containing pc
+func moduleNamespace(pc uintptr) string {
+	return sanitizeModulePath(modulePath(pc))
+}
+
+// modulePath returns the path of the module containing the function at pc. Without
+// build information it falls back to the function's package path.
+func modulePath(pc uintptr) string {
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return ""
+	}
+	pkg := packagePath(fn.Name())
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return pkg
+	}
+	if pkg == "main" {
+		return info.Main.Path // main packages are named "main" whatever their import path
+	}
+	best := ""
+	for _, path := range modulePaths(info) {
+		if (pkg == path || strings.HasPrefix(pkg, path+"/")) && len(path) > len(best) {
+			best = path
+		}
+	}
+	if best == "" {
+		return pkg
+	}
+	return best
+}
+
+func modulePaths(info *debug.BuildInfo) []string {
+	paths := []string{info.Main.Path}
+	for _, dep := range info.Deps {
+		paths = append(paths, dep.Path)
+	}
+	return paths
+}
+
+// mainModule returns the path of the main module, "" if unknown
+func mainModule() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Path
+	}
+	return ""
+}
+
+// packagePath strips the function and receiver from a name like
+// "github.com/acme/cache.(*Store).Get", leaving "github.com/acme/cache"
+func packagePath(funcName string) string {
+	slash := strings.LastIndex(funcName, "/")
+	if dot := strings.Index(funcName[slash+1:], "."); dot >= 0 {
+		return funcName[:slash+1+dot]
+	}
+	return funcName
+}
+
+// sanitizeModulePath replaces the characters module paths allow but metric names don't
+func sanitizeModulePath(path string) string {
+	b := []byte(path)
+	for i, c := range b {
+		if !isMetricNameChar(c) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
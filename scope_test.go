@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	packageOnce sync.Once
+	packageExp  = &captureExporter{}
+)
+
+// packageClient initializes the package-level client, once per test binary, to export
+// into packageExp. Tests using it record metrics under names of their own.
+func packageClient(t *testing.T) *captureExporter {
+	t.Helper()
+	packageOnce.Do(func() {
+		if err := Init(context.Background(), WithProjectID("test-project"), WithLogger(discardLogger), WithExporter(packageExp)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return packageExp
+}
+
+func TestScopeNames(t *testing.T) {
+	tests := map[string]string{"": "hits", "cache": "cache/hits", "/cache/": "cache/hits"}
+	for ns, want := range tests {
+		if got := NewScope(ns).name("hits"); got != want {
+			t.Errorf("NewScope(%q).name = %q, want %q", ns, got, want)
+		}
+	}
+}
+
+func TestScopeRecordingSurface(t *testing.T) {
+	exp := packageClient(t)
+	s := NewScope("scopetest")
+	ctx := context.Background()
+
+	s.PushMetric(ctx, "gauge", 1, nil)
+	s.PushDuration(ctx, "duration", time.Second, nil)
+	PushScoped(s, ctx, "typed", 3)
+	s.NewCounter("counter").Add(ctx, 1, nil)
+	s.NewDeltaCounter("delta").Add(ctx, 1, nil)
+	s.NewHistogram("histogram", DefaultLatencyBuckets).Observe(ctx, 5, nil)
+	ks, err := s.NewKillSwitch(KillSwitchConfig{Metric: "switch", Threshold: 0.5, Window: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Record(ctx, nil)
+	time.Sleep(2 * time.Millisecond)
+	ks.Record(ctx, nil) // closes the first window
+	stop := s.Every(time.Hour, func(ctx context.Context, r Reporter) { r.Report("every", 1, nil) })
+	defer stop()
+	Flush(ctx)
+
+	waitFor(t, func() bool { return len(exp.byType("custom.googleapis.com/scopetest/every")) > 0 })
+	for _, name := range []string{"gauge", "duration", "typed", "counter", "delta", "histogram", "switch/error_rate", "every"} {
+		if len(exp.byType("custom.googleapis.com/scopetest/"+name)) == 0 {
+			t.Errorf("%s was not exported within the scope", name)
+		}
+	}
+	for _, name := range []string{"gauge", "counter", "every"} {
+		if len(exp.byType("custom.googleapis.com/"+name)) != 0 {
+			t.Errorf("%s was exported outside the scope", name)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// selfMetricPrefix namespaces the metrics the package records about itself
+const selfMetricPrefix = "metrics_client/"
+
+// selfStats counts events worth reporting about the pipeline itself
+type selfStats struct {
+	start         time.Time
+	duplicates    atomic.Int64 // replayed points Cloud Monitoring already had
+	unsupported   atomic.Int64 // values dropped under UnsupportedCount
+	priorityDrops atomic.Int64 // points of low priority metrics dropped under pressure
+	secondary     atomic.Int64 // series a secondary exporter such as Pub/Sub failed to write
+
+	once sync.Once // registers the self metrics collector
+}
+
+// startSelfMetrics starts publishing the periodic self metrics on every flush
+func (c *Client) startSelfMetrics() {
+	c.stats.once.Do(func() { c.register(selfCollector{}) })
+}
+
+// selfCollector publishes the self metrics that are reported on every flush
+type selfCollector struct{}
+
+func (selfCollector) collect(c *Client, now time.Time) []*monpb.TimeSeries {
+	var out []*monpb.TimeSeries
+	if n := c.stats.unsupported.Load(); n > 0 {
+		out = append(out, c.cumulativeInt64(selfMetricPrefix+"unsupported_values", c.stats.start, n))
+	}
+	if n := c.stats.priorityDrops.Load(); n > 0 {
+		out = append(out, c.cumulativeInt64(selfMetricPrefix+"pressure_dropped_points", c.stats.start, n))
+	}
+	if n := c.stats.secondary.Load(); n > 0 {
+		out = append(out, c.cumulativeInt64(selfMetricPrefix+"secondary_export_failures", c.stats.start, n))
+	}
+	return out
+}
+
+// recordDuplicates counts replayed points that were already written, and publishes the new total
+func (c *Client) recordDuplicates(ctx context.Context, n int) {
+	if n == 0 {
+		return
+	}
+	total := c.stats.duplicates.Add(int64(n))
+	ts := c.cumulativeInt64(selfMetricPrefix+"replay_duplicate_points", c.stats.start, total)
+	if err := c.export(ctx, []*monpb.TimeSeries{ts}); err != nil {
+		c.failLog.Error("could not write self metric", "error", err)
+	}
+}
+
+// secondaryFailed logs a failed export to a secondary exporter and counts its series.
+// The batch reached the primary exporter, so it is neither retried nor spooled.
+func (c *Client) secondaryFailed(err error, series int) {
+	c.stats.secondary.Add(int64(series))
+	c.startSelfMetrics()
+	c.failLog.Error("could not write time series to secondary exporter", "series", series, "error", err)
+}
+
+// cumulativeInt64 builds a CUMULATIVE INT64 series for one of the package's own metrics
+func (c *Client) cumulativeInt64(metricName string, start time.Time, value int64) *monpb.TimeSeries {
+	labels := map[string]string{"function_name": c.cfg.functionName}
+	return c.cumulativeSeries(c.metricType(metricName), nil, labels, start, cumulativeEnd(start, time.Now()), &monpb.TypedValue{
+		Value: &monpb.TypedValue_Int64Value{Int64Value: value},
+	})
+}
+
+// pointTime truncates t to the microsecond resolution Cloud Monitoring stores, so a
+// point replayed from disk carries exactly the timestamp the API saw the first time.
+func pointTime(t time.Time) time.Time {
+	return t.Truncate(time.Microsecond)
+}
+
+// duplicatePoints inspects a failed replay export of n series. It returns how many points
+// were rejected only because Cloud Monitoring already holds a point at that time, and
+// whether that explains the whole failure.
+func duplicatePoints(err error, n int) (int, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.InvalidArgument {
+		return 0, false
+	}
+
+	for _, d := range st.Details() {
+		summary, ok := d.(*monpb.CreateTimeSeriesSummary)
+		if !ok {
+			continue
+		}
+		dups, other := 0, 0
+		for _, e := range summary.GetErrors() {
+			if isDuplicateMessage(e.GetStatus().GetMessage()) {
+				dups += int(e.GetPointCount())
+			} else {
+				other += int(e.GetPointCount())
+			}
+		}
+		return dups, dups > 0 && other == 0
+	}
+
+	// No summary attached, fall back to the top-level message
+	if isDuplicateMessage(st.Message()) {
+		return n, true
+	}
+	return 0, false
+}
+
+// isDuplicateMessage matches the errors Cloud Monitoring returns for points it already has
+func isDuplicateMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "written in order") ||
+		strings.Contains(msg, "older start time") ||
+		strings.Contains(msg, "duplicate")
+}
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// DefaultBurnRateWindows are the windows of the multi-window, multi-burn-rate alerts
+// in the Google SRE workbook: 5m and 1h for fast burns, 30m and 6h for medium ones and
+// 6h and 3d for slow ones.
+var DefaultBurnRateWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour, 72 * time.Hour}
+
+// SLO tracks a request-based service level indicator, good events out of total events,
+// and publishes what burn-rate alerts need on every flush:
+//
+//   - <name>/good and <name>/total, cumulative counters of events
+//   - <name>/error_ratio, the share of bad events in each window, labelled window="1h"
+//   - <name>/burn_rate, the error ratio divided by the error budget (1 - objective), so
+//     1 means the budget would be used up exactly by the end of the SLO period
+//
+// An alert for a 2% budget spend in an hour on a 30 day SLO fires when burn_rate is above
+// 14.4 for both window="1h" and window="5m".
+type SLO struct {
+	client    *Client
+	name      string
+	objective float64
+	windows   []time.Duration
+	labels    map[string]string
+	good      *Counter
+	total     *Counter
+
+	mu      sync.Mutex
+	minutes []sloMinute // ring of per-minute counts covering the longest window
+}
+
+// sloMinute holds the events of one minute
+type sloMinute struct {
+	minute      int64 // unix minute
+	good, total int64
+}
+
+// NewSLO returns an SLO named metricName with objective, such as 0.999, evaluated over
+// windows (DefaultBurnRateWindows if none). labels are added to every series it publishes.
+func (c *Client) NewSLO(metricName string, objective float64, labels map[string]string, windows ...time.Duration) (*SLO, error) {
+	if objective <= 0 || objective >= 1 {
+		return nil, fmt.Errorf("metrics: SLO objective must be between 0 and 1, got %v", objective)
+	}
+	if len(windows) == 0 {
+		windows = DefaultBurnRateWindows
+	}
+	windows = append([]time.Duration(nil), windows...)
+	sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+	for _, w := range windows {
+		if w < time.Minute {
+			return nil, fmt.Errorf("metrics: SLO window %v is shorter than a minute", w)
+		}
+	}
+
+	s := &SLO{
+		client:    c,
+		name:      metricName,
+		objective: objective,
+		windows:   windows,
+		labels:    copyLabels(labels),
+		minutes:   make([]sloMinute, int(windows[len(windows)-1]/time.Minute)),
+	}
+	if c == nil {
+		return s, nil // metrics disabled
+	}
+	existing, err := c.claim(metricName, KindSLO)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing.(*SLO), nil
+	}
+	s.good = c.NewCounter(metricName + "/good")
+	s.total = c.NewCounter(metricName + "/total")
+	c.remember(metricName, s, nil)
+	c.register(s)
+	return s, nil
+}
+
+// Record counts one event
+func (s *SLO) Record(ctx context.Context, good bool) {
+	var g int64
+	if good {
+		g = 1
+	}
+	s.RecordN(ctx, g, 1)
+}
+
+// RecordN counts total events of which good were good
+func (s *SLO) RecordN(ctx context.Context, good, total int64) {
+	if s.client == nil || total <= 0 { // nil when metrics are disabled
+		return
+	}
+	good = min(max(good, 0), total)
+	s.good.Add(ctx, good, s.labels)
+	s.total.Add(ctx, total, s.labels)
+
+	minute := time.Now().Unix() / 60
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := &s.minutes[minute%int64(len(s.minutes))]
+	if m.minute != minute {
+		*m = sloMinute{minute: minute}
+	}
+	m.good += good
+	m.total += total
+}
+
+// collect publishes the error ratio and burn rate of every window
+func (s *SLO) collect(c *Client, now time.Time) []*monpb.TimeSeries {
+	var out []*monpb.TimeSeries
+	s.gauges(c, now, func(name string, v float64, labels map[string]string) {
+		if ts, err := c.buildGauge(now, nil, name, v, labels); err == nil {
+			out = append(out, ts)
+		}
+	})
+	return out
+}
+
+// gauges computes the error ratio and burn rate of every window as of now, passing each
+// to add with its prepared labels
+func (s *SLO) gauges(c *Client, now time.Time, add func(name string, v float64, labels map[string]string)) {
+	current := now.Unix() / 60
+	good := make([]int64, len(s.windows))
+	total := make([]int64, len(s.windows))
+
+	s.mu.Lock()
+	for _, m := range s.minutes {
+		age := current - m.minute
+		if m.total == 0 || age < 0 {
+			continue
+		}
+		for i, w := range s.windows {
+			if age < int64(w/time.Minute) {
+				good[i] += m.good
+				total[i] += m.total
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for i, w := range s.windows {
+		ratio := 0.0
+		if total[i] > 0 {
+			ratio = float64(total[i]-good[i]) / float64(total[i])
+		}
+		labels := copyLabels(s.labels)
+		labels["window"] = formatWindow(w)
+		for name, v := range map[string]float64{
+			s.name + "/error_ratio": ratio,
+			s.name + "/burn_rate":   ratio / (1 - s.objective),
+		} {
+			add(name, v, c.prepareLabels(name, labels))
+		}
+	}
+}
+
+// formatWindow renders a window as the shortest of "90s", "5m", "6h" or "3d" that is exact
+func formatWindow(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return strconv.FormatInt(int64(d/(24*time.Hour)), 10) + "d"
+	case d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	}
+	return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+}
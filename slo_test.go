@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSLOWindows(t *testing.T) {
+	c, _ := newTestClient(t)
+	s, err := c.NewSLO("checkout", 0.5, nil, 5*time.Minute, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	minute := now.Unix() / 60
+	s.minutes[minute%5] = sloMinute{minute: minute, good: 9, total: 10}
+	s.minutes[(minute-3)%5] = sloMinute{minute: minute - 3, good: 2, total: 10}
+	s.minutes[(minute-9)%5] = sloMinute{minute: minute - 9, total: 10} // stale slot past every window
+
+	got := map[string]float64{}
+	for _, ts := range s.collect(c, now) {
+		got[ts.GetMetric().GetType()+" "+ts.GetMetric().GetLabels()["window"]] = ts.GetPoints()[0].GetValue().GetDoubleValue()
+	}
+	want := map[string]float64{
+		"custom.googleapis.com/checkout/error_ratio 1m": 0.1,
+		"custom.googleapis.com/checkout/burn_rate 1m":   0.2,
+		"custom.googleapis.com/checkout/error_ratio 5m": 0.45,
+		"custom.googleapis.com/checkout/burn_rate 5m":   0.9,
+	}
+	if len(got) != len(want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestSLORecordCountsEvents(t *testing.T) {
+	c, exp := newTestClient(t)
+	s, err := c.NewSLO("checkout", 0.99, map[string]string{"service": "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	s.Record(ctx, true)
+	s.Record(ctx, false)
+	s.RecordN(ctx, 5, 3) // good is capped at total
+	c.Flush(ctx)
+
+	for metric, want := range map[string]int64{"checkout/good": 4, "checkout/total": 5} {
+		got := exp.byType("custom.googleapis.com/" + metric)
+		if len(got) != 1 || got[0].GetPoints()[0].GetValue().GetInt64Value() != want {
+			t.Errorf("%s exported %v, want %d", metric, got, want)
+		}
+	}
+	if n := len(exp.byType("custom.googleapis.com/checkout/burn_rate")); n != len(DefaultBurnRateWindows) {
+		t.Errorf("published %d burn rates, want one per default window", n)
+	}
+}
+
+func TestNewSLOValidates(t *testing.T) {
+	c, _ := newTestClient(t)
+	if _, err := c.NewSLO("a", 1, nil); err == nil {
+		t.Error("objective of 1 accepted")
+	}
+	if _, err := c.NewSLO("b", 0.99, nil, 30*time.Second); err == nil {
+		t.Error("window under a minute accepted")
+	}
+}
+
+func TestFormatWindow(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		90 * time.Second: "90s",
+		5 * time.Minute:  "5m",
+		6 * time.Hour:    "6h",
+		72 * time.Hour:   "3d",
+	} {
+		if got := formatWindow(d); got != want {
+			t.Errorf("formatWindow(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+// Spool defaults, the TTL stays under the 25 hours Cloud Monitoring accepts points for
+const (
+	defaultSpoolMaxBytes = 64 << 20
+	defaultSpoolTTL      = 24 * time.Hour
+	spoolFileExt         = ".batch"
+)
+
+// WithSpool enables an offline buffer in dir. Batches that fail to export with a
+// retryable error are saved there and replayed, oldest first, once exports succeed
+// again or the next Client starts. When the buffer grows past maxBytes the oldest
+// batches are discarded, and batches older than ttl are dropped unsent. Zero values
+// select a 64 MiB cap and a 24 hour TTL.
+func WithSpool(dir string, maxBytes int64, ttl time.Duration) Option {
+	return func(c *config) {
+		c.spoolDir = dir
+		c.spoolMaxBytes = maxBytes
+		c.spoolTTL = ttl
+	}
+}
+
+// spool is a directory of batches waiting for connectivity to return
+type spool struct {
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+	logger   *slog.Logger
+	failLog  *slog.Logger // for export failures, silent when they are aggregated instead
+
+	mu    sync.Mutex // guards files and seq, and serializes replays
+	files []spoolFile
+	size  atomic.Int64 // read without mu by fill
+	seq   uint64
+}
+
+// spoolFile is one saved batch
+type spoolFile struct {
+	name    string
+	size    int64
+	created time.Time
+}
+
+// openSpool opens dir, picking up batches saved by earlier runs
+func openSpool(dir string, maxBytes int64, ttl time.Duration, logger, failLog *slog.Logger) (*spool, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultSpoolMaxBytes
+	}
+	if ttl <= 0 {
+		ttl = defaultSpoolTTL
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("metrics: create spool directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: read spool directory: %w", err)
+	}
+
+	s := &spool{dir: dir, maxBytes: maxBytes, ttl: ttl, logger: logger, failLog: failLog}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), spoolFileExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		s.files = append(s.files, spoolFile{name: e.Name(), size: info.Size(), created: info.ModTime()})
+		s.size.Add(info.Size())
+	}
+	// Names start with a fixed-width timestamp, so name order is write order
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].name < s.files[j].name })
+	return s, nil
+}
+
+// empty reports whether no batches are waiting
+func (s *spool) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files) == 0
+}
+
+// fill returns the spooled bytes as a share of the size cap
+func (s *spool) fill() float64 {
+	return float64(s.size.Load()) / float64(s.maxBytes)
+}
+
+// save writes series to disk as one batch, evicting the oldest batches past the size cap
+func (s *spool) save(series []*monpb.TimeSeries) error {
+	payload, err := proto.Marshal(&monpb.CreateTimeSeriesRequest{TimeSeries: series})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	name := fmt.Sprintf("%020d-%06d%s", now.UnixNano(), s.seq%1000000, spoolFileExt)
+	s.seq++
+
+	// Write then rename so a crash never leaves a half-written batch
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, payload, 0o644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	s.files = append(s.files, spoolFile{name: name, size: int64(len(payload)), created: now})
+	s.size.Add(int64(len(payload)))
+
+	for s.size.Load() > s.maxBytes && len(s.files) > 1 {
+		s.logger.Warn("spool full, discarding oldest batch", "file", s.files[0].name, "max_bytes", s.maxBytes)
+		s.removeFirst()
+	}
+	return nil
+}
+
+// removeFirst deletes the oldest batch. Callers hold mu.
+func (s *spool) removeFirst() {
+	f := s.files[0]
+	if err := os.Remove(filepath.Join(s.dir, f.name)); err != nil && !os.IsNotExist(err) {
+		s.logger.Error("could not remove spooled batch", "file", f.name, "error", err)
+	}
+	s.files = s.files[1:]
+	s.size.Add(-f.size)
+}
+
+// replay exports saved batches oldest first, deleting each one once it is delivered or
+// rejected for good. It stops at the first retryable failure so newer points don't
+// overtake older ones, and returns how many replayed points were already written.
+func (s *spool) replay(ctx context.Context, export func(context.Context, []*monpb.TimeSeries) error) (duplicates int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.files) > 0 {
+		f := s.files[0]
+		if time.Since(f.created) > s.ttl {
+			s.logger.Warn("dropping expired spooled batch", "file", f.name, "age", time.Since(f.created).Round(time.Second))
+			s.removeFirst()
+			continue
+		}
+
+		payload, err := os.ReadFile(filepath.Join(s.dir, f.name))
+		req := &monpb.CreateTimeSeriesRequest{}
+		if err == nil {
+			err = proto.Unmarshal(payload, req)
+		}
+		if err != nil {
+			s.logger.Error("dropping unreadable spooled batch", "file", f.name, "error", err)
+			s.removeFirst()
+			continue
+		}
+
+		if err := export(ctx, req.GetTimeSeries()); err != nil {
+			dups, only := duplicatePoints(err, len(req.GetTimeSeries()))
+			duplicates += dups
+			switch {
+			case only:
+				// Delivered by an earlier attempt
+			case retryable(err):
+				s.failLog.Warn("spool replay failed, batches kept for retry", "pending", len(s.files), "error", err)
+				return duplicates
+			default:
+				s.failLog.Error("spooled batch rejected, dropping it", "file", f.name, "error", err)
+			}
+		}
+		s.removeFirst()
+	}
+	return duplicates
+}
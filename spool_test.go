@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSpoolReplaysOldestFirstAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, 0, 0, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []float64{1, 2, 3} {
+		if err := s.save([]*monpb.TimeSeries{gaugePoint("custom.googleapis.com/orders", nil, v)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err = openSpool(dir, 0, 0, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failure error
+	export, batches := recordingExport(&failure)
+	s.replay(context.Background(), export)
+	if len(*batches) != 3 {
+		t.Fatalf("replayed %d batches, want 3", len(*batches))
+	}
+	for i, b := range *batches {
+		if v := b[0].GetPoints()[0].GetValue().GetDoubleValue(); v != float64(i+1) {
+			t.Errorf("batch %d = %v, want %d", i, v, i+1)
+		}
+	}
+	if !s.empty() || s.size.Load() != 0 {
+		t.Error("replayed batches left in the spool")
+	}
+}
+
+func TestSpoolStopsAtRetryableError(t *testing.T) {
+	s, err := openSpool(t.TempDir(), 0, 0, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.save([]*monpb.TimeSeries{gaugePoint("custom.googleapis.com/orders", nil, 1)})
+	s.save([]*monpb.TimeSeries{gaugePoint("custom.googleapis.com/orders", nil, 2)})
+
+	failure := status.Error(codes.Unavailable, "offline")
+	export, _ := recordingExport(&failure)
+	s.replay(context.Background(), export)
+	if len(s.files) != 2 {
+		t.Errorf("%d batches left after a retryable failure, want 2", len(s.files))
+	}
+
+	failure = status.Error(codes.InvalidArgument, "bad point")
+	s.replay(context.Background(), export)
+	if !s.empty() {
+		t.Error("rejected batches kept in the spool")
+	}
+}
+
+func TestSpoolEvictsOldestPastCap(t *testing.T) {
+	s, err := openSpool(t.TempDir(), 1, 0, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.save([]*monpb.TimeSeries{gaugePoint("custom.googleapis.com/orders", nil, 1)})
+	s.save([]*monpb.TimeSeries{gaugePoint("custom.googleapis.com/orders", nil, 2)})
+	if len(s.files) != 1 {
+		t.Fatalf("%d batches kept past the size cap, want the newest only", len(s.files))
+	}
+
+	var failure error
+	export, batches := recordingExport(&failure)
+	s.replay(context.Background(), export)
+	if len(*batches) != 1 || (*batches)[0][0].GetPoints()[0].GetValue().GetDoubleValue() != 2 {
+		t.Errorf("replayed %v, want the newest batch", *batches)
+	}
+}
+
+func TestSpoolDropsExpiredAndUnreadableBatches(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, 0, time.Hour, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.save([]*monpb.TimeSeries{gaugePoint("custom.googleapis.com/orders", nil, 1)})
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(dir, s.files[0].name), old, old)
+	os.WriteFile(filepath.Join(dir, "99999999999999999999-000000"+spoolFileExt), []byte("not a batch"), 0o644)
+
+	s, err = openSpool(dir, 0, time.Hour, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failure error
+	export, batches := recordingExport(&failure)
+	s.replay(context.Background(), export)
+	if len(*batches) != 0 {
+		t.Errorf("replayed %d batches, want expired and unreadable ones dropped", len(*batches))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left in the spool directory", len(entries))
+	}
+}
+
+func TestClientSpoolsWhileOffline(t *testing.T) {
+	c, exp := newTestClient(t, WithSpool(t.TempDir(), 0, 0))
+	ctx := context.Background()
+	exp.mu.Lock()
+	exp.err = status.Error(codes.Unavailable, "offline")
+	exp.mu.Unlock()
+	c.PushMetric(ctx, "orders/open", 1, nil)
+	if c.spool.empty() {
+		t.Fatal("failed batch was not spooled")
+	}
+
+	exp.mu.Lock()
+	exp.err = nil
+	exp.series = nil
+	exp.mu.Unlock()
+	c.PushMetric(ctx, "orders/open", 2, nil)
+	got := exp.byType("custom.googleapis.com/orders/open")
+	if len(got) != 2 || got[0].GetPoints()[0].GetValue().GetInt64Value() != 1 {
+		t.Errorf("exported %v, want the spooled point before the new one", got)
+	}
+	if !c.spool.empty() {
+		t.Error("spool not drained once exports succeeded")
+	}
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// StatsD defaults
+const (
+	defaultStatsDAddr   = "127.0.0.1:8125"
+	defaultStatsDPacket = 1432 // fits a 1500 byte MTU with IP and UDP headers
+)
+
+// TagFormat selects how labels are written in StatsD lines
+type TagFormat int
+
+const (
+	// TagsDogStatsD appends tags as |#key:value,key:value, as DogStatsD and the Datadog agent expect
+	TagsDogStatsD TagFormat = iota
+	// TagsInflux appends tags to the name as name,key=value, as Telegraf's statsd input expects
+	TagsInflux
+	// TagsNone drops labels, for plain StatsD
+	TagsNone
+)
+
+// StatsDConfig configures the StatsD exporter
+type StatsDConfig struct {
+	Addr       string    // host:port of the agent, defaults to 127.0.0.1:8125
+	SampleRate float64   // share of points sent, in (0, 1]; 0 means 1
+	Tags       TagFormat // defaults to TagsDogStatsD
+	MaxPacket  int       // bytes per datagram, defaults to 1432
+}
+
+// WithStatsD sends metrics to a local StatsD or DogStatsD agent instead of Cloud Monitoring
+func WithStatsD(cfg StatsDConfig) Option {
+	return func(c *config) {
+		c.statsd = &cfg
+	}
+}
+
+// statsdExporter writes points as StatsD gauges over UDP. Sends are fire-and-forget:
+// an agent that isn't listening loses the points without slowing the caller, and
+// Export never fails.
+type statsdExporter struct {
+	cfg  StatsDConfig
+	conn net.Conn
+}
+
+// NewStatsDExporter returns an Exporter writing to a StatsD or DogStatsD agent. Metric
+// names are mapped as for Datadog, so custom.googleapis.com/checkout/latency becomes
+// checkout.latency. Every point is sent as a gauge, cumulative series carrying their
+// running total, and distributions as <metric>.count and <metric>.avg gauges.
+func NewStatsDExporter(cfg StatsDConfig) (Exporter, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = defaultStatsDAddr
+	}
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		cfg.SampleRate = 1
+	}
+	if cfg.MaxPacket <= 0 {
+		cfg.MaxPacket = defaultStatsDPacket
+	}
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdExporter{cfg: cfg, conn: conn}, nil
+}
+
+func (e *statsdExporter) Export(ctx context.Context, series []*monpb.TimeSeries) error {
+	var packet bytes.Buffer
+	flush := func() {
+		if packet.Len() > 0 {
+			e.conn.Write(packet.Bytes()) // lost if the agent is down
+			packet.Reset()
+		}
+	}
+
+	for _, ts := range series {
+		if e.cfg.SampleRate < 1 && rand.Float64() >= e.cfg.SampleRate {
+			continue
+		}
+		for _, s := range datadogSeriesFor(ts) {
+			line := e.line(s)
+			if line == "" {
+				continue
+			}
+			if packet.Len() > 0 && packet.Len()+1+len(line) > e.cfg.MaxPacket {
+				flush()
+			}
+			if packet.Len() > 0 {
+				packet.WriteByte('\n')
+			}
+			packet.WriteString(line)
+		}
+	}
+	flush()
+	return nil
+}
+
+// line formats one gauge. A gauge line with a leading sign changes the gauge by that
+// amount rather than setting it, so a negative value is written as a set to 0 followed
+// by the decrement, kept in one packet. Sample rates mean nothing for gauges and are
+// not written. Values that aren't finite can't be written and give "".
+func (e *statsdExporter) line(s datadogSeries) string {
+	if math.IsNaN(s.Points[0].Value) || math.IsInf(s.Points[0].Value, 0) {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(s.Metric)
+	if e.cfg.Tags == TagsInflux {
+		for _, t := range s.Tags {
+			k, v, _ := strings.Cut(t, ":")
+			b.WriteString("," + k + "=" + v)
+		}
+	}
+	name := b.String()
+	var suffix string
+	if e.cfg.Tags == TagsDogStatsD && len(s.Tags) > 0 {
+		suffix = "|#" + strings.Join(s.Tags, ",")
+	}
+
+	value := s.Points[0].Value
+	if value == 0 {
+		value = 0 // -0 would be formatted with a sign
+	}
+	if value < 0 {
+		b.WriteString(":0|g" + suffix + "\n" + name)
+	}
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteString("|g" + suffix)
+	return b.String()
+}
+
+func (e *statsdExporter) Close() error {
+	return e.conn.Close()
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	mpb "google.golang.org/genproto/googleapis/api/metric"
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func gaugePoint(metricType string, labels map[string]string, v float64) *monpb.TimeSeries {
+	return &monpb.TimeSeries{
+		Metric: &mpb.Metric{Type: metricType, Labels: labels},
+		Points: []*monpb.Point{{
+			Interval: &monpb.TimeInterval{EndTime: timestamppb.New(time.Unix(1700000000, 0))},
+			Value:    doubleValue(v),
+		}},
+	}
+}
+
+func TestStatsDLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		tags  TagFormat
+		value float64
+		want  string
+	}{
+		{"dogstatsd", TagsDogStatsD, 1.5, "checkout.latency:1.5|g|#region:eu"},
+		{"influx", TagsInflux, 2, "checkout.latency,region=eu:2|g"},
+		{"none", TagsNone, 2, "checkout.latency:2|g"},
+		{"negative", TagsDogStatsD, -3, "checkout.latency:0|g|#region:eu\ncheckout.latency:-3|g|#region:eu"},
+		{"negative influx", TagsInflux, -3, "checkout.latency,region=eu:0|g\ncheckout.latency,region=eu:-3|g"},
+		{"negative zero", TagsNone, math.Copysign(0, -1), "checkout.latency:0|g"},
+		{"large", TagsNone, 1e21, "checkout.latency:1000000000000000000000|g"},
+		{"small", TagsNone, 1e-7, "checkout.latency:0.0000001|g"},
+		{"nan", TagsNone, math.NaN(), ""},
+		{"inf", TagsNone, math.Inf(1), ""},
+	}
+	for _, tt := range tests {
+		// A sample rate must not add an @rate suffix to gauges
+		e := &statsdExporter{cfg: StatsDConfig{Tags: tt.tags, SampleRate: 0.5}}
+		series := datadogSeriesFor(gaugePoint("custom.googleapis.com/checkout/latency", map[string]string{"region": "eu"}, tt.value))
+		if got := e.line(series[0]); got != tt.want {
+			t.Errorf("%s: line = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatsDExportPackets(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	exp, err := NewStatsDExporter(StatsDConfig{Addr: pc.LocalAddr().String(), Tags: TagsNone, MaxPacket: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Close()
+
+	var series []*monpb.TimeSeries
+	for i := 0; i < 10; i++ {
+		series = append(series, gaugePoint("custom.googleapis.com/queue/depth", nil, -float64(i+1)))
+	}
+	if err := exp.Export(context.Background(), series); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	for len(lines) < 20 {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read after %d lines: %v", len(lines), err)
+		}
+		if n > 64 {
+			t.Errorf("packet of %d bytes, limit is 64", n)
+		}
+		packet := strings.Split(string(buf[:n]), "\n")
+		if len(packet)%2 != 0 {
+			t.Errorf("packet splits a negative gauge's reset from its value: %q", packet)
+		}
+		lines = append(lines, packet...)
+	}
+	if lines[0] != "queue.depth:0|g" || lines[1] != "queue.depth:-1|g" {
+		t.Errorf("first lines = %q", lines[:2])
+	}
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultExportTimeout bounds each CreateTimeSeries call when no timeout is configured
+const defaultExportTimeout = 5 * time.Second
+
+// WithExportTimeout bounds every call to Cloud Monitoring to d, however long the
+// caller's context allows. Defaults to 5 seconds.
+func WithExportTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.exportTimeout = d
+	}
+}
+
+// WithDetachedExports makes PushMetric return without waiting for the export. The
+// export runs in the background, unaffected by the caller's context being cancelled,
+// and Flush and Close wait for it to finish.
+func WithDetachedExports() Option {
+	return func(c *config) {
+		c.detached = true
+	}
+}
+
+// exportContext derives the context for one call to Cloud Monitoring
+func (c *Client) exportContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, c.exportTimeout())
+}
+
+// exportTimeout returns the configured export timeout or the default
+func (c *Client) exportTimeout() time.Duration {
+	if c.cfg.exportTimeout <= 0 {
+		return defaultExportTimeout
+	}
+	return c.cfg.exportTimeout
+}
+
+// detach runs fn in the background with a context that outlives the caller's
+func (c *Client) detach(ctx context.Context, fn func(context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	c.inflight.add()
+	go func() {
+		defer c.inflight.done()
+		fn(ctx)
+	}()
+}
+
+// tracker counts background work. Unlike sync.WaitGroup it may be added to while
+// another goroutine waits, which happens when PushMetric races with Flush.
+type tracker struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	n    int
+}
+
+func (t *tracker) add() {
+	t.mu.Lock()
+	t.n++
+	t.mu.Unlock()
+}
+
+func (t *tracker) done() {
+	t.mu.Lock()
+	t.n--
+	if t.n == 0 && t.cond != nil {
+		t.cond.Broadcast()
+	}
+	t.mu.Unlock()
+}
+
+// count returns how much work is in flight
+func (t *tracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.n
+}
+
+// wait blocks until no work is in flight
+func (t *tracker) wait() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cond == nil {
+		t.cond = sync.NewCond(&t.mu)
+	}
+	for t.n > 0 {
+		t.cond.Wait()
+	}
+}
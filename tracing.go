@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/status"
+)
+
+// tracerName is the instrumentation scope of the pipeline's spans
+const tracerName = "github.com/henrydvies/metrics"
+
+// WithTracerProvider creates OpenTelemetry spans for flushes, batch assembly and every
+// export call, with batch sizes and outcomes as attributes, so slow or failing exports
+// show up in traces. Spans are children of the context passed to PushMetric or Flush.
+// Without this option no spans are created.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// newTracer returns the tracer for cfg, a no-op one unless a provider was given
+func newTracer(cfg config) trace.Tracer {
+	if cfg.tracerProvider == nil {
+		return noop.NewTracerProvider().Tracer(tracerName)
+	}
+	return cfg.tracerProvider.Tracer(tracerName)
+}
+
+// startSpan starts a pipeline span with the number of series it handles
+func (c *Client) startSpan(ctx context.Context, name string, series int) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, name, trace.WithAttributes(attribute.Int("metrics.series", series)))
+}
+
+// endExportSpan records the outcome of an export and ends its span
+func endExportSpan(span trace.Span, err error, series int) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+		if _, only := duplicatePoints(err, series); only {
+			outcome = "duplicate"
+		} else {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, err.Error())
+		}
+		span.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+	}
+	span.SetAttributes(attribute.String("metrics.outcome", outcome))
+	span.End()
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingProvider hands out its recordingTracer
+type recordingProvider struct {
+	noop.TracerProvider
+	tracer *recordingTracer
+}
+
+// recordingTracer keeps the name, attributes and status of every span it starts
+type recordingTracer struct {
+	noop.Tracer
+
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	noop.Span
+	name   string
+	attrs  map[attribute.Key]attribute.Value
+	status otelcodes.Code
+	ended  bool
+}
+
+func (p recordingProvider) Tracer(string, ...trace.TracerOption) trace.Tracer { return p.tracer }
+
+func (r *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	s := &recordedSpan{name: name, attrs: make(map[attribute.Key]attribute.Value)}
+	cfg := trace.NewSpanStartConfig(opts...)
+	s.SetAttributes(cfg.Attributes()...)
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+	return ctx, s
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) SetStatus(code otelcodes.Code, _ string) { s.status = code }
+func (s *recordedSpan) End(...trace.SpanEndOption)              { s.ended = true }
+
+// named returns the spans called name
+func (r *recordingTracer) named(name string) []*recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*recordedSpan
+	for _, s := range r.spans {
+		if s.name == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestExportSpans(t *testing.T) {
+	tp := &recordingTracer{}
+	c, exp := newTestClient(t, WithTracerProvider(recordingProvider{tracer: tp}))
+	ctx := context.Background()
+	c.PushMetric(ctx, "orders/open", 1, nil)
+	exp.mu.Lock()
+	exp.err = errors.New("unavailable")
+	exp.mu.Unlock()
+	c.PushMetric(ctx, "orders/open", 2, nil)
+
+	spans := tp.named("metrics.export")
+	if len(spans) != 2 {
+		t.Fatalf("started %d export spans, want 2", len(spans))
+	}
+	for i, want := range []string{"ok", "error"} {
+		s := spans[i]
+		if !s.ended || s.attrs["metrics.outcome"].AsString() != want || s.attrs["metrics.series"].AsInt64() != 1 {
+			t.Errorf("span %d: ended %v, attributes %v, want outcome %s", i, s.ended, s.attrs, want)
+		}
+	}
+	if spans[1].status != otelcodes.Error {
+		t.Errorf("failed export span status %v, want Error", spans[1].status)
+	}
+	if len(tp.named("metrics.send")) == 0 {
+		t.Error("no send spans started")
+	}
+}
@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Units in the UCUM notation Cloud Monitoring uses for MetricDescriptor.unit
+const (
+	UnitDimensionless = "1"
+	UnitPercent       = "%"
+	UnitNanoseconds   = "ns"
+	UnitMicroseconds  = "us"
+	UnitMilliseconds  = "ms"
+	UnitSeconds       = "s"
+	UnitBytes         = "By"
+	UnitKibibytes     = "KiBy"
+	UnitMebibytes     = "MiBy"
+	UnitGibibytes     = "GiBy"
+	UnitRequests      = "{request}"
+	UnitErrors        = "{error}"
+)
+
+// WithUnit declares the unit of metricName, written to its MetricDescriptor so dashboards
+// label its axis correctly. For time units (UnitNanoseconds to UnitSeconds) durations
+// recorded for the metric are converted to the unit. Declare units before a metric's first
+// write, the descriptor is created then and not updated afterwards.
+func WithUnit(metricName, unit string) Option {
+	return func(c *config) {
+		if c.units == nil {
+			c.units = make(map[string]string)
+		}
+		c.units[metricName] = unit
+	}
+}
+
+// SetUnit declares the counter's unit, see WithUnit
+func (ctr *Counter) SetUnit(unit string) {
+	if ctr.client != nil { // nil when metrics are disabled
+		ctr.client.setUnit(ctr.name, unit)
+	}
+}
+
+// SetUnit declares the histogram's unit, see WithUnit. Durations passed to ObserveDuration
+// are converted to it if it is a time unit.
+func (h *Histogram) SetUnit(unit string) {
+	if h.client != nil { // nil when metrics are disabled
+		h.client.setUnit(h.name, unit)
+	}
+}
+
+// setUnit records unit for metricName
+func (c *Client) setUnit(metricName, unit string) {
+	c.units.Store(c.metricType(metricName), unit)
+}
+
+// unit returns the unit declared for a metric type, empty if none
+func (c *Client) unit(metricType string) string {
+	u, _ := c.units.Load(metricType)
+	s, _ := u.(string)
+	return s
+}
+
+// durationUnit returns the unit durations recorded for metricName are converted to:
+// its declared unit if that is a time unit, otherwise the client's duration unit
+func (c *Client) durationUnit(metricName string) string {
+	if u := c.unit(c.metricType(metricName)); timeUnit(u) {
+		return u
+	}
+	return c.cfg.durationUnit
+}
+
+// timeUnit reports whether unit is one durations can be converted to
+func timeUnit(unit string) bool {
+	switch unit {
+	case UnitNanoseconds, UnitMicroseconds, UnitMilliseconds, UnitSeconds:
+		return true
+	}
+	return false
+}
+
+// declaredDuration converts a time.Duration value of metricName to its declared time
+// unit, or the client's duration unit, leaving other values unchanged
+func (c *Client) declaredDuration(metricName string, value interface{}) interface{} {
+	if d, ok := value.(time.Duration); ok {
+		return durationValue(d, c.durationUnit(metricName))
+	}
+	return value
+}
+
+// Buckets are the explicit upper bounds of a distribution's buckets, in increasing order
+type Buckets []float64
+
+// DefaultLatencyBuckets cover 1ms to 10s for latencies recorded in UnitMilliseconds
+var DefaultLatencyBuckets = Buckets{1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// DefaultSizeBuckets cover 64B to 64MiB in powers of 4 for sizes recorded in UnitBytes
+var DefaultSizeBuckets = ExponentialBuckets(64, 4, 11)
+
+// LinearBuckets returns count bounds starting at start, each width apart
+func LinearBuckets(start, width float64, count int) Buckets {
+	b := make(Buckets, count)
+	for i := range b {
+		b[i] = start + float64(i)*width
+	}
+	return b
+}
+
+// ExponentialBuckets returns count bounds starting at start, each factor times the previous
+func ExponentialBuckets(start, factor float64, count int) Buckets {
+	b := make(Buckets, count)
+	for i := range b {
+		b[i] = start * math.Pow(factor, float64(i))
+	}
+	return b
+}
+
+// SLOBuckets returns DefaultLatencyBuckets with each SLO latency target added as a bound,
+// so the share of requests under a target can be read exactly off the distribution.
+// Targets are in the same unit as the buckets (UnitMilliseconds).
+func SLOBuckets(targets ...float64) Buckets {
+	return DefaultLatencyBuckets.With(targets...)
+}
+
+// With returns a copy of b with the given bounds merged in, sorted and without duplicates
+func (b Buckets) With(bounds ...float64) Buckets {
+	merged := make(Buckets, 0, len(b)+len(bounds))
+	merged = append(merged, b...)
+	merged = append(merged, bounds...)
+	sort.Float64s(merged)
+
+	out := merged[:0]
+	for i, v := range merged {
+		if i == 0 || v != merged[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Validate reports whether b is a usable bucket layout
+func (b Buckets) Validate() error {
+	if len(b) == 0 {
+		return fmt.Errorf("metrics: buckets are empty")
+	}
+	for i, v := range b {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("metrics: bucket bound %d is %v", i, v)
+		}
+		if i > 0 && v <= b[i-1] {
+			return fmt.Errorf("metrics: bucket bounds must be strictly increasing, %v follows %v", v, b[i-1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package metrics
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits enforced by Cloud Monitoring for custom metrics
+const (
+	metricTypePrefix    = "custom.googleapis.com/"
+	maxMetricTypeLength = 200
+	maxLabelKeyLength   = 100
+	maxLabelValueLength = 1024
+	maxLabelsPerMetric  = 30
+)
+
+// reservedLabelPrefixes are label key prefixes reserved by Google
+var reservedLabelPrefixes = []string{"goog"}
+
+// ValidateMetricName reports whether metricName produces a metric type Cloud Monitoring accepts
+func ValidateMetricName(metricName string) error {
+	if metricName == "" {
+		return fmt.Errorf("metrics: metric name is empty")
+	}
+	if n := len(metricTypePrefix) + len(metricName); n > maxMetricTypeLength {
+		return fmt.Errorf("metrics: metric type %q is %d characters, limit is %d", metricTypePrefix+metricName, n, maxMetricTypeLength)
+	}
+	if !isLetter(metricName[0]) {
+		return fmt.Errorf("metrics: metric name %q must start with a letter", metricName)
+	}
+	for i := 0; i < len(metricName); i++ {
+		if !isMetricNameChar(metricName[i]) {
+			return fmt.Errorf("metrics: metric name %q contains invalid character %q (allowed: letters, digits, '_', '.', '/')", metricName, metricName[i])
+		}
+	}
+	if strings.HasSuffix(metricName, "/") || strings.Contains(metricName, "//") {
+		return fmt.Errorf("metrics: metric name %q contains an empty path segment", metricName)
+	}
+	return nil
+}
+
+// ValidateLabelKey reports whether key is a label key Cloud Monitoring accepts
+func ValidateLabelKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("metrics: label key is empty")
+	}
+	if len(key) > maxLabelKeyLength {
+		return fmt.Errorf("metrics: label key %q is %d characters, limit is %d", key, len(key), maxLabelKeyLength)
+	}
+	if key[0] < 'a' || key[0] > 'z' {
+		return fmt.Errorf("metrics: label key %q must start with a lowercase letter", key)
+	}
+	for i := 0; i < len(key); i++ {
+		if !isLabelKeyChar(key[i]) {
+			return fmt.Errorf("metrics: label key %q contains invalid character %q (allowed: a-z, 0-9, '_')", key, key[i])
+		}
+	}
+	for _, p := range reservedLabelPrefixes {
+		if strings.HasPrefix(key, p) {
+			return fmt.Errorf("metrics: label key %q uses reserved prefix %q", key, p)
+		}
+	}
+	return nil
+}
+
+// ValidateLabels checks every key and value in labels against Cloud Monitoring's rules
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > maxLabelsPerMetric {
+		return fmt.Errorf("metrics: %d labels given, limit is %d", len(labels), maxLabelsPerMetric)
+	}
+	for k, v := range labels {
+		if err := ValidateLabelKey(k); err != nil {
+			return err
+		}
+		if len(v) > maxLabelValueLength {
+			return fmt.Errorf("metrics: value of label %q is %d bytes, limit is %d", k, len(v), maxLabelValueLength)
+		}
+		if !utf8.ValidString(v) {
+			return fmt.Errorf("metrics: value of label %q is not valid UTF-8", k)
+		}
+	}
+	return nil
+}
+
+// sanitizeMetricName rewrites metricName into a valid name, logging a warning when it had to change it
+func sanitizeMetricName(logger *slog.Logger, metricName string) string {
+	if ValidateMetricName(metricName) == nil {
+		return metricName
+	}
+
+	b := []byte(strings.Trim(metricName, "/"))
+	for i, c := range b {
+		if !isMetricNameChar(c) {
+			b[i] = '_'
+		}
+	}
+	fixed := string(b)
+	for strings.Contains(fixed, "//") {
+		fixed = strings.ReplaceAll(fixed, "//", "/")
+	}
+	if fixed == "" || !isLetter(fixed[0]) {
+		fixed = "m_" + fixed
+	}
+	if max := maxMetricTypeLength - len(metricTypePrefix); len(fixed) > max {
+		fixed = strings.TrimRight(fixed[:max], "/")
+	}
+
+	logger.Warn("invalid metric name rewritten", "metric", metricName, "rewritten", fixed)
+	return fixed
+}
+
+// sanitizeLabelKey rewrites key into a valid label key, returning "" if nothing usable is left
+func sanitizeLabelKey(key string) string {
+	b := []byte(strings.ToLower(key))
+	for i, c := range b {
+		if !isLabelKeyChar(c) {
+			b[i] = '_'
+		}
+	}
+	fixed := strings.Trim(string(b), "_")
+	for _, p := range reservedLabelPrefixes {
+		if strings.HasPrefix(fixed, p) {
+			fixed = "x_" + fixed
+		}
+	}
+	if fixed != "" && (fixed[0] < 'a' || fixed[0] > 'z') {
+		fixed = "l_" + fixed
+	}
+	if len(fixed) > maxLabelKeyLength {
+		fixed = fixed[:maxLabelKeyLength]
+	}
+	return fixed
+}
+
+// sanitizeLabelValue truncates v to the value length limit and replaces invalid UTF-8
+func sanitizeLabelValue(v string) string {
+	if !utf8.ValidString(v) {
+		v = strings.ToValidUTF8(v, "�")
+	}
+	if len(v) <= maxLabelValueLength {
+		return v
+	}
+	// Cut on a rune boundary so the result stays valid UTF-8
+	cut := maxLabelValueLength
+	for cut > 0 && !utf8.RuneStart(v[cut]) {
+		cut--
+	}
+	return v[:cut]
+}
+
+// sanitizeLabels returns a copy of labels with keys and values fixed up for Cloud Monitoring.
+// Labels that can't be fixed, or that exceed the per-metric limit, are dropped with a warning.
+// When keys collide after rewriting, a key that was already valid wins over rewritten ones,
+// and among rewritten keys the lexically first wins, so the result never depends on map order.
+func sanitizeLabels(logger *slog.Logger, metricName string, labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels))
+	for _, k := range rewriteOrder(sortedKeys(labels)) {
+		v := labels[k]
+		key := k
+		if ValidateLabelKey(k) != nil {
+			key = sanitizeLabelKey(k)
+			if key == "" {
+				logger.Warn("dropping label with invalid key", "metric", metricName, "label", k)
+				continue
+			}
+			logger.Warn("invalid label key rewritten", "metric", metricName, "label", k, "rewritten", key)
+		}
+		if _, dup := out[key]; dup {
+			logger.Warn("label key collides with an existing label after rewrite, dropping it", "metric", metricName, "label", k)
+			continue
+		}
+		val := sanitizeLabelValue(v)
+		if val != v {
+			logger.Warn("label value truncated or repaired", "metric", metricName, "label", key)
+		}
+		out[key] = val
+	}
+	if len(out) > maxLabelsPerMetric {
+		logger.Warn("too many labels, extra labels dropped", "metric", metricName, "labels", len(out), "limit", maxLabelsPerMetric)
+		dropExtraLabels(out)
+	}
+	return out
+}
+
+// rewriteOrder returns sorted keys with the valid ones first, so when a rewritten key collides
+// with another, an already-valid key wins and otherwise the lexically first one does
+func rewriteOrder(keys []string) []string {
+	var rewrite []string
+	ordered := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if ValidateLabelKey(k) == nil {
+			ordered = append(ordered, k)
+		} else {
+			rewrite = append(rewrite, k)
+		}
+	}
+	return append(ordered, rewrite...)
+}
+
+// sanitizedLabelKeys returns the keys series recorded with keys carry once sanitizeLabels
+// has rewritten them, dropping keys that can't be repaired or collide
+func sanitizedLabelKeys(keys []string) []string {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	seen := make(map[string]bool, len(sorted))
+	out := make([]string, 0, len(sorted))
+	for _, k := range rewriteOrder(sorted) {
+		if ValidateLabelKey(k) != nil {
+			k = sanitizeLabelKey(k)
+		}
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, k)
+	}
+	return out
+}
+
+// dropExtraLabels deletes labels in key order until the limit is met, keeping function_name
+func dropExtraLabels(labels map[string]string) {
+	keys := sortedKeys(labels)
+	for i := len(keys) - 1; i >= 0 && len(labels) > maxLabelsPerMetric; i-- {
+		if keys[i] != "function_name" {
+			delete(labels, keys[i])
+		}
+	}
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isMetricNameChar(c byte) bool {
+	return isLetter(c) || (c >= '0' && c <= '9') || c == '_' || c == '.' || c == '/'
+}
+
+func isLabelKeyChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_'
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
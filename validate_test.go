@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestValidateMetricName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"checkout/latency", true},
+		{"a.b_c/d9", true},
+		{"", false},
+		{"9lives", false},
+		{"bad-char", false},
+		{"trailing/", false},
+		{"empty//segment", false},
+		{strings.Repeat("a", maxMetricTypeLength), false},
+	}
+	for _, tt := range tests {
+		if err := ValidateMetricName(tt.name); (err == nil) != tt.ok {
+			t.Errorf("ValidateMetricName(%q) = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestSanitizeLabelKey(t *testing.T) {
+	tests := map[string]string{
+		"User-ID":   "user_id",
+		"9th":       "l_9th",
+		"google_id": "x_google_id",
+		"--":        "",
+	}
+	for in, want := range tests {
+		if got := sanitizeLabelKey(in); got != want {
+			t.Errorf("sanitizeLabelKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSanitizeLabelsCollisionIsDeterministic(t *testing.T) {
+	labels := map[string]string{"user_id": "valid", "User-ID": "upper", "USER_ID": "shout"}
+	for i := 0; i < 50; i++ {
+		got := sanitizeLabels(discardLogger, "m", labels)
+		if len(got) != 1 || got["user_id"] != "valid" {
+			t.Fatalf("sanitizeLabels = %v, want the already valid key to win", got)
+		}
+	}
+
+	// Without a valid key the lexically first rewritten key wins
+	labels = map[string]string{"User-ID": "upper", "USER_ID": "shout"}
+	for i := 0; i < 50; i++ {
+		if got := sanitizeLabels(discardLogger, "m", labels); got["user_id"] != "shout" {
+			t.Fatalf("sanitizeLabels = %v, want USER_ID to win", got)
+		}
+	}
+}
+
+func TestSanitizeLabelsLimits(t *testing.T) {
+	labels := map[string]string{"function_name": "f", "long": strings.Repeat("é", maxLabelValueLength)}
+	for i := 0; i < maxLabelsPerMetric+5; i++ {
+		labels["k"+strings.Repeat("x", i)] = "v"
+	}
+	got := sanitizeLabels(discardLogger, "m", labels)
+	if len(got) != maxLabelsPerMetric {
+		t.Errorf("got %d labels, want %d", len(got), maxLabelsPerMetric)
+	}
+	if _, ok := got["function_name"]; !ok {
+		t.Error("function_name was dropped")
+	}
+	if v, ok := got["long"]; ok && len(v) > maxLabelValueLength {
+		t.Errorf("value is %d bytes, limit is %d", len(v), maxLabelValueLength)
+	}
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// Errors returned by TryPushMetric
+var (
+	ErrUnsupportedValue = errors.New("metrics: unsupported value type")
+	ErrDropped          = errors.New("metrics: point dropped by a cardinality limit or request budget")
+	// ErrStringValue is returned for string values, which Cloud Monitoring rejects for
+	// custom metrics. It wraps ErrUnsupportedValue.
+	ErrStringValue = fmt.Errorf("%w: custom metrics can't hold STRING points", ErrUnsupportedValue)
+)
+
+// stateLabel is the label WithStringStates records string values in
+const stateLabel = "state"
+
+// WithStringStates records string values, such as "open" or "half_open", as a gauge of
+// 1 with the string in a state label, instead of rejecting them. Use it for enum-like
+// values only: every distinct string is a separate series.
+func WithStringStates() Option {
+	return func(c *config) {
+		c.stringStates = true
+	}
+}
+
+// stringState turns a string value into a value of 1 and a state label when
+// WithStringStates is set, leaving other values as they are
+func (c *Client) stringState(value interface{}, labels map[string]string) (interface{}, map[string]string) {
+	if v, ok := value.(Valuer); ok {
+		value = v.MetricValue()
+	}
+	s, ok := value.(string)
+	if !ok || !c.cfg.stringStates {
+		return value, labels
+	}
+	withState := copyLabels(labels)
+	withState[stateLabel] = sanitizeLabelValue(s)
+	return int64(1), withState
+}
+
+// Valuer is implemented by domain types that know how to report themselves as a metric.
+// MetricValue returns one of the types PushMetric accepts, such as int64 or float64.
+type Valuer interface {
+	MetricValue() interface{}
+}
+
+// UnsupportedValuePolicy decides what happens to values PushMetric can't convert. Under
+// every policy a value that still can't be converted is dropped and TryPushMetric returns
+// ErrUnsupportedValue; the policies differ in what is tried first and how the drop is reported.
+type UnsupportedValuePolicy int
+
+const (
+	// UnsupportedLog logs a warning
+	UnsupportedLog UnsupportedValuePolicy = iota
+	// UnsupportedError logs an error
+	UnsupportedError
+	// UnsupportedCoerce converts any numeric kind, numeric string or fmt.Stringer
+	// holding a number, logging a warning if it can't
+	UnsupportedCoerce
+	// UnsupportedCount logs nothing and counts the point in the
+	// metrics_client/unsupported_values self metric
+	UnsupportedCount
+)
+
+// WithUnsupportedValuePolicy sets how values of unsupported types are handled. Defaults to UnsupportedLog.
+func WithUnsupportedValuePolicy(p UnsupportedValuePolicy) Option {
+	return func(c *config) {
+		c.unsupportedPolicy = p
+	}
+}
+
+// typedValue converts value into a point value, applying the unsupported value policy
+func (c *Client) typedValue(metricName string, value interface{}) (*monpb.TypedValue, error) {
+	if v, ok := value.(Valuer); ok {
+		value = v.MetricValue()
+	}
+	if tv, ok := knownValue(value); ok {
+		return tv, nil
+	}
+	if s, ok := value.(string); ok {
+		if c.cfg.unsupportedPolicy == UnsupportedCoerce {
+			if tv, ok := parseNumber(s); ok {
+				return tv, nil
+			}
+		}
+		c.logger.Error("string values are rejected for custom metrics, use WithStringStates to record them as a label", "metric", metricName)
+		return nil, ErrStringValue
+	}
+
+	switch c.cfg.unsupportedPolicy {
+	case UnsupportedCoerce:
+		if tv, ok := coerceValue(value); ok {
+			return tv, nil
+		}
+		c.logger.Warn("could not coerce value", "metric", metricName, "type", fmt.Sprintf("%T", value))
+	case UnsupportedError:
+		c.logger.Error("unsupported value type", "metric", metricName, "type", fmt.Sprintf("%T", value))
+	case UnsupportedCount:
+		c.stats.unsupported.Add(1)
+		c.startSelfMetrics()
+	default:
+		c.logger.Warn("unsupported value type", "metric", metricName, "type", fmt.Sprintf("%T", value))
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedValue, value)
+}
+
+// knownValue converts the types PushMetric has always supported
+func knownValue(value interface{}) (*monpb.TypedValue, bool) {
+	// Create a typed value for the metric - allows for different types of values
+	switch v := value.(type) {
+	case int:
+		return int64Value(int64(v)), true
+	case int32:
+		return int64Value(int64(v)), true
+	case int64:
+		return int64Value(v), true
+	case float32:
+		return doubleValue(float64(v)), true
+	case float64:
+		return doubleValue(v), true
+	case bool:
+		var intVal int64
+		if v {
+			intVal = 1
+		}
+		return int64Value(intVal), true
+	}
+	return nil, false
+}
+
+// coerceValue makes a best effort to turn value into a number
+func coerceValue(value interface{}) (*monpb.TypedValue, bool) {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int64Value(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64Value(int64(u)), true
+		}
+		return doubleValue(float64(rv.Uint())), true
+	case reflect.Float32, reflect.Float64:
+		return doubleValue(rv.Float()), true
+	case reflect.Bool:
+		return knownValue(rv.Bool())
+	case reflect.String:
+		return parseNumber(rv.String())
+	}
+	if s, ok := value.(fmt.Stringer); ok {
+		return parseNumber(s.String())
+	}
+	return nil, false
+}
+
+// parseNumber parses s as an integer, falling back to a float
+func parseNumber(s string) (*monpb.TypedValue, bool) {
+	s = strings.TrimSpace(s)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return int64Value(i), true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return doubleValue(f), true
+	}
+	return nil, false
+}
+
+func int64Value(v int64) *monpb.TypedValue {
+	return &monpb.TypedValue{Value: &monpb.TypedValue_Int64Value{Int64Value: v}}
+}
+
+func doubleValue(v float64) *monpb.TypedValue {
+	return &monpb.TypedValue{Value: &monpb.TypedValue_DoubleValue{DoubleValue: v}}
+}
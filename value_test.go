@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type temperature float64
+
+func (t temperature) MetricValue() interface{} { return float64(t) }
+
+type unsupported struct{}
+
+func TestUnsupportedValuePolicies(t *testing.T) {
+	tests := []struct {
+		policy UnsupportedValuePolicy
+		logged bool
+	}{
+		{UnsupportedLog, true},
+		{UnsupportedError, true},
+		{UnsupportedCoerce, true},
+		{UnsupportedCount, false},
+	}
+	for _, tt := range tests {
+		var logs bytes.Buffer
+		c, exp := newTestClient(t, WithUnsupportedValuePolicy(tt.policy), WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+		err := c.TryPushMetric(context.Background(), "m", unsupported{}, nil)
+		if !errors.Is(err, ErrUnsupportedValue) {
+			t.Errorf("policy %d: TryPushMetric = %v, want ErrUnsupportedValue", tt.policy, err)
+		}
+		if got := logs.Len() > 0; got != tt.logged {
+			t.Errorf("policy %d: logged = %v, want %v:\n%s", tt.policy, got, tt.logged, logs.String())
+		}
+		if len(exp.byType("custom.googleapis.com/m")) != 0 {
+			t.Errorf("policy %d: unsupported value exported", tt.policy)
+		}
+		if tt.policy == UnsupportedCount && c.stats.unsupported.Load() != 1 {
+			t.Errorf("unsupported values counted %d, want 1", c.stats.unsupported.Load())
+		}
+	}
+}
+
+func TestCoerceValues(t *testing.T) {
+	c, exp := newTestClient(t, WithUnsupportedValuePolicy(UnsupportedCoerce))
+	ctx := context.Background()
+	for _, v := range []interface{}{uint8(7), " 7 ", temperature(7)} {
+		if err := c.TryPushMetric(ctx, "m", v, nil); err != nil {
+			t.Errorf("TryPushMetric(%T) = %v", v, err)
+		}
+	}
+	for _, ts := range exp.exported() {
+		v := ts.GetPoints()[0].GetValue()
+		if v.GetInt64Value() != 7 && v.GetDoubleValue() != 7 {
+			t.Errorf("value = %v, want 7", v)
+		}
+	}
+	if err := c.TryPushMetric(ctx, "m", "seven", nil); !errors.Is(err, ErrStringValue) {
+		t.Errorf("non-numeric string: %v, want ErrStringValue", err)
+	}
+}
+
+func TestStringStates(t *testing.T) {
+	c, exp := newTestClient(t, WithStringStates())
+	if err := c.TryPushMetric(context.Background(), "breaker", "half_open", nil); err != nil {
+		t.Fatal(err)
+	}
+	got := exp.exported()
+	if len(got) != 1 || got[0].GetMetric().GetLabels()[stateLabel] != "half_open" || got[0].GetPoints()[0].GetValue().GetInt64Value() != 1 {
+		t.Errorf("exported %v", got)
+	}
+}
+
+func TestDurationValues(t *testing.T) {
+	c, exp := newTestClient(t, WithDurationUnit(UnitSeconds))
+	if err := c.TryPushMetric(context.Background(), "latency", 1500*time.Millisecond, nil); err != nil {
+		t.Fatal(err)
+	}
+	got := exp.exported()
+	if len(got) != 1 || got[0].GetPoints()[0].GetValue().GetDoubleValue() != 1.5 {
+		t.Errorf("exported %v, want 1.5", got)
+	}
+}
@@ -0,0 +1,354 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// WAL record types
+const (
+	walEntry byte = 1 // a time series waiting for export
+	walAck   byte = 2 // the entry with this sequence number was exported
+)
+
+// walCompactBytes is the file size past which acknowledged entries are rewritten out
+const walCompactBytes = 4 << 20
+
+// maxSeriesPerRequest is the most time series CreateTimeSeries accepts in one call
+const maxSeriesPerRequest = 200
+
+// WithWAL enables write-ahead logging to the file at path. Points for the given
+// metrics (or every metric if none are given) are synced to disk before PushMetric
+// exports them, and only removed once Cloud Monitoring confirms the write. Entries
+// left over from a crash or outage are replayed when the Client starts.
+func WithWAL(path string, metricNames ...string) Option {
+	return func(c *config) {
+		c.walPath = path
+		c.walMetrics = metricNames
+	}
+}
+
+// wal is an append-only log of time series awaiting confirmed export
+type wal struct {
+	path    string
+	metrics map[string]bool // metric types covered by the log, nil means all
+	logger  *slog.Logger
+	failLog *slog.Logger // for export failures, silent when they are aggregated instead
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	nextSeq uint64
+	pending map[uint64]*monpb.TimeSeries
+
+	replayMu sync.Mutex // serializes exports of pending entries so they stay in order
+}
+
+// openWAL opens the log at path, recovering any entries that were never acknowledged.
+// metricTypes lists the full types of the metrics it covers, or none for all.
+func openWAL(path string, metricTypes []string, logger, failLog *slog.Logger) (*wal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("metrics: create wal directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: open wal: %w", err)
+	}
+
+	w := &wal{path: path, f: f, logger: logger, failLog: failLog, pending: make(map[uint64]*monpb.TimeSeries)}
+	if len(metricTypes) > 0 {
+		w.metrics = make(map[string]bool, len(metricTypes))
+		for _, t := range metricTypes {
+			w.metrics[t] = true
+		}
+	}
+
+	good, err := w.load()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Drop a torn record left by a crash mid-write
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("metrics: truncate wal: %w", err)
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("metrics: seek wal: %w", err)
+	}
+	w.size = good
+	return w, nil
+}
+
+// load reads every intact record and returns the offset just past the last one
+func (w *wal) load() (int64, error) {
+	r := bufio.NewReader(w.f)
+	var off int64
+	for {
+		typ, seq, payload, n, err := readRecord(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, errCorruptRecord) {
+				return off, nil
+			}
+			return 0, fmt.Errorf("metrics: read wal: %w", err)
+		}
+		off += n
+		if seq >= w.nextSeq {
+			w.nextSeq = seq + 1
+		}
+		switch typ {
+		case walEntry:
+			ts := &monpb.TimeSeries{}
+			if err := proto.Unmarshal(payload, ts); err != nil {
+				w.logger.Warn("skipping unreadable wal entry", "seq", seq, "error", err)
+				continue
+			}
+			w.pending[seq] = ts
+		case walAck:
+			delete(w.pending, seq)
+		}
+	}
+}
+
+// covers reports whether points for ts go through the log
+func (w *wal) covers(ts *monpb.TimeSeries) bool {
+	return w.metrics == nil || w.metrics[ts.GetMetric().GetType()]
+}
+
+// append durably records ts before it is exported
+func (w *wal) append(ts *monpb.TimeSeries) error {
+	payload, err := proto.Marshal(ts)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seq := w.nextSeq
+	if err := w.writeRecord(walEntry, seq, payload); err != nil {
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	w.nextSeq++
+	w.pending[seq] = ts
+	return nil
+}
+
+// ack marks entries as exported, and trims the file once nothing is left pending
+func (w *wal) ack(seqs []uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, seq := range seqs {
+		if _, ok := w.pending[seq]; !ok {
+			continue
+		}
+		delete(w.pending, seq)
+		// A lost ack only means the entry is sent again, so no sync is needed
+		if err := w.writeRecord(walAck, seq, nil); err != nil {
+			w.logger.Error("could not write wal ack", "error", err)
+		}
+	}
+
+	switch {
+	case len(w.pending) == 0:
+		if err := w.reset(); err != nil {
+			w.logger.Error("could not trim wal", "error", err)
+		}
+	case w.size > walCompactBytes:
+		if err := w.compact(); err != nil {
+			w.logger.Error("could not compact wal", "error", err)
+		}
+	}
+}
+
+// reset empties the log file
+func (w *wal) reset() error {
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.size = 0
+	return nil
+}
+
+// compact rewrites the log so it only holds pending entries
+func (w *wal) compact() error {
+	tmp := w.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	old := w.f
+	w.f, w.size = f, 0
+	for _, seq := range w.pendingSeqs() {
+		payload, err := proto.Marshal(w.pending[seq])
+		if err == nil {
+			err = w.writeRecord(walEntry, seq, payload)
+		}
+		if err != nil {
+			w.f = old
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		w.f = old
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		w.f = old
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	old.Close()
+	return nil
+}
+
+// pendingSeqs returns the sequence numbers awaiting export in write order. Callers hold mu.
+func (w *wal) pendingSeqs() []uint64 {
+	seqs := make([]uint64, 0, len(w.pending))
+	for seq := range w.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+// replay exports every pending entry in write order, acknowledging the ones that succeed.
+// It stops at the first batch that fails with a retryable error so later points don't overtake it.
+// Entries keep their original timestamps and batches are cut the same way each time, so a
+// re-sent entry lands on the point it already wrote; the number of such duplicates is returned.
+func (w *wal) replay(ctx context.Context, export func(context.Context, []*monpb.TimeSeries) error) (duplicates int) {
+	w.replayMu.Lock()
+	defer w.replayMu.Unlock()
+
+	w.mu.Lock()
+	seqs := w.pendingSeqs()
+	series := make([]*monpb.TimeSeries, len(seqs))
+	for i, seq := range seqs {
+		series[i] = w.pending[seq]
+	}
+	w.mu.Unlock()
+
+	for len(seqs) > 0 {
+		n := walBatchLen(series)
+		err := export(ctx, series[:n])
+		if err != nil {
+			dups, only := duplicatePoints(err, n)
+			duplicates += dups
+			switch {
+			case only:
+				// Already delivered by an earlier attempt, nothing to report
+			case retryable(err):
+				w.failLog.Warn("wal export failed, entries kept for retry", "pending", len(seqs), "error", err)
+				return duplicates
+			default:
+				w.failLog.Error("wal entries rejected, dropping them", "dropped", n, "error", err)
+			}
+		}
+		w.ack(seqs[:n])
+		seqs, series = seqs[n:], series[n:]
+	}
+	return duplicates
+}
+
+// walBatchLen returns how many leading series fit in one request. A request may
+// only carry one point per series, so a batch ends before a series repeats.
+func walBatchLen(series []*monpb.TimeSeries) int {
+	seen := make(map[string]bool)
+	for i, ts := range series {
+		if i == maxSeriesPerRequest {
+			return i
+		}
+		key := seriesIdentity(ts)
+		if seen[key] {
+			return i
+		}
+		seen[key] = true
+	}
+	return len(series)
+}
+
+// close closes the log file, leaving pending entries for the next start
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// retryable reports whether a failed export may succeed if sent again
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.AlreadyExists, codes.NotFound, codes.OutOfRange:
+		return false
+	}
+	return true
+}
+
+// Record layout: length(4) crc32(4) type(1) seq(8) payload, where length covers type, seq and payload
+const recordHeader = 8
+
+var errCorruptRecord = errors.New("corrupt record")
+
+// writeRecord appends one record to the file. Callers hold mu.
+func (w *wal) writeRecord(typ byte, seq uint64, payload []byte) error {
+	buf := make([]byte, recordHeader+9+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(9+len(payload)))
+	buf[8] = typ
+	binary.LittleEndian.PutUint64(buf[9:17], seq)
+	copy(buf[17:], payload)
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(buf[8:]))
+	n, err := w.f.Write(buf)
+	w.size += int64(n)
+	return err
+}
+
+// readRecord reads one record, returning errCorruptRecord for a torn or damaged one
+func readRecord(r io.Reader) (typ byte, seq uint64, payload []byte, n int64, err error) {
+	var hdr [recordHeader]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = errCorruptRecord
+		}
+		return
+	}
+	length := binary.LittleEndian.Uint32(hdr[0:4])
+	if length < 9 || length > 64<<20 {
+		err = errCorruptRecord
+		return
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(r, body); err != nil {
+		err = errCorruptRecord
+		return
+	}
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(hdr[4:8]) {
+		err = errCorruptRecord
+		return
+	}
+	return body[0], binary.LittleEndian.Uint64(body[1:9]), body[9:], int64(recordHeader) + int64(length), nil
+}
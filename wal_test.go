@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	monpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recordingExport returns an export func that fails while err is set, and the series it accepted
+func recordingExport(err *error) (func(context.Context, []*monpb.TimeSeries) error, *[][]*monpb.TimeSeries) {
+	var batches [][]*monpb.TimeSeries
+	return func(ctx context.Context, series []*monpb.TimeSeries) error {
+		if *err != nil {
+			return *err
+		}
+		batches = append(batches, append([]*monpb.TimeSeries(nil), series...))
+		return nil
+	}, &batches
+}
+
+func TestWALRecoversPendingEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	w, err := openWAL(path, nil, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		if err := w.append(gaugePoint("custom.googleapis.com/orders", map[string]string{"n": fmt.Sprint(i)}, float64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.ack([]uint64{0})
+	w.close()
+
+	// A torn record at the end is dropped on open
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte{0x20, 0, 0, 0, 1, 2})
+	f.Close()
+
+	w, err = openWAL(path, nil, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	var failure error
+	export, batches := recordingExport(&failure)
+	w.replay(context.Background(), export)
+	if len(*batches) != 1 || len((*batches)[0]) != 2 {
+		t.Fatalf("replayed %v, want one batch of the 2 unacknowledged entries", *batches)
+	}
+	if got := (*batches)[0][0].GetMetric().GetLabels()["n"]; got != "1" {
+		t.Errorf("first replayed entry n=%s, want 1", got)
+	}
+	if len(w.pending) != 0 || w.size != 0 {
+		t.Errorf("pending = %d, size = %d after replay, want an empty log", len(w.pending), w.size)
+	}
+}
+
+func TestWALReplayKeepsEntriesOnRetryableError(t *testing.T) {
+	w, err := openWAL(filepath.Join(t.TempDir(), "metrics.wal"), nil, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	w.append(gaugePoint("custom.googleapis.com/orders", nil, 1))
+
+	failure := status.Error(codes.Unavailable, "offline")
+	export, batches := recordingExport(&failure)
+	w.replay(context.Background(), export)
+	if len(w.pending) != 1 {
+		t.Fatalf("pending = %d after a retryable failure, want 1", len(w.pending))
+	}
+
+	failure = nil
+	w.replay(context.Background(), export)
+	if len(*batches) != 1 || len(w.pending) != 0 {
+		t.Errorf("batches = %d, pending = %d after recovery", len(*batches), len(w.pending))
+	}
+}
+
+func TestWALReplayDropsRejectedEntries(t *testing.T) {
+	w, err := openWAL(filepath.Join(t.TempDir(), "metrics.wal"), nil, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	w.append(gaugePoint("custom.googleapis.com/orders", nil, 1))
+
+	failure := status.Error(codes.InvalidArgument, "Points must be written in order")
+	export, _ := recordingExport(&failure)
+	if dups := w.replay(context.Background(), export); dups != 1 {
+		t.Errorf("duplicates = %d, want 1", dups)
+	}
+	if len(w.pending) != 0 {
+		t.Errorf("pending = %d, want rejected entries dropped", len(w.pending))
+	}
+}
+
+func TestWALBatchLen(t *testing.T) {
+	a := gaugePoint("custom.googleapis.com/a", nil, 1)
+	b := gaugePoint("custom.googleapis.com/b", nil, 1)
+	if n := walBatchLen([]*monpb.TimeSeries{a, b, a, b}); n != 2 {
+		t.Errorf("walBatchLen = %d, want a batch to end before a series repeats", n)
+	}
+	many := make([]*monpb.TimeSeries, maxSeriesPerRequest+5)
+	for i := range many {
+		many[i] = gaugePoint(fmt.Sprintf("custom.googleapis.com/m%d", i), nil, 1)
+	}
+	if n := walBatchLen(many); n != maxSeriesPerRequest {
+		t.Errorf("walBatchLen = %d, want %d", n, maxSeriesPerRequest)
+	}
+}
+
+func TestWALCoversListedMetrics(t *testing.T) {
+	w, err := openWAL(filepath.Join(t.TempDir(), "metrics.wal"), []string{"custom.googleapis.com/orders"}, discardLogger, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	if !w.covers(gaugePoint("custom.googleapis.com/orders", nil, 1)) || w.covers(gaugePoint("custom.googleapis.com/other", nil, 1)) {
+		t.Error("covers does not follow the listed metrics")
+	}
+}
+
+func TestClientReplaysWALOnStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	c, exp := newTestClient(t, WithWAL(path))
+	exp.mu.Lock()
+	exp.err = status.Error(codes.Unavailable, "offline")
+	exp.mu.Unlock()
+	c.PushMetric(context.Background(), "orders/open", 5, nil)
+	c.Close()
+
+	_, exp = newTestClient(t, WithWAL(path))
+	got := exp.byType("custom.googleapis.com/orders/open")
+	if len(got) != 1 || got[0].GetPoints()[0].GetValue().GetInt64Value() != 5 {
+		t.Errorf("exported %v on start, want the point logged by the previous Client", got)
+	}
+}